@@ -34,6 +34,7 @@ setuptools.setup(
         "jupyterlab",
         "pandas>=1.2.4",
         "papermill",
+        "s3fs",
         "typer",
     ],
     packages=setuptools.find_packages(),
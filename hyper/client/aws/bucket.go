@@ -0,0 +1,237 @@
+package aws
+
+import (
+	"fmt"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/gohypergiant/hyperdrive/hyper/types"
+)
+
+// ErrNotSupported is returned by the bucket settings an S3-compatible store doesn't implement
+var ErrNotSupported = fmt.Errorf("not supported by the store")
+
+// BucketExists reports whether the workspace bucket exists and can be accessed
+func BucketExists(s3Config types.S3WorkspacePersistenceRemoteConfiguration) (bool, error) {
+	_, err := getS3Client(s3Config).HeadBucket(&s3.HeadBucketInput{
+		Bucket: aws.String(s3Config.BucketName),
+	})
+	if hasErrorCode(err, "NotFound", s3.ErrCodeNoSuchBucket) {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("cannot access s3://%s, %v", s3Config.BucketName, err)
+	}
+	return true, nil
+}
+
+// CreateBucket creates the workspace bucket in the region of the configuration
+func CreateBucket(s3Config types.S3WorkspacePersistenceRemoteConfiguration) error {
+	input := &s3.CreateBucketInput{Bucket: aws.String(s3Config.BucketName)}
+	// us-east-1 is the default location, and can't be given as a location constraint
+	if s3Config.Region != "" && s3Config.Region != "us-east-1" {
+		input.CreateBucketConfiguration = &s3.CreateBucketConfiguration{LocationConstraint: aws.String(s3Config.Region)}
+	}
+	_, err := getS3Client(s3Config).CreateBucket(input)
+	if err != nil && !hasErrorCode(err, s3.ErrCodeBucketAlreadyOwnedByYou) {
+		return fmt.Errorf("failed to create s3://%s, %v", s3Config.BucketName, err)
+	}
+	return nil
+}
+
+// IsPublicAccessBlocked reports whether all four public access block settings of the workspace
+// bucket are on
+func IsPublicAccessBlocked(s3Config types.S3WorkspacePersistenceRemoteConfiguration) (bool, error) {
+	result, err := getS3Client(s3Config).GetPublicAccessBlock(&s3.GetPublicAccessBlockInput{
+		Bucket: aws.String(s3Config.BucketName),
+	})
+	if hasErrorCode(err, "NoSuchPublicAccessBlockConfiguration") {
+		return false, nil
+	}
+	if err != nil {
+		return false, getBucketSettingError(s3Config, "public access block", err)
+	}
+	block := result.PublicAccessBlockConfiguration
+	return block != nil && aws.BoolValue(block.BlockPublicAcls) && aws.BoolValue(block.IgnorePublicAcls) &&
+		aws.BoolValue(block.BlockPublicPolicy) && aws.BoolValue(block.RestrictPublicBuckets), nil
+}
+
+// BlockPublicAccess turns on all four public access block settings of the workspace bucket
+func BlockPublicAccess(s3Config types.S3WorkspacePersistenceRemoteConfiguration) error {
+	_, err := getS3Client(s3Config).PutPublicAccessBlock(&s3.PutPublicAccessBlockInput{
+		Bucket: aws.String(s3Config.BucketName),
+		PublicAccessBlockConfiguration: &s3.PublicAccessBlockConfiguration{
+			BlockPublicAcls:       aws.Bool(true),
+			IgnorePublicAcls:      aws.Bool(true),
+			BlockPublicPolicy:     aws.Bool(true),
+			RestrictPublicBuckets: aws.Bool(true),
+		},
+	})
+	return getBucketSettingError(s3Config, "public access block", err)
+}
+
+// GetDefaultEncryption returns the default server-side encryption algorithm of the workspace
+// bucket, or an empty string if it has none
+func GetDefaultEncryption(s3Config types.S3WorkspacePersistenceRemoteConfiguration) (string, error) {
+	result, err := getS3Client(s3Config).GetBucketEncryption(&s3.GetBucketEncryptionInput{
+		Bucket: aws.String(s3Config.BucketName),
+	})
+	if hasErrorCode(err, "ServerSideEncryptionConfigurationNotFoundError") {
+		return "", nil
+	}
+	if err != nil {
+		return "", getBucketSettingError(s3Config, "default encryption", err)
+	}
+	if result.ServerSideEncryptionConfiguration == nil {
+		return "", nil
+	}
+	for _, rule := range result.ServerSideEncryptionConfiguration.Rules {
+		if rule.ApplyServerSideEncryptionByDefault != nil {
+			return aws.StringValue(rule.ApplyServerSideEncryptionByDefault.SSEAlgorithm), nil
+		}
+	}
+	return "", nil
+}
+
+// EnableDefaultEncryption encrypts the new objects of the workspace bucket with S3 managed keys,
+// returning the encryption algorithm
+func EnableDefaultEncryption(s3Config types.S3WorkspacePersistenceRemoteConfiguration) (string, error) {
+	_, err := getS3Client(s3Config).PutBucketEncryption(&s3.PutBucketEncryptionInput{
+		Bucket: aws.String(s3Config.BucketName),
+		ServerSideEncryptionConfiguration: &s3.ServerSideEncryptionConfiguration{
+			Rules: []*s3.ServerSideEncryptionRule{{
+				ApplyServerSideEncryptionByDefault: &s3.ServerSideEncryptionByDefault{
+					SSEAlgorithm: aws.String(s3.ServerSideEncryptionAes256),
+				},
+			}},
+		},
+	})
+	return s3.ServerSideEncryptionAes256, getBucketSettingError(s3Config, "default encryption", err)
+}
+
+// EnableVersioning turns on object versioning for the workspace bucket
+func EnableVersioning(s3Config types.S3WorkspacePersistenceRemoteConfiguration) error {
+	_, err := getS3Client(s3Config).PutBucketVersioning(&s3.PutBucketVersioningInput{
+		Bucket: aws.String(s3Config.BucketName),
+		VersioningConfiguration: &s3.VersioningConfiguration{
+			Status: aws.String(s3.BucketVersioningStatusEnabled),
+		},
+	})
+	return getBucketSettingError(s3Config, "versioning", err)
+}
+
+// UpdateLifecycleRules adds the rules to the lifecycle configuration of the workspace bucket, or
+// replaces the rules with the same ids. Other rules are kept. It returns the ids of the rules
+// that were added or changed.
+func UpdateLifecycleRules(s3Config types.S3WorkspacePersistenceRemoteConfiguration, rules []types.BucketLifecycleRule) ([]string, error) {
+	svc := getS3Client(s3Config)
+	existing := []*s3.LifecycleRule{}
+	result, err := svc.GetBucketLifecycleConfiguration(&s3.GetBucketLifecycleConfigurationInput{
+		Bucket: aws.String(s3Config.BucketName),
+	})
+	if err != nil && !hasErrorCode(err, "NoSuchLifecycleConfiguration") {
+		return nil, getBucketSettingError(s3Config, "lifecycle configuration", err)
+	}
+	if err == nil {
+		existing = result.Rules
+	}
+
+	changed := []string{}
+	for _, rule := range rules {
+		lifecycleRule := getLifecycleRule(rule)
+		found := false
+		for i, existingRule := range existing {
+			if aws.StringValue(existingRule.ID) != rule.Id {
+				continue
+			}
+			found = true
+			if !sameLifecycleRule(existingRule, lifecycleRule) {
+				existing[i] = lifecycleRule
+				changed = append(changed, rule.Id)
+			}
+		}
+		if !found {
+			existing = append(existing, lifecycleRule)
+			changed = append(changed, rule.Id)
+		}
+	}
+	if len(changed) == 0 {
+		return changed, nil
+	}
+	_, err = svc.PutBucketLifecycleConfiguration(&s3.PutBucketLifecycleConfigurationInput{
+		Bucket:                 aws.String(s3Config.BucketName),
+		LifecycleConfiguration: &s3.BucketLifecycleConfiguration{Rules: existing},
+	})
+	return changed, getBucketSettingError(s3Config, "lifecycle configuration", err)
+}
+
+func getLifecycleRule(rule types.BucketLifecycleRule) *s3.LifecycleRule {
+	lifecycleRule := &s3.LifecycleRule{
+		ID:     aws.String(rule.Id),
+		Status: aws.String(s3.ExpirationStatusEnabled),
+		Filter: &s3.LifecycleRuleFilter{Prefix: aws.String(rule.Prefix)},
+	}
+	if rule.ExpirationDays > 0 {
+		lifecycleRule.Expiration = &s3.LifecycleExpiration{Days: aws.Int64(rule.ExpirationDays)}
+	}
+	if rule.NoncurrentVersionExpirationDays > 0 {
+		lifecycleRule.NoncurrentVersionExpiration = &s3.NoncurrentVersionExpiration{NoncurrentDays: aws.Int64(rule.NoncurrentVersionExpirationDays)}
+	}
+	if rule.AbortIncompleteUploadDays > 0 {
+		lifecycleRule.AbortIncompleteMultipartUpload = &s3.AbortIncompleteMultipartUpload{DaysAfterInitiation: aws.Int64(rule.AbortIncompleteUploadDays)}
+	}
+	return lifecycleRule
+}
+
+// sameLifecycleRule compares the parts of two lifecycle rules that getLifecycleRule sets. Stores
+// return empty prefixes and unset actions differently, so the rules are compared by value.
+func sameLifecycleRule(a *s3.LifecycleRule, b *s3.LifecycleRule) bool {
+	getPrefix := func(rule *s3.LifecycleRule) string {
+		if rule.Filter != nil && rule.Filter.Prefix != nil {
+			return aws.StringValue(rule.Filter.Prefix)
+		}
+		return aws.StringValue(rule.Prefix)
+	}
+	getDays := func(rule *s3.LifecycleRule) [3]int64 {
+		days := [3]int64{}
+		if rule.Expiration != nil {
+			days[0] = aws.Int64Value(rule.Expiration.Days)
+		}
+		if rule.NoncurrentVersionExpiration != nil {
+			days[1] = aws.Int64Value(rule.NoncurrentVersionExpiration.NoncurrentDays)
+		}
+		if rule.AbortIncompleteMultipartUpload != nil {
+			days[2] = aws.Int64Value(rule.AbortIncompleteMultipartUpload.DaysAfterInitiation)
+		}
+		return days
+	}
+	return aws.StringValue(a.Status) == aws.StringValue(b.Status) &&
+		(a.Filter == nil || a.Filter.And == nil && a.Filter.Tag == nil) &&
+		getPrefix(a) == getPrefix(b) && getDays(a) == getDays(b)
+}
+
+// getBucketSettingError wraps the error of reading or changing a bucket setting. Settings that
+// an S3-compatible store doesn't implement give ErrNotSupported.
+func getBucketSettingError(s3Config types.S3WorkspacePersistenceRemoteConfiguration, setting string, err error) error {
+	if err == nil {
+		return nil
+	}
+	if hasErrorCode(err, "NotImplemented", "XNotImplemented") {
+		return ErrNotSupported
+	}
+	return fmt.Errorf("failed to set the %s of s3://%s, %v", setting, s3Config.BucketName, err)
+}
+
+func hasErrorCode(err error, codes ...string) bool {
+	aerr, ok := err.(awserr.Error)
+	if !ok {
+		return false
+	}
+	for _, code := range codes {
+		if aerr.Code() == code {
+			return true
+		}
+	}
+	return false
+}
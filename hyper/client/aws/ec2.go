@@ -3,6 +3,7 @@ package aws
 import (
 	"context"
 	"encoding/base64"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"io/fs"
@@ -597,19 +598,23 @@ func IsStructureEmpty(i types.Instance) bool {
 	return reflect.DeepEqual(i, types.Instance{})
 }
 
-func StartJupyterEC2(manifestPath string, remoteCfg hyperdriveTypes.EC2ComputeRemoteConfiguration, ec2Type string, amiID string, jupyterLaunchOptions hyperdriveTypes.JupyterLaunchOptions, syncOptions hyperdriveTypes.WorkspaceSyncOptions) {
+// StartJupyterEC2 starts an instance running jupyter lab for the study, and returns its IP
+// address. Nothing is started, and an empty address returned, if the study already has one.
+func StartJupyterEC2(manifestPath string, remoteCfg hyperdriveTypes.EC2ComputeRemoteConfiguration, ec2Options hyperdriveTypes.EC2StartOptions, jupyterLaunchOptions hyperdriveTypes.JupyterLaunchOptions, syncOptions hyperdriveTypes.WorkspaceSyncOptions) string {
 	if isJupyterInstanceRunning(manifestPath, remoteCfg) {
-		return
+		return ""
 	}
+	reportInterruptedInstance(manifestPath, remoteCfg)
 
-	startupScript := getJupyterEc2StartScript(version, jupyterLaunchOptions, syncOptions, remoteCfg)
+	startupScript := getJupyterEc2StartScript(version, jupyterLaunchOptions, syncOptions, remoteCfg, ec2Options)
 
-	ip := StartServer(manifestPath, remoteCfg, ec2Type, amiID, startupScript, jupyterLaunchOptions.HostPort)
+	ip := StartServer(manifestPath, remoteCfg, ec2Options, startupScript, jupyterLaunchOptions.HostPort)
 
 	if ip != "" {
 		fmt.Println("In a few minutes, you should be able to access jupyter lab at http://" + ip + ":8888/lab")
 
 	}
+	return ip
 }
 
 func isJupyterInstanceRunning(manifestPath string, remoteCfg hyperdriveTypes.EC2ComputeRemoteConfiguration) bool {
@@ -631,10 +636,25 @@ If you want to change the instance size, stop the current running instance:
 		fmt.Println(message)
 		return true
 	}
+
+	pausedInstance, err := GetPausedInstanceForStudy(projectName, remoteCfg)
+	if err != nil {
+		fmt.Println(err)
+		return true
+	}
+	if !IsStructureEmpty(pausedInstance) {
+		fmt.Printf(`Hyper instance %s is paused.
+Resume it to pick up where you left off, or destroy it to start a new one:
+
+	hyper remote resume --remote=<REMOTE_PROFILE_NAME>
+	hyper remote destroy --remote=<REMOTE_PROFILE_NAME>
+`, *pausedInstance.InstanceId)
+		return true
+	}
 	return false
 }
-func StartHyperpackageEC2(manifestPath string, remoteCfg hyperdriveTypes.EC2ComputeRemoteConfiguration, ec2Type string, amiID string, syncOptions hyperdriveTypes.WorkspaceSyncOptions, dockerOptions hyperdriveTypes.DockerOptions) {
-	startupScript := getHyperpackageEC2StartScript(version, dockerOptions, syncOptions, remoteCfg)
+func StartHyperpackageEC2(manifestPath string, remoteCfg hyperdriveTypes.EC2ComputeRemoteConfiguration, ec2Options hyperdriveTypes.EC2StartOptions, syncOptions hyperdriveTypes.WorkspaceSyncOptions, dockerOptions hyperdriveTypes.DockerOptions, statusToken string) {
+	startupScript := getHyperpackageEC2StartScript(version, dockerOptions, syncOptions, remoteCfg, statusToken, IsSpot(remoteCfg, ec2Options))
 
 	var hostPort int
 	if dockerOptions.HostPort == -1 {
@@ -643,13 +663,15 @@ func StartHyperpackageEC2(manifestPath string, remoteCfg hyperdriveTypes.EC2Comp
 		hostPort = dockerOptions.HostPort
 	}
 
-	ip := StartServer(manifestPath, remoteCfg, ec2Type, amiID, startupScript, hostPort)
+	ip := StartServer(manifestPath, remoteCfg, ec2Options, startupScript, hostPort)
 
 	if ip != "" {
 		fmt.Println("Deploy completed, preditions avaliable at http://" + ip + ":" + strconv.Itoa(hostPort))
 	}
 }
-func StartServer(manifestPath string, remoteCfg hyperdriveTypes.EC2ComputeRemoteConfiguration, ec2Type string, amiID string, startupScript string, hostPort int) string {
+func StartServer(manifestPath string, remoteCfg hyperdriveTypes.EC2ComputeRemoteConfiguration, ec2Options hyperdriveTypes.EC2StartOptions, startupScript string, hostPort int) string {
+	ec2Type := ec2Options.InstanceType
+	amiID := ec2Options.AmiId
 
 	if ec2Type == "" {
 		fmt.Println("EC2InstanceTypeNotFound: please specify a EC2 instance type using the flag --ec2InstanceType")
@@ -665,6 +687,7 @@ func StartServer(manifestPath string, remoteCfg hyperdriveTypes.EC2ComputeRemote
 		return ""
 	}
 	fmt.Println("Project name is:", projectName)
+	removeKnownHosts(projectName)
 	client := GetEC2Client(remoteCfg)
 
 	vpcID, rtID := getOrCreateVPC(client, projectName)
@@ -693,6 +716,11 @@ func StartServer(manifestPath string, remoteCfg hyperdriveTypes.EC2ComputeRemote
 		TagSpecifications: getTagSpecification(projectName, types.ResourceTypeInstance),
 		UserData:          aws.String(base64.StdEncoding.EncodeToString([]byte(startupScript))),
 	}
+	if IsSpot(remoteCfg, ec2Options) {
+		ec2Input.InstanceMarketOptions = getSpotMarketOptions(remoteCfg, ec2Options)
+		fmt.Println("Requesting a spot instance")
+	}
+	ec2Input.InstanceInitiatedShutdownBehavior = getShutdownBehavior(remoteCfg, ec2Options)
 
 	result, err := MakeInstance(context.TODO(), client, ec2Input)
 	if err != nil {
@@ -729,7 +757,7 @@ func outputNotebookInfo(keyName string, ip string) {
 
 }
 
-func getJupyterEc2StartScript(version string, jupyterLaunchOptions hyperdriveTypes.JupyterLaunchOptions, syncOptions hyperdriveTypes.WorkspaceSyncOptions, remoteCfg hyperdriveTypes.EC2ComputeRemoteConfiguration) string {
+func getJupyterEc2StartScript(version string, jupyterLaunchOptions hyperdriveTypes.JupyterLaunchOptions, syncOptions hyperdriveTypes.WorkspaceSyncOptions, remoteCfg hyperdriveTypes.EC2ComputeRemoteConfiguration, ec2Options hyperdriveTypes.EC2StartOptions) string {
 
 	if syncOptions.S3Config.Profile != "" {
 
@@ -739,33 +767,49 @@ func getJupyterEc2StartScript(version string, jupyterLaunchOptions hyperdriveTyp
 		syncOptions.S3Config.Token = namedProfileConfig.Token
 	}
 
-	syncParameters := fmt.Sprintf("--s3AccessKey %s --s3Secret %s --s3Token %s --s3Region %s --s3BucketName %s -n %s", syncOptions.S3Config.AccessKey, syncOptions.S3Config.Secret, syncOptions.S3Config.Token, syncOptions.S3Config.Region, syncOptions.S3Config.BucketName, syncOptions.StudyName)
+	endpointParameters, endpointSetup := getS3EndpointParameters(syncOptions.S3Config, "s3")
+	encryptionParameters, encryptionSetup := getEncryptionParameters(syncOptions.Encryption, "encryption")
+	syncParameters := fmt.Sprintf("--s3AccessKey %s --s3Secret %s --s3Token %s --s3Region %s --s3BucketName %s -n %s%s%s", syncOptions.S3Config.AccessKey, syncOptions.S3Config.Secret, syncOptions.S3Config.Token, syncOptions.S3Config.Region, syncOptions.S3Config.BucketName, syncOptions.StudyName, endpointParameters, encryptionParameters)
 	syncCommand := fmt.Sprintf("hyper workspace sync %s -w", syncParameters)
+	finalSyncCommand := fmt.Sprintf("hyper workspace sync %s", syncParameters)
 	pullCommand := fmt.Sprintf("hyper workspace pull %s", syncParameters)
 	s3Parameters := fmt.Sprintf("--s3AccessKey %s --s3AccessSecret %s --s3Region %s", remoteCfg.AccessKey, remoteCfg.Secret, remoteCfg.Region)
+	statusSetup := getRemoteStatusSetup(jupyterLaunchOptions.StatusToken, syncOptions.StudyName)
+	idleSetup, idleCommand := getIdleShutdownSetup(remoteCfg, ec2Options, jupyterLaunchOptions, finalSyncCommand)
 
 	startupScript := fmt.Sprintf(`
 #!/bin/bash -xe
 #yum update -y
 service docker start
-mkdir -p /tmp/hyperdrive/project
-curl -fsSL https://github.com/gohypergiant/hyperdrive/releases/download/%s/hyperdrive_%s_Linux_x86_64.tar.gz -o /tmp/hyperdrive/hyper.tar
+mkdir -p /tmp/hyperdrive `+PROJECT_PATH+`
+%s%scurl -fsSL https://github.com/gohypergiant/hyperdrive/releases/download/%s/hyperdrive_%s_Linux_x86_64.tar.gz -o /tmp/hyperdrive/hyper.tar
 tar -xvf /tmp/hyperdrive/hyper.tar -C /tmp/hyperdrive
 mv /tmp/hyperdrive/hyper /usr/bin/hyper
-hyper remoteStatus &
-sudo chown ec2-user:ec2-user /tmp/hyperdrive/project
-cd /tmp/hyperdrive/project
-sudo -u ec2-user %s
-sudo -u ec2-user nohup %s &
-chown -R ec2-user:ec2-user .
-hyper remoteStatus update "launching notebook"
+%s
+hyper_status "installed hyper" --phase provisioning
+%ssudo chown ec2-user:ec2-user `+PROJECT_PATH+`
+cd `+PROJECT_PATH+`
+hyper_status "pulling the workspace" --phase pulling-workspace
+%s %s
+%s nohup %s &
+%s%s%schown -R ec2-user:ec2-user .
+hyper_status "launching notebook" --phase launching-notebook
 sudo -u ec2-user bash -c 'hyper jupyter remoteHost --hostPort %d --apiKey %s %s &'
-`, version, version, pullCommand, syncCommand, jupyterLaunchOptions.HostPort, jupyterLaunchOptions.APIKey, s3Parameters)
+for attempt in $(seq 1 360); do
+  if curl -s -o /dev/null http://localhost:%d; then break; fi
+  sleep 5
+done
+if curl -s -o /dev/null http://localhost:%d; then
+  hyper_status "notebook ready" --phase ready
+else
+  hyper_status "the notebook did not start within 30 minutes" --phase failed
+fi
+`, endpointSetup, encryptionSetup, version, version, statusSetup, getResumeSetup(statusSetup, fmt.Sprintf("%s nohup %s &\n%s", EC2_USER_SUDO, syncCommand, idleCommand), jupyterLaunchOptions.HostPort), EC2_USER_SUDO, pullCommand, EC2_USER_SUDO, syncCommand, getSpotInterruptionSetup(IsSpot(remoteCfg, ec2Options), finalSyncCommand), idleSetup, idleCommand, jupyterLaunchOptions.HostPort, jupyterLaunchOptions.APIKey, s3Parameters, jupyterLaunchOptions.HostPort, jupyterLaunchOptions.HostPort)
 
 	return startupScript
 
 }
-func getHyperpackageEC2StartScript(version string, dockerOptions hyperdriveTypes.DockerOptions, syncOptions hyperdriveTypes.WorkspaceSyncOptions, remoteCfg hyperdriveTypes.EC2ComputeRemoteConfiguration) string {
+func getHyperpackageEC2StartScript(version string, dockerOptions hyperdriveTypes.DockerOptions, syncOptions hyperdriveTypes.WorkspaceSyncOptions, remoteCfg hyperdriveTypes.EC2ComputeRemoteConfiguration, statusToken string, spot bool) string {
 	var hostPort int
 
 	if syncOptions.S3Config.Profile != "" {
@@ -782,26 +826,124 @@ func getHyperpackageEC2StartScript(version string, dockerOptions hyperdriveTypes
 		hostPort = dockerOptions.HostPort
 	}
 
-	syncParameters := fmt.Sprintf("--workspaceS3AccessKey %s --sworkspaceS3Secret %s --workspaceS3Token %s --workspaceS3Region %s --workspaceS3BucketName %s -n %s", syncOptions.S3Config.AccessKey, syncOptions.S3Config.Secret, syncOptions.S3Config.Token, syncOptions.S3Config.Region, syncOptions.S3Config.BucketName, syncOptions.StudyName)
+	endpointParameters, endpointSetup := getS3EndpointParameters(syncOptions.S3Config, "workspaceS3")
+	encryptionParameters, encryptionSetup := getEncryptionParameters(syncOptions.Encryption, "workspaceEncryption")
+	syncParameters := fmt.Sprintf("--workspaceS3AccessKey %s --workspaceS3Secret %s --workspaceS3Token %s --workspaceS3Region %s --workspaceS3BucketName %s -n %s%s%s", syncOptions.S3Config.AccessKey, syncOptions.S3Config.Secret, syncOptions.S3Config.Token, syncOptions.S3Config.Region, syncOptions.S3Config.BucketName, syncOptions.StudyName, endpointParameters, encryptionParameters)
 	runParameters := fmt.Sprintf("--hyperpackagePath %s.hyperpack.zip --hostPort %d --localOnly=false %s", syncOptions.StudyName, hostPort, syncParameters)
+	statusSetup := getRemoteStatusSetup(statusToken, syncOptions.StudyName)
 	startupScript := fmt.Sprintf(`
 #!/bin/bash -xe
 #yum update -y
 service docker start
-mkdir -p /tmp/hyperdrive/project
-curl -fsSL https://github.com/gohypergiant/hyperdrive/releases/download/%s/hyperdrive_%s_Linux_x86_64.tar.gz -o /tmp/hyperdrive/hyper.tar
+mkdir -p /tmp/hyperdrive `+PROJECT_PATH+`
+%s%scurl -fsSL https://github.com/gohypergiant/hyperdrive/releases/download/%s/hyperdrive_%s_Linux_x86_64.tar.gz -o /tmp/hyperdrive/hyper.tar
 tar -xvf /tmp/hyperdrive/hyper.tar -C /tmp/hyperdrive
 mv /tmp/hyperdrive/hyper /usr/bin/hyper
-hyper remoteStatus &
-sudo chown ec2-user:ec2-user /tmp/hyperdrive/project
-cd /tmp/hyperdrive/project
-chown -R ec2-user:ec2-user .
-hyper remoteStatus update "launching hyperpackage"
-sudo -u ec2-user bash -c 'hyper pack run %s &'
-`, version, version, runParameters)
+%s
+hyper_status "installed hyper" --phase provisioning
+%ssudo chown ec2-user:ec2-user `+PROJECT_PATH+`
+cd `+PROJECT_PATH+`
+%schown -R ec2-user:ec2-user .
+hyper_status "launching hyperpackage" --phase launching-notebook
+%s bash -c 'hyper pack run %s &'
+`, endpointSetup, encryptionSetup, version, version, statusSetup, getResumeSetup(statusSetup, "", hostPort), getSpotInterruptionSetup(spot, ""), EC2_USER_SUDO, runParameters)
 
 	return startupScript
 }
+// STATE_PATH is where instances keep the state that has to outlive a reboot, as they are paused
+// and resumed. Files in /tmp are cleaned up as the instance boots, and periodically.
+const STATE_PATH = "/var/lib/hyperdrive"
+
+// PROJECT_PATH is the directory instances sync their workspace to
+const PROJECT_PATH = STATE_PATH + "/project"
+
+// STATUS_FINGERPRINT_PATH is where instances write the fingerprint of the certificate of their
+// status endpoint
+const STATUS_FINGERPRINT_PATH = STATE_PATH + "/status.fingerprint"
+
+// NOTIFICATIONS_PATH is where instances keep the notification sinks of the config they were
+// started with
+const NOTIFICATIONS_PATH = STATE_PATH + "/notifications.json"
+
+// getRemoteStatusSetup returns the script that starts the status endpoint of the instance over
+// TLS, requiring the token if it isn't empty, and defines hyper_status to update it. Updates are
+// made from the directory the endpoint was started in, as the status file is relative to it, and
+// never stop the script. A failing step marks the instance as failed. The notification sinks of
+// the config are written to the instance, to be notified of its phases.
+func getRemoteStatusSetup(statusToken string, studyName string) string {
+	notificationsSetup := ""
+	if sinks := config2.GetNotificationSinks(); len(sinks) > 0 {
+		notifications, err := json.Marshal(hyperdriveTypes.NotificationsConfiguration{Source: studyName, Sinks: sinks})
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+		notificationsSetup = fmt.Sprintf("echo %s | base64 -d > %s\nchmod 600 %s\n", base64.StdEncoding.EncodeToString(notifications), NOTIFICATIONS_PATH, NOTIFICATIONS_PATH)
+	}
+	return fmt.Sprintf(`%s(cd / && HYPER_STATUS_TOKEN='%s' hyper remoteStatus --tls --tlsFingerprintFile %s --workspace %s) &
+hyper_status() { (cd / && hyper remoteStatus update --notificationsFile %s "$@") || true; }
+trap 'hyper_status "the startup script failed at line $LINENO" --phase failed' ERR`, notificationsSetup, statusToken, STATUS_FINGERPRINT_PATH, PROJECT_PATH, NOTIFICATIONS_PATH)
+}
+
+// getS3EndpointParameters returns the flags that point the instance's hyper commands at an
+// S3-compatible workspace store, and the script that installs its CA bundle on the instance
+func getS3EndpointParameters(s3Config hyperdriveTypes.S3WorkspacePersistenceRemoteConfiguration, flagPrefix string) (string, string) {
+	if s3Config.Endpoint == "" {
+		return "", ""
+	}
+	parameters := fmt.Sprintf(" --%sEndpoint %s --%sPathStyle=%t", flagPrefix, s3Config.Endpoint, flagPrefix, s3Config.ForcePathStyle)
+	if s3Config.CABundle == "" {
+		return parameters, ""
+	}
+	caBundle, err := os.ReadFile(s3Config.CABundle)
+	if err != nil {
+		fmt.Println("Could not read the CA bundle: ", err)
+		os.Exit(1)
+	}
+	const caBundlePath = STATE_PATH + "/s3-ca.pem"
+	parameters += fmt.Sprintf(" --%sCABundle %s", flagPrefix, caBundlePath)
+	setup := fmt.Sprintf("cat > %s <<'HYPER_CA_BUNDLE'\n%s\nHYPER_CA_BUNDLE\nchmod 644 %s\n", caBundlePath, strings.TrimSpace(string(caBundle)), caBundlePath)
+	return parameters, setup
+}
+
+// WORKSPACE_PASSPHRASE_PATH is where instances keep the passphrase of an encrypted workspace
+const WORKSPACE_PASSPHRASE_PATH = STATE_PATH + "/workspace.passphrase"
+
+// EC2_USER_SUDO runs a command as ec2-user, keeping the workspace passphrase in its environment
+const EC2_USER_SUDO = "sudo -u ec2-user --preserve-env=HYPER_WORKSPACE_PASSPHRASE"
+
+// exportWorkspacePassphrase exports the passphrase of an encrypted workspace, if the instance has
+// one, for the hyper commands to read it from their environment rather than their arguments,
+// which any user of the instance can list
+const exportWorkspacePassphrase = "if [ -f " + WORKSPACE_PASSPHRASE_PATH + " ]; then IFS= read -r HYPER_WORKSPACE_PASSPHRASE < " + WORKSPACE_PASSPHRASE_PATH + "; export HYPER_WORKSPACE_PASSPHRASE; fi\n"
+
+// getEncryptionParameters returns the flags that give the instance's hyper commands the key of an
+// encrypted workspace, and the script that writes the key or passphrase to a file only ec2-user
+// can read. The passphrase is exported rather than passed as a flag.
+func getEncryptionParameters(encryptionConfig hyperdriveTypes.WorkspaceEncryptionConfiguration, flagPrefix string) (string, string) {
+	var secret, path, parameters string
+	if encryptionConfig.KeyFile != "" {
+		key, err := os.ReadFile(encryptionConfig.KeyFile)
+		if err != nil {
+			fmt.Println("Could not read the workspace key: ", err)
+			os.Exit(1)
+		}
+		secret = strings.TrimSpace(string(key))
+		path = STATE_PATH + "/workspace.key"
+		parameters = fmt.Sprintf(" --%sKeyFile %s", flagPrefix, path)
+	} else if encryptionConfig.Passphrase != "" {
+		secret = encryptionConfig.Passphrase
+		path = WORKSPACE_PASSPHRASE_PATH
+	} else {
+		return "", ""
+	}
+	setup := fmt.Sprintf("(umask 077 && cat > %s <<'HYPER_WORKSPACE_SECRET'\n%s\nHYPER_WORKSPACE_SECRET\n)\nchown ec2-user:ec2-user %s\n", path, secret, path)
+	if path == WORKSPACE_PASSPHRASE_PATH {
+		setup += exportWorkspacePassphrase
+	}
+	return parameters, setup
+}
+
 func getInstanceIpAddress(instanceId string, remoteCfg hyperdriveTypes.EC2ComputeRemoteConfiguration) (*string, error) {
 
 	instances, err := GetHyperdriveInstances(remoteCfg)
@@ -825,6 +967,7 @@ func StopServer(manifestPath string, remoteCfg hyperdriveTypes.EC2ComputeRemoteC
 		fmt.Println("ProjectNameNotFound: please specify a project_name on the manifest (", manifestPath, ")")
 		return
 	}
+	removeKnownHosts(projectName)
 
 	client := GetEC2Client(remoteCfg)
 
@@ -848,8 +991,8 @@ func StopServer(manifestPath string, remoteCfg hyperdriveTypes.EC2ComputeRemoteC
 				Values: []string{vpcID},
 			},
 			{
-				Name:   aws.String("instance-state-code"),
-				Values: []string{"16"},
+				Name:   aws.String("instance-state-name"),
+				Values: []string{"pending", "running", "stopping", "stopped"},
 			},
 		},
 	}
@@ -1073,6 +1216,33 @@ func deleteSubnet(subnetID string, err error, client *ec2.Client) {
 	fmt.Println("Subnet deleted:", subnetID)
 }
 
+// GetPrivateKeyPath returns the path of the private key the project's instances were started
+// with, or an empty path if it isn't in ~/.ssh and is left to the ssh agent
+func GetPrivateKeyPath(projectName string) string {
+	sshFolderPath := path.Join(UserHomeDir(), "/.ssh")
+	for _, keyName := range []string{projectName, ssh.DEFAULT_KEY} {
+		privateKeyPath := path.Join(sshFolderPath, keyName)
+		if _, err := os.Stat(privateKeyPath); err == nil {
+			return privateKeyPath
+		}
+	}
+	return ""
+}
+
+// GetKnownHostsPath returns the path of the file that keeps the host key of the project's instance,
+// next to its private key
+func GetKnownHostsPath(projectName string) string {
+	return path.Join(UserHomeDir(), ".ssh", projectName+".known_hosts")
+}
+
+// removeKnownHosts forgets the host key of the project's instance, as the next instance has
+// another one
+func removeKnownHosts(projectName string) {
+	if err := os.Remove(GetKnownHostsPath(projectName)); err != nil && !os.IsNotExist(err) {
+		fmt.Println("Could not remove the known hosts of the instance: ", err)
+	}
+}
+
 func WriteFileToEC2(instanceIp string, remoteCfg hyperdriveTypes.EC2ComputeRemoteConfiguration, projectName string, filePath string) {
 
 	keyName := projectName
@@ -16,6 +16,12 @@ func MakeInstance(c context.Context, api types.EC2CreateInstanceAPI, input *ec2.
 func DeleteInstances(c context.Context, api types.TerminateInstancesAPI, input *ec2.TerminateInstancesInput) (*ec2.TerminateInstancesOutput, error) {
 	return api.TerminateInstances(c, input)
 }
+func StopInstances(c context.Context, api types.StopInstancesAPI, input *ec2.StopInstancesInput) (*ec2.StopInstancesOutput, error) {
+	return api.StopInstances(c, input)
+}
+func StartInstances(c context.Context, api types.StartInstancesAPI, input *ec2.StartInstancesInput) (*ec2.StartInstancesOutput, error) {
+	return api.StartInstances(c, input)
+}
 func GetSubnets(c context.Context, api types.DescribeSubnetsAPI, input *ec2.DescribeSubnetsInput) (*ec2.DescribeSubnetsOutput, error) {
 	return api.DescribeSubnets(c, input)
 }
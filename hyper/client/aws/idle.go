@@ -0,0 +1,43 @@
+package aws
+
+import (
+	"encoding/base64"
+	"fmt"
+
+	"github.com/aws/aws-sdk-go-v2/service/ec2/types"
+	hyperdriveTypes "github.com/gohypergiant/hyperdrive/hyper/types"
+)
+
+// SYNC_SCRIPT_PATH is where instances keep the script that syncs their workspace before they
+// shut down when idle
+const SYNC_SCRIPT_PATH = STATE_PATH + "/sync.sh"
+
+// GetIdleAction returns what the instance does once idle. Spot instances are terminated when
+// they shut down, so they are never stopped.
+func GetIdleAction(remoteCfg hyperdriveTypes.EC2ComputeRemoteConfiguration, ec2Options hyperdriveTypes.EC2StartOptions) hyperdriveTypes.IdleAction {
+	if IsSpot(remoteCfg, ec2Options) || ec2Options.IdleAction == hyperdriveTypes.IdleTerminate {
+		return hyperdriveTypes.IdleTerminate
+	}
+	return hyperdriveTypes.IdleStop
+}
+
+// getShutdownBehavior returns what EC2 does with the instance as it shuts itself down, empty to
+// leave the default, which is to stop it
+func getShutdownBehavior(remoteCfg hyperdriveTypes.EC2ComputeRemoteConfiguration, ec2Options hyperdriveTypes.EC2StartOptions) types.ShutdownBehavior {
+	if ec2Options.IdleTimeout > 0 && GetIdleAction(remoteCfg, ec2Options) == hyperdriveTypes.IdleTerminate {
+		return types.ShutdownBehaviorTerminate
+	}
+	return ""
+}
+
+// getIdleShutdownSetup returns the script that writes the sync script of the instance, and the
+// command that starts watching its notebook for activity. Both are empty without an idle timeout.
+func getIdleShutdownSetup(remoteCfg hyperdriveTypes.EC2ComputeRemoteConfiguration, ec2Options hyperdriveTypes.EC2StartOptions, jupyterLaunchOptions hyperdriveTypes.JupyterLaunchOptions, syncCommand string) (string, string) {
+	if ec2Options.IdleTimeout <= 0 {
+		return "", ""
+	}
+	syncScript := fmt.Sprintf("#!/bin/bash\n%scd %s && %s %s\n", exportWorkspacePassphrase, PROJECT_PATH, EC2_USER_SUDO, syncCommand)
+	setup := fmt.Sprintf("(umask 077 && echo %s | base64 -d > %s)\nchmod 700 %s\n", base64.StdEncoding.EncodeToString([]byte(syncScript)), SYNC_SCRIPT_PATH, SYNC_SCRIPT_PATH)
+	command := fmt.Sprintf("(cd / && hyper remoteStatus idleShutdown --idleTimeout %s --idleAction %s --jupyterUrl http://localhost:%d --jupyterToken '%s' --syncScript %s --notificationsFile %s) &\n", ec2Options.IdleTimeout, GetIdleAction(remoteCfg, ec2Options), jupyterLaunchOptions.HostPort, jupyterLaunchOptions.APIKey, SYNC_SCRIPT_PATH, NOTIFICATIONS_PATH)
+	return setup, command
+}
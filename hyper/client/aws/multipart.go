@@ -0,0 +1,227 @@
+package aws
+
+import (
+	"bytes"
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/s3/s3manager"
+	"github.com/gohypergiant/hyperdrive/hyper/client/transfer"
+	"github.com/gohypergiant/hyperdrive/hyper/types"
+)
+
+const mib = 1024 * 1024
+
+// pendingUpload is a multipart upload of a key that was started and never completed, with the
+// MD5 of each part uploaded so far
+type pendingUpload struct {
+	UploadId string
+	PartSize int64
+	Parts    map[int64]string
+}
+
+// uploadMultipart uploads a file in parts, up to the number of parallel transfers at once. If an
+// earlier upload of the key was interrupted it is resumed: its parts that match the file are
+// kept and only the others are uploaded. A failed upload is left in place to be resumed. Uploads
+// with metadata are never resumed, as the metadata of the earlier upload can't be checked.
+func uploadMultipart(s3Config types.S3WorkspacePersistenceRemoteConfiguration, f *os.File, size int64, key string, metadata map[string]string, transferSettings types.WorkspaceTransferSettings) error {
+	svc := getS3Client(s3Config)
+	upload := pendingUpload{}
+	if metadata == nil {
+		var err error
+		upload, err = findPendingUpload(s3Config, key)
+		if err != nil {
+			return err
+		}
+	}
+	if upload.UploadId != "" && upload.PartSize >= s3manager.MinUploadPartSize && getPartCount(size, upload.PartSize) <= s3manager.MaxUploadParts {
+		fmt.Printf("Resuming the upload of %s (%d parts uploaded)\n", key, len(upload.Parts))
+	} else {
+		result, err := svc.CreateMultipartUpload(&s3.CreateMultipartUploadInput{
+			Bucket:   aws.String(s3Config.BucketName),
+			Key:      aws.String(key),
+			Metadata: aws.StringMap(metadata),
+		})
+		if err != nil {
+			return err
+		}
+		upload = pendingUpload{
+			UploadId: aws.StringValue(result.UploadId),
+			PartSize: GetPartSize(size, transferSettings.MultipartChunkSize),
+			Parts:    map[int64]string{},
+		}
+	}
+
+	partCount := getPartCount(size, upload.PartSize)
+	completed := make([]*s3.CompletedPart, partCount)
+	partNumbers := make(chan int64)
+	var wg sync.WaitGroup
+	var errMu sync.Mutex
+	var uploadErr error
+	failed := func() bool {
+		errMu.Lock()
+		defer errMu.Unlock()
+		return uploadErr != nil
+	}
+	for i := 0; i < transferSettings.Parallel; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for partNumber := range partNumbers {
+				etag, err := uploadPart(s3Config, f, size, key, upload, partNumber)
+				if err != nil {
+					errMu.Lock()
+					if uploadErr == nil {
+						uploadErr = fmt.Errorf("part %d failed, the upload will be resumed next time, %v", partNumber, err)
+					}
+					errMu.Unlock()
+					continue
+				}
+				completed[partNumber-1] = &s3.CompletedPart{ETag: aws.String(etag), PartNumber: aws.Int64(partNumber)}
+			}
+		}()
+	}
+	for partNumber := int64(1); partNumber <= partCount && !failed(); partNumber++ {
+		partNumbers <- partNumber
+	}
+	close(partNumbers)
+	wg.Wait()
+	if uploadErr != nil {
+		return uploadErr
+	}
+
+	_, err := svc.CompleteMultipartUpload(&s3.CompleteMultipartUploadInput{
+		Bucket:          aws.String(s3Config.BucketName),
+		Key:             aws.String(key),
+		UploadId:        aws.String(upload.UploadId),
+		MultipartUpload: &s3.CompletedMultipartUpload{Parts: completed},
+	})
+	return err
+}
+
+// uploadPart uploads one part of a file unless the pending upload already has it, and returns
+// the part's ETag. A failed part isn't retried here: the whole upload is retried, resuming with
+// the parts that made it.
+func uploadPart(s3Config types.S3WorkspacePersistenceRemoteConfiguration, f *os.File, size int64, key string, upload pendingUpload, partNumber int64) (string, error) {
+	offset := (partNumber - 1) * upload.PartSize
+	length := upload.PartSize
+	if offset+length > size {
+		length = size - offset
+	}
+	part := make([]byte, length)
+	if _, err := f.ReadAt(part, offset); err != nil && err != io.EOF {
+		return "", err
+	}
+	sum := md5.Sum(part)
+	etag := hex.EncodeToString(sum[:])
+	if upload.Parts[partNumber] == etag {
+		return etag, nil
+	}
+	body := bytes.NewReader(part)
+	contentHashes, err := getContentHashes(body)
+	if err != nil {
+		return "", err
+	}
+	_, err = getS3Client(s3Config).UploadPartWithContext(aws.BackgroundContext(), &s3.UploadPartInput{
+		Bucket:        aws.String(s3Config.BucketName),
+		Key:           aws.String(key),
+		UploadId:      aws.String(upload.UploadId),
+		PartNumber:    aws.Int64(partNumber),
+		ContentLength: aws.Int64(length),
+		Body:          transfer.ReadSeeker(body),
+	}, contentHashes)
+	return etag, err
+}
+
+// findPendingUpload returns the most recently started multipart upload of a key that was never
+// completed, or an empty upload if there is none. Its part size is that of its largest part,
+// which all parts but the last have.
+func findPendingUpload(s3Config types.S3WorkspacePersistenceRemoteConfiguration, key string) (pendingUpload, error) {
+	svc := getS3Client(s3Config)
+	var latest *s3.MultipartUpload
+	err := svc.ListMultipartUploadsPages(&s3.ListMultipartUploadsInput{
+		Bucket: aws.String(s3Config.BucketName),
+		Prefix: aws.String(key),
+	}, func(page *s3.ListMultipartUploadsOutput, lastPage bool) bool {
+		for _, upload := range page.Uploads {
+			if aws.StringValue(upload.Key) != key {
+				continue
+			}
+			if latest == nil || aws.TimeValue(upload.Initiated).After(aws.TimeValue(latest.Initiated)) {
+				latest = upload
+			}
+		}
+		return true
+	})
+	if err != nil {
+		return pendingUpload{}, fmt.Errorf("failed to list the uploads of s3://%s/%s, %v", s3Config.BucketName, key, err)
+	}
+	if latest == nil {
+		return pendingUpload{}, nil
+	}
+
+	upload := pendingUpload{UploadId: aws.StringValue(latest.UploadId), Parts: map[int64]string{}}
+	err = svc.ListPartsPages(&s3.ListPartsInput{
+		Bucket:   aws.String(s3Config.BucketName),
+		Key:      aws.String(key),
+		UploadId: latest.UploadId,
+	}, func(page *s3.ListPartsOutput, lastPage bool) bool {
+		for _, part := range page.Parts {
+			upload.Parts[aws.Int64Value(part.PartNumber)] = strings.Trim(aws.StringValue(part.ETag), "\"")
+			if aws.Int64Value(part.Size) > upload.PartSize {
+				upload.PartSize = aws.Int64Value(part.Size)
+			}
+		}
+		return true
+	})
+	if err != nil {
+		return pendingUpload{}, fmt.Errorf("failed to list the uploaded parts of s3://%s/%s, %v", s3Config.BucketName, key, err)
+	}
+	return upload, nil
+}
+
+// GetPartSize returns the part size to upload a file with: the chunk size, raised to the
+// minimum part size S3 accepts, or to the smallest whole MiB that keeps within its part limit
+func GetPartSize(size int64, chunkSize int64) int64 {
+	if chunkSize < s3manager.MinUploadPartSize {
+		chunkSize = s3manager.MinUploadPartSize
+	}
+	if getPartCount(size, chunkSize) > s3manager.MaxUploadParts {
+		chunkSize = ((size/s3manager.MaxUploadParts)/mib + 1) * mib
+	}
+	return chunkSize
+}
+
+func getPartCount(size int64, partSize int64) int64 {
+	return (size + partSize - 1) / partSize
+}
+
+// getContentHashes hashes a request body up front and returns the option that sets its hashes
+// on the request, as the SDK would otherwise read the body once more for each of them, counting
+// against the bandwidth limit. The body is rewound.
+func getContentHashes(body io.ReadSeeker) (request.Option, error) {
+	md5Hash := md5.New()
+	sha256Hash := sha256.New()
+	if _, err := io.Copy(io.MultiWriter(md5Hash, sha256Hash), body); err != nil {
+		return nil, err
+	}
+	if _, err := body.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+	contentMD5 := base64.StdEncoding.EncodeToString(md5Hash.Sum(nil))
+	contentSHA256 := hex.EncodeToString(sha256Hash.Sum(nil))
+	return func(r *request.Request) {
+		r.HTTPRequest.Header.Set("Content-Md5", contentMD5)
+		r.HTTPRequest.Header.Set("X-Amz-Content-Sha256", contentSHA256)
+	}, nil
+}
@@ -0,0 +1,114 @@
+package aws
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ec2"
+	"github.com/aws/aws-sdk-go-v2/service/ec2/types"
+	hyperdriveTypes "github.com/gohypergiant/hyperdrive/hyper/types"
+)
+
+// RESUME_SCRIPT_PATH is where instances keep the script that restarts their services as they are
+// resumed. cloud-init runs the per-boot scripts on every boot, the startup script only on the first.
+const RESUME_SCRIPT_PATH = "/var/lib/cloud/scripts/per-boot/hyperdrive-resume.sh"
+
+// instanceStateTimeout caps how long to wait for an instance to stop or start
+const instanceStateTimeout = 10 * time.Minute
+
+// GetPausedInstanceForStudy returns the stopped, or stopping, instance of the study, or an empty
+// instance if it has none
+func GetPausedInstanceForStudy(studyName string, remoteCfg hyperdriveTypes.EC2ComputeRemoteConfiguration) (types.Instance, error) {
+	client := GetEC2Client(remoteCfg)
+	result, err := GetInstances(context.TODO(), client, &ec2.DescribeInstancesInput{
+		Filters: []types.Filter{
+			{Name: aws.String("tag:" + HYPERDRIVE_NAME_TAG), Values: []string{studyName}},
+			{Name: aws.String("instance-state-name"), Values: []string{"stopping", "stopped"}},
+		},
+	})
+	if err != nil {
+		return types.Instance{}, err
+	}
+	for _, r := range result.Reservations {
+		for _, i := range r.Instances {
+			if IsHyperdriveInstance(i) {
+				return i, nil
+			}
+		}
+	}
+	return types.Instance{}, nil
+}
+
+// PauseInstance stops the instance and waits until it is stopped. Its disk, key pair and network
+// are kept. Spot instances are terminated when stopped, so they can't be paused.
+func PauseInstance(instance types.Instance, remoteCfg hyperdriveTypes.EC2ComputeRemoteConfiguration) error {
+	if instance.InstanceLifecycle == types.InstanceLifecycleTypeSpot {
+		return fmt.Errorf("%s is a spot instance, which can't be paused", *instance.InstanceId)
+	}
+	client := GetEC2Client(remoteCfg)
+	_, err := StopInstances(context.TODO(), client, &ec2.StopInstancesInput{
+		InstanceIds: []string{*instance.InstanceId},
+	})
+	if err != nil {
+		return err
+	}
+	waiter := ec2.NewInstanceStoppedWaiter(client)
+	return waiter.Wait(context.TODO(), &ec2.DescribeInstancesInput{InstanceIds: []string{*instance.InstanceId}}, instanceStateTimeout)
+}
+
+// ResumeInstance starts a paused instance and waits until it is running. Its public IP address
+// is returned, which changes as the instance is stopped and started.
+func ResumeInstance(instanceId string, remoteCfg hyperdriveTypes.EC2ComputeRemoteConfiguration) (string, error) {
+	client := GetEC2Client(remoteCfg)
+	_, err := StartInstances(context.TODO(), client, &ec2.StartInstancesInput{
+		InstanceIds: []string{instanceId},
+	})
+	if err != nil {
+		return "", err
+	}
+	waiter := ec2.NewInstanceRunningWaiter(client)
+	_, err = waiter.WaitForOutput(context.TODO(), &ec2.DescribeInstancesInput{InstanceIds: []string{instanceId}}, instanceStateTimeout)
+	if err != nil {
+		return "", err
+	}
+	ip, err := getInstanceIpAddress(instanceId, remoteCfg)
+	if err != nil {
+		return "", err
+	}
+	if ip == nil {
+		return "", fmt.Errorf("the instance %s has no public IP address", instanceId)
+	}
+	return *ip, nil
+}
+
+// GetStatusUpdateCommand returns the command that updates the status of an instance over ssh,
+// the same way its startup script does
+func GetStatusUpdateCommand(message string, phase hyperdriveTypes.RemoteStatusPhase) string {
+	return fmt.Sprintf("sudo sh -c 'cd / && hyper remoteStatus update --notificationsFile %s \"%s\" --phase %s'", NOTIFICATIONS_PATH, message, phase)
+}
+
+// getResumeSetup returns the script that installs the resume script of the instance. As it is
+// resumed, the instance starts docker and the containers that were running, the status endpoint
+// and the services, then reports that it is ready once the host port answers.
+func getResumeSetup(statusSetup string, services string, hostPort int) string {
+	resumeScript := fmt.Sprintf(`#!/bin/bash -xe
+service docker start
+%s
+%shyper_status "resuming the instance" --phase launching-notebook
+docker ps -aq | xargs -r docker start || true
+cd `+PROJECT_PATH+`
+%sfor attempt in $(seq 1 120); do
+  if curl -s -o /dev/null http://localhost:%d; then break; fi
+  sleep 5
+done
+if curl -s -o /dev/null http://localhost:%d; then
+  hyper_status "resumed the instance" --phase ready
+else
+  hyper_status "the instance did not resume within 10 minutes" --phase failed
+fi
+`, statusSetup, exportWorkspacePassphrase, services, hostPort, hostPort)
+	return fmt.Sprintf("mkdir -p $(dirname %s)\necho %s | base64 -d > %s\nchmod 700 %s\n", RESUME_SCRIPT_PATH, base64.StdEncoding.EncodeToString([]byte(resumeScript)), RESUME_SCRIPT_PATH, RESUME_SCRIPT_PATH)
+}
@@ -1,40 +1,269 @@
 package aws
 
 import (
+	"bytes"
 	"fmt"
+	"io"
+	"net/url"
 	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
 
 	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
 	"github.com/aws/aws-sdk-go/aws/credentials"
 	"github.com/aws/aws-sdk-go/aws/session"
 	"github.com/aws/aws-sdk-go/service/s3"
 	"github.com/aws/aws-sdk-go/service/s3/s3manager"
+	"github.com/gohypergiant/hyperdrive/hyper/client/transfer"
 	config2 "github.com/gohypergiant/hyperdrive/hyper/services/config"
 	"github.com/gohypergiant/hyperdrive/hyper/types"
-	"github.com/seqsense/s3sync"
 )
 
-var sess *session.Session
-var syncManager *s3sync.Manager
+// UploadFile uploads a single file to the workspace bucket, with the metadata if it isn't nil, and
+// returns the uploaded object's info. Files of at least the multipart threshold are uploaded in
+// parts, resuming an interrupted upload.
+func UploadFile(s3Config types.S3WorkspacePersistenceRemoteConfiguration, filename string, key string, metadata map[string]string) (types.ObjectInfo, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return types.ObjectInfo{}, err
+	}
+	defer f.Close()
+	stat, err := f.Stat()
+	if err != nil {
+		return types.ObjectInfo{}, err
+	}
+	transferSettings := transfer.GetSettings()
+	if stat.Size() >= transferSettings.MultipartThreshold {
+		err = uploadMultipart(s3Config, f, stat.Size(), key, metadata, transferSettings)
+	} else {
+		err = putObject(s3Config, key, f, metadata)
+	}
+	if err != nil {
+		return types.ObjectInfo{}, fmt.Errorf("failed to upload %s, %v", filename, err)
+	}
+	return GetObjectInfo(s3Config, key)
+}
 
-func SyncDirectory(s3Config types.S3WorkspacePersistenceRemoteConfiguration, srcPath string, destPath string) {
-	syncManager := GetSyncManger(s3Config)
-	err := syncManager.Sync(srcPath, destPath)
+func putObject(s3Config types.S3WorkspacePersistenceRemoteConfiguration, key string, body io.ReadSeeker, metadata map[string]string) error {
+	contentHashes, err := getContentHashes(body)
 	if err != nil {
-		fmt.Println(err)
-		//os.Exit(1)
+		return err
+	}
+	_, err = getS3Client(s3Config).PutObjectWithContext(aws.BackgroundContext(), &s3.PutObjectInput{
+		Bucket:   aws.String(s3Config.BucketName),
+		Key:      aws.String(key),
+		Body:     transfer.ReadSeeker(body),
+		Metadata: aws.StringMap(metadata),
+	}, contentHashes)
+	return err
+}
+
+// DownloadFile downloads a single object of the workspace bucket, creating any missing parent
+// directories, and sets the file's modification time to the object's last modified time
+func DownloadFile(s3Config types.S3WorkspacePersistenceRemoteConfiguration, key string, filename string) error {
+	info, err := GetObjectInfo(s3Config, key)
+	if err != nil {
+		return err
+	}
+	err = os.MkdirAll(filepath.Dir(filename), os.ModePerm)
+	if err != nil {
+		return err
+	}
+	return downloadObject(s3Config, s3Config.BucketName, key, filename, info.LastModified)
+}
+
+// DeleteObject removes a single object from the workspace bucket
+func DeleteObject(s3Config types.S3WorkspacePersistenceRemoteConfiguration, key string) error {
+	svc := getS3Client(s3Config)
+	_, err := svc.DeleteObject(&s3.DeleteObjectInput{
+		Bucket: aws.String(s3Config.BucketName),
+		Key:    aws.String(key),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to delete s3://%s/%s, %v", s3Config.BucketName, key, err)
+	}
+	return nil
+}
+
+// ListObjects returns every object of the workspace bucket under the prefix
+func ListObjects(s3Config types.S3WorkspacePersistenceRemoteConfiguration, prefix string) ([]types.ObjectInfo, error) {
+	svc := getS3Client(s3Config)
+	objects := []types.ObjectInfo{}
+	err := svc.ListObjectsV2Pages(&s3.ListObjectsV2Input{
+		Bucket: aws.String(s3Config.BucketName),
+		Prefix: aws.String(prefix),
+	}, func(page *s3.ListObjectsV2Output, lastPage bool) bool {
+		for _, object := range page.Contents {
+			objects = append(objects, types.ObjectInfo{
+				Key:          aws.StringValue(object.Key),
+				Exists:       true,
+				Size:         aws.Int64Value(object.Size),
+				LastModified: aws.TimeValue(object.LastModified),
+				ETag:         strings.Trim(aws.StringValue(object.ETag), "\""),
+			})
+		}
+		return true
+	})
+	if hasErrorCode(err, s3.ErrCodeNoSuchBucket) {
+		return objects, fmt.Errorf("s3://%s doesn't exist, create it with `hyper workspace init`", s3Config.BucketName)
+	}
+	if err != nil {
+		return objects, fmt.Errorf("failed to list s3://%s/%s, %v", s3Config.BucketName, prefix, err)
+	}
+	return objects, nil
+}
+
+// GetObjectInfo returns the size, last modified time and metadata of an object in the workspace
+// bucket. Exists is false if there is no such object.
+func GetObjectInfo(s3Config types.S3WorkspacePersistenceRemoteConfiguration, key string) (types.ObjectInfo, error) {
+	svc := getS3Client(s3Config)
+	result, err := svc.HeadObject(&s3.HeadObjectInput{
+		Bucket: aws.String(s3Config.BucketName),
+		Key:    aws.String(key),
+	})
+	if err != nil {
+		if aerr, ok := err.(awserr.Error); ok && aerr.Code() == "NotFound" {
+			return types.ObjectInfo{Key: key}, nil
+		}
+		return types.ObjectInfo{}, fmt.Errorf("cannot access s3://%s/%s, %v", s3Config.BucketName, key, err)
+	}
+	return types.ObjectInfo{
+		Key:          key,
+		Exists:       true,
+		Size:         aws.Int64Value(result.ContentLength),
+		LastModified: aws.TimeValue(result.LastModified),
+		ETag:         strings.Trim(aws.StringValue(result.ETag), "\""),
+		Metadata:     aws.StringValueMap(result.Metadata),
+	}, nil
+}
+
+// GetObjectContent reads a whole object of the workspace bucket into memory
+func GetObjectContent(s3Config types.S3WorkspacePersistenceRemoteConfiguration, key string) ([]byte, error) {
+	buf := aws.NewWriteAtBuffer([]byte{})
+	_, err := s3manager.NewDownloaderWithClient(getS3Client(s3Config)).Download(buf, &s3.GetObjectInput{
+		Bucket: aws.String(s3Config.BucketName),
+		Key:    aws.String(key),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to read s3://%s/%s, %v", s3Config.BucketName, key, err)
 	}
+	return buf.Bytes(), nil
 }
-func GetSyncManger(s3Config types.S3WorkspacePersistenceRemoteConfiguration) *s3sync.Manager {
-	if syncManager == nil {
-		sess = getSession(s3Config)
-		syncManager = s3sync.New(sess, s3sync.WithDelete())
+
+// PutObjectContent writes an object of the workspace bucket from memory
+func PutObjectContent(s3Config types.S3WorkspacePersistenceRemoteConfiguration, key string, content []byte) error {
+	svc := getS3Client(s3Config)
+	_, err := svc.PutObject(&s3.PutObjectInput{
+		Bucket: aws.String(s3Config.BucketName),
+		Key:    aws.String(key),
+		Body:   bytes.NewReader(content),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to write s3://%s/%s, %v", s3Config.BucketName, key, err)
 	}
-	return syncManager
+	return nil
 }
 
+// CopyObject copies an object of the workspace bucket within the bucket. If versionId is set
+// that version of the source object is copied, otherwise its current version.
+func CopyObject(s3Config types.S3WorkspacePersistenceRemoteConfiguration, srcKey string, versionId string, dstKey string) (types.ObjectInfo, error) {
+	svc := getS3Client(s3Config)
+	segments := strings.Split(srcKey, "/")
+	for i, segment := range segments {
+		segments[i] = url.PathEscape(segment)
+	}
+	copySource := url.PathEscape(s3Config.BucketName) + "/" + strings.Join(segments, "/")
+	if versionId != "" {
+		copySource += "?versionId=" + url.QueryEscape(versionId)
+	}
+	_, err := svc.CopyObject(&s3.CopyObjectInput{
+		Bucket:     aws.String(s3Config.BucketName),
+		Key:        aws.String(dstKey),
+		CopySource: aws.String(copySource),
+	})
+	if err != nil {
+		return types.ObjectInfo{}, fmt.Errorf("failed to copy s3://%s/%s to %s, %v", s3Config.BucketName, srcKey, dstKey, err)
+	}
+	return GetObjectInfo(s3Config, dstKey)
+}
+
+// IsVersioningEnabled reports whether object versioning is enabled on the workspace bucket
+func IsVersioningEnabled(s3Config types.S3WorkspacePersistenceRemoteConfiguration) (bool, error) {
+	svc := getS3Client(s3Config)
+	result, err := svc.GetBucketVersioning(&s3.GetBucketVersioningInput{
+		Bucket: aws.String(s3Config.BucketName),
+	})
+	if err != nil {
+		return false, fmt.Errorf("failed to get the versioning of s3://%s, %v", s3Config.BucketName, err)
+	}
+	return aws.StringValue(result.Status) == s3.BucketVersioningStatusEnabled, nil
+}
+
+// ListCurrentObjectVersions returns every object of a versioned workspace bucket under the
+// prefix, with the id of its current version. Deleted objects are left out.
+func ListCurrentObjectVersions(s3Config types.S3WorkspacePersistenceRemoteConfiguration, prefix string) ([]types.ObjectInfo, error) {
+	svc := getS3Client(s3Config)
+	objects := []types.ObjectInfo{}
+	err := svc.ListObjectVersionsPages(&s3.ListObjectVersionsInput{
+		Bucket: aws.String(s3Config.BucketName),
+		Prefix: aws.String(prefix),
+	}, func(page *s3.ListObjectVersionsOutput, lastPage bool) bool {
+		// delete markers are listed separately, so a deleted object has no latest version here
+		for _, version := range page.Versions {
+			if !aws.BoolValue(version.IsLatest) {
+				continue
+			}
+			objects = append(objects, types.ObjectInfo{
+				Key:          aws.StringValue(version.Key),
+				Exists:       true,
+				Size:         aws.Int64Value(version.Size),
+				LastModified: aws.TimeValue(version.LastModified),
+				ETag:         strings.Trim(aws.StringValue(version.ETag), "\""),
+				VersionId:    aws.StringValue(version.VersionId),
+			})
+		}
+		return true
+	})
+	if err != nil {
+		return objects, fmt.Errorf("failed to list the versions of s3://%s/%s, %v", s3Config.BucketName, prefix, err)
+	}
+	return objects, nil
+}
+
+// sessions and clients are built once per configuration, as every transfer, and every part of a
+// multipart transfer, gets its client, and a custom CA bundle is read and parsed with the session
+var (
+	sessionsMu sync.Mutex
+	sessions   = map[types.S3WorkspacePersistenceRemoteConfiguration]*session.Session{}
+	clients    = map[types.S3WorkspacePersistenceRemoteConfiguration]*s3.S3{}
+)
+
+// getSession returns the session of the configuration, building it on first use
 func getSession(s3Config types.S3WorkspacePersistenceRemoteConfiguration) *session.Session {
-	awsConfig := aws.Config{Region: &s3Config.Region}
+	sessionsMu.Lock()
+	defer sessionsMu.Unlock()
+	return getSessionLocked(s3Config)
+}
+
+func getSessionLocked(s3Config types.S3WorkspacePersistenceRemoteConfiguration) *session.Session {
+	if sess, ok := sessions[s3Config]; ok {
+		return sess
+	}
+	sess := newSession(s3Config)
+	sessions[s3Config] = sess
+	return sess
+}
+
+func newSession(s3Config types.S3WorkspacePersistenceRemoteConfiguration) *session.Session {
+	region := s3Config.Region
+	if region == "" && s3Config.Endpoint != "" {
+		// S3-compatible stores mostly ignore the region, but requests still have to be signed for one
+		region = "us-east-1"
+	}
+	awsConfig := aws.Config{Region: &region}
 	accessKey := s3Config.AccessKey
 	secret := s3Config.Secret
 	token := s3Config.Token
@@ -46,7 +275,17 @@ func getSession(s3Config types.S3WorkspacePersistenceRemoteConfiguration) *sessi
 		token = namedProfileConfig.Token
 	}
 	creds := credentials.NewStaticCredentials(accessKey, secret, token)
-	sess, err := session.NewSession(awsConfig.WithCredentials(creds))
+	options := session.Options{Config: *awsConfig.WithCredentials(creds)}
+	if s3Config.CABundle != "" {
+		caBundle, err := os.Open(s3Config.CABundle)
+		if err != nil {
+			fmt.Println("Could not read the CA bundle: ", err)
+			os.Exit(1)
+		}
+		defer caBundle.Close()
+		options.CustomCABundle = caBundle
+	}
+	sess, err := session.NewSessionWithOptions(options)
 	if err != nil {
 		fmt.Println(err)
 		os.Exit(1)
@@ -54,24 +293,84 @@ func getSession(s3Config types.S3WorkspacePersistenceRemoteConfiguration) *sessi
 	return sess
 
 }
-func DownloadObject(s3Config types.S3WorkspacePersistenceRemoteConfiguration, filename string, key string) error {
-	sess = getSession(s3Config)
-	downloader := s3manager.NewDownloader(sess)
 
-	f, err := os.Create(filename)
-	if err != nil {
-		return fmt.Errorf("failed to create file %q, %v", filename, err)
+// getS3Client returns a client for the workspace bucket, which is on AWS S3 unless the
+// configuration has the endpoint of an S3-compatible store (e.g. MinIO or Ceph). Clients are safe
+// for concurrent use, so one is shared by every transfer with the configuration.
+func getS3Client(s3Config types.S3WorkspacePersistenceRemoteConfiguration) *s3.S3 {
+	sessionsMu.Lock()
+	defer sessionsMu.Unlock()
+	if svc, ok := clients[s3Config]; ok {
+		return svc
+	}
+	endpointConfig := aws.Config{}
+	if s3Config.Endpoint != "" {
+		endpointConfig.Endpoint = aws.String(s3Config.Endpoint)
 	}
+	if s3Config.ForcePathStyle {
+		endpointConfig.S3ForcePathStyle = aws.Bool(true)
+	}
+	svc := s3.New(getSessionLocked(s3Config), &endpointConfig)
+	clients[s3Config] = svc
+	return svc
+}
+func DownloadObject(s3Config types.S3WorkspacePersistenceRemoteConfiguration, filename string, key string) error {
+	return DownloadObjectFromBucket(s3Config, s3Config.BucketName, key, filename)
+}
+func DownloadObjectFromBucket(s3Config types.S3WorkspacePersistenceRemoteConfiguration, bucket string, key string, filename string) error {
+	return downloadObject(s3Config, bucket, key, filename, time.Time{})
+}
 
-	fmt.Println("Downloading " + key + " from bucket " + s3Config.BucketName)
-	_, err = downloader.Download(f,
-		&s3.GetObjectInput{
-			Bucket: aws.String(s3Config.BucketName),
-			Key:    aws.String(key),
-		})
+// downloadObject downloads an object in parts into a temporary file, which is renamed into place
+// with the modification time once complete
+func downloadObject(s3Config types.S3WorkspacePersistenceRemoteConfiguration, bucket string, key string, filename string, modTime time.Time) error {
+	transferSettings := transfer.GetSettings()
+	downloader := s3manager.NewDownloaderWithClient(getS3Client(s3Config), func(d *s3manager.Downloader) {
+		d.PartSize = transferSettings.MultipartChunkSize
+		d.Concurrency = transferSettings.Parallel
+	})
+
+	fmt.Println("Downloading " + key + " from bucket " + bucket)
+	err := transfer.WriteFileAtomic(filename, modTime, func(f *os.File) error {
+		_, err := downloader.Download(transfer.WriterAt(f),
+			&s3.GetObjectInput{
+				Bucket: aws.String(bucket),
+				Key:    aws.String(key),
+			})
+		return err
+	})
 
 	if err != nil {
 		return fmt.Errorf("failed to download file, %v", err)
 	}
 	return nil
 }
+
+// ParseS3Uri splits an s3://bucket/key URI into its bucket and key
+func ParseS3Uri(uri string) (string, string, error) {
+	parsed, err := url.Parse(uri)
+	if err != nil {
+		return "", "", err
+	}
+	if strings.ToLower(parsed.Scheme) != "s3" || parsed.Host == "" {
+		return "", "", fmt.Errorf("%q is not a valid s3 URI, expected s3://bucket/key", uri)
+	}
+	key := strings.TrimPrefix(parsed.Path, "/")
+	if key == "" {
+		return "", "", fmt.Errorf("%q does not reference an object", uri)
+	}
+	return parsed.Host, key, nil
+}
+
+// CheckObjectAccess verifies the object exists and is readable with the given credentials, returning its ETag
+func CheckObjectAccess(s3Config types.S3WorkspacePersistenceRemoteConfiguration, bucket string, key string) (string, error) {
+	svc := getS3Client(s3Config)
+	result, err := svc.HeadObject(&s3.HeadObjectInput{
+		Bucket: aws.String(bucket),
+		Key:    aws.String(key),
+	})
+	if err != nil {
+		return "", fmt.Errorf("cannot access s3://%s/%s, %v", bucket, key, err)
+	}
+	return strings.Trim(aws.StringValue(result.ETag), "\""), nil
+}
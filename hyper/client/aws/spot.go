@@ -0,0 +1,108 @@
+package aws
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ec2"
+	"github.com/aws/aws-sdk-go-v2/service/ec2/types"
+	"github.com/gohypergiant/hyperdrive/hyper/client/manifest"
+	hyperdriveTypes "github.com/gohypergiant/hyperdrive/hyper/types"
+)
+
+// SPOT_INTERRUPTION_REASON is the state reason of the instances EC2 terminated to reclaim their
+// spot capacity
+const SPOT_INTERRUPTION_REASON = "Server.SpotInstanceTermination"
+
+// spotPollInterval is how often instances check for an interruption notice, which is given two
+// minutes before the instance is reclaimed
+const spotPollInterval = 5
+
+// IsSpot reports whether the instance is started as a spot instance: as the start options say,
+// or as the remote does by default
+func IsSpot(remoteCfg hyperdriveTypes.EC2ComputeRemoteConfiguration, ec2Options hyperdriveTypes.EC2StartOptions) bool {
+	if ec2Options.Spot != nil {
+		return *ec2Options.Spot
+	}
+	return remoteCfg.Spot
+}
+
+// getSpotMarketOptions requests a one-time spot instance, that is terminated when interrupted.
+// Without a maximum price, the price is capped at the on-demand price.
+func getSpotMarketOptions(remoteCfg hyperdriveTypes.EC2ComputeRemoteConfiguration, ec2Options hyperdriveTypes.EC2StartOptions) *types.InstanceMarketOptionsRequest {
+	spotOptions := &types.SpotMarketOptions{
+		SpotInstanceType:             types.SpotInstanceTypeOneTime,
+		InstanceInterruptionBehavior: types.InstanceInterruptionBehaviorTerminate,
+	}
+	maxPrice := ec2Options.MaxPrice
+	if maxPrice == "" {
+		maxPrice = remoteCfg.MaxPrice
+	}
+	if maxPrice != "" {
+		spotOptions.MaxPrice = aws.String(maxPrice)
+	}
+	return &types.InstanceMarketOptionsRequest{
+		MarketType:  types.MarketTypeSpot,
+		SpotOptions: spotOptions,
+	}
+}
+
+// getSpotInterruptionSetup returns the script that watches the instance metadata for an
+// interruption notice. Once one is given, the workspace is synced with the sync command, if any,
+// and the instance reports that it is interrupted. Nothing is watched on on-demand instances.
+func getSpotInterruptionSetup(spot bool, syncCommand string) string {
+	if !spot {
+		return ""
+	}
+	syncSetup := `hyper_status "the spot instance is being interrupted" --phase interrupted`
+	if syncCommand != "" {
+		syncSetup = fmt.Sprintf(`hyper_status "received a spot interruption notice, syncing the workspace" --phase interrupted
+      if %s %s; then
+        hyper_status "the spot instance is being interrupted, the workspace was synced" --phase interrupted
+      else
+        hyper_status "the spot instance is being interrupted, the workspace could not be synced" --phase interrupted
+      fi`, EC2_USER_SUDO, syncCommand)
+	}
+	return fmt.Sprintf(`(
+  while true; do
+    imds_token=$(curl -s -X PUT http://169.254.169.254/latest/api/token -H 'X-aws-ec2-metadata-token-ttl-seconds: 300' || true)
+    if curl -sf -o /dev/null -H "X-aws-ec2-metadata-token: $imds_token" http://169.254.169.254/latest/meta-data/spot/instance-action; then
+      %s
+      break
+    fi
+    sleep %d
+  done
+) &
+`, syncSetup, spotPollInterval)
+}
+
+// reportInterruptedInstance tells whether the last instance of the study was an interrupted spot
+// instance, as the one being started restores the workspace that instance synced
+func reportInterruptedInstance(manifestPath string, remoteCfg hyperdriveTypes.EC2ComputeRemoteConfiguration) {
+	projectName := manifest.GetProjectName(manifestPath)
+	client := GetEC2Client(remoteCfg)
+	result, err := GetInstances(context.TODO(), client, &ec2.DescribeInstancesInput{
+		Filters: []types.Filter{
+			{Name: aws.String("tag:" + HYPERDRIVE_NAME_TAG), Values: []string{projectName}},
+			{Name: aws.String("state-reason-code"), Values: []string{SPOT_INTERRUPTION_REASON}},
+		},
+	})
+	if err != nil {
+		return
+	}
+	var interrupted *types.Instance
+	for _, r := range result.Reservations {
+		for i := range r.Instances {
+			instance := r.Instances[i]
+			if interrupted == nil || (instance.LaunchTime != nil && interrupted.LaunchTime != nil && instance.LaunchTime.After(*interrupted.LaunchTime)) {
+				interrupted = &instance
+			}
+		}
+	}
+	if interrupted == nil {
+		return
+	}
+	fmt.Printf("The spot instance %s of %s was interrupted, relaunching it.\n", *interrupted.InstanceId, projectName)
+	fmt.Println("The workspace synced before the interruption is restored as the new instance starts.")
+}
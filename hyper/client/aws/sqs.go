@@ -0,0 +1,71 @@
+package aws
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/sqs"
+	"github.com/gohypergiant/hyperdrive/hyper/types"
+)
+
+type s3EventNotification struct {
+	Records []struct {
+		EventName string `json:"eventName"`
+		S3        struct {
+			Bucket struct {
+				Name string `json:"name"`
+			} `json:"bucket"`
+			Object struct {
+				Key string `json:"key"`
+			} `json:"object"`
+		} `json:"s3"`
+	} `json:"Records"`
+}
+
+// ReceiveObjectEvents long polls an SQS queue that receives the workspace bucket's S3 event
+// notifications and returns the object changes it reported. Received messages are deleted
+// from the queue.
+func ReceiveObjectEvents(s3Config types.S3WorkspacePersistenceRemoteConfiguration, queueUrl string, waitSeconds int64) ([]types.ObjectEvent, error) {
+	svc := sqs.New(getSession(s3Config))
+	result, err := svc.ReceiveMessage(&sqs.ReceiveMessageInput{
+		QueueUrl:            aws.String(queueUrl),
+		MaxNumberOfMessages: aws.Int64(10),
+		WaitTimeSeconds:     aws.Int64(waitSeconds),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to receive events from %s, %v", queueUrl, err)
+	}
+
+	events := []types.ObjectEvent{}
+	for _, message := range result.Messages {
+		var notification s3EventNotification
+		// messages that aren't S3 event notifications (e.g. the s3:TestEvent) are dropped
+		if err := json.Unmarshal([]byte(aws.StringValue(message.Body)), &notification); err == nil {
+			for _, record := range notification.Records {
+				if record.S3.Bucket.Name != s3Config.BucketName {
+					continue
+				}
+				// keys in event notifications are URL encoded, with spaces as '+'
+				key, err := url.QueryUnescape(record.S3.Object.Key)
+				if err != nil {
+					continue
+				}
+				events = append(events, types.ObjectEvent{
+					Key:     key,
+					Removed: strings.HasPrefix(record.EventName, "ObjectRemoved"),
+				})
+			}
+		}
+		_, err := svc.DeleteMessage(&sqs.DeleteMessageInput{
+			QueueUrl:      aws.String(queueUrl),
+			ReceiptHandle: message.ReceiptHandle,
+		})
+		if err != nil {
+			return events, fmt.Errorf("failed to delete event from %s, %v", queueUrl, err)
+		}
+	}
+	return events, nil
+}
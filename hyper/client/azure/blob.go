@@ -0,0 +1,285 @@
+package azure
+
+import (
+	"context"
+	"crypto/md5"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/streaming"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/to"
+	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob/blob"
+	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob/bloberror"
+	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob/blockblob"
+	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob/container"
+	"github.com/gohypergiant/hyperdrive/hyper/client/transfer"
+	"github.com/gohypergiant/hyperdrive/hyper/types"
+)
+
+// copyPollInterval is how often a copy that completes asynchronously is checked on
+const copyPollInterval = time.Second
+
+var clientsMu sync.Mutex
+var clients = map[types.AzureBlobWorkspacePersistenceRemoteConfiguration]*container.Client{}
+
+// UploadFile uploads a single file to the workspace container, with the metadata if it isn't nil,
+// and returns the uploaded blob's info. The file's MD5 is stored with the blob, as blobs uploaded
+// in blocks have none otherwise.
+// Files of at least the multipart threshold are uploaded in blocks, in parallel.
+func UploadFile(azureConfig types.AzureBlobWorkspacePersistenceRemoteConfiguration, filename string, key string, metadata map[string]string) (types.ObjectInfo, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return types.ObjectInfo{}, err
+	}
+	defer f.Close()
+	hash := md5.New()
+	size, err := io.Copy(hash, f)
+	if err != nil {
+		return types.ObjectInfo{}, err
+	}
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return types.ObjectInfo{}, err
+	}
+	headers := &blob.HTTPHeaders{BlobContentMD5: hash.Sum(nil)}
+	var blobMetadata map[string]*string
+	if metadata != nil {
+		blobMetadata = map[string]*string{}
+		for name, value := range metadata {
+			blobMetadata[name] = to.Ptr(value)
+		}
+	}
+	client := getContainer(azureConfig).NewBlockBlobClient(key)
+	transferSettings := transfer.GetSettings()
+	if size >= transferSettings.MultipartThreshold {
+		_, err = client.UploadStream(context.Background(), transfer.Reader(f), &blockblob.UploadStreamOptions{
+			BlockSize:   transferSettings.MultipartChunkSize,
+			Concurrency: transferSettings.Parallel,
+			HTTPHeaders: headers,
+			Metadata:    blobMetadata,
+		})
+	} else {
+		_, err = client.Upload(context.Background(), streaming.NopCloser(transfer.ReadSeeker(f)), &blockblob.UploadOptions{
+			HTTPHeaders: headers,
+			Metadata:    blobMetadata,
+		})
+	}
+	if err != nil {
+		return types.ObjectInfo{}, fmt.Errorf("failed to upload %s, %v", filename, err)
+	}
+	return GetObjectInfo(azureConfig, key)
+}
+
+// DownloadFile downloads a single blob of the workspace container, creating any missing parent
+// directories, and sets the file's modification time to the blob's last modified time
+func DownloadFile(azureConfig types.AzureBlobWorkspacePersistenceRemoteConfiguration, key string, filename string) error {
+	info, err := GetObjectInfo(azureConfig, key)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(filename), os.ModePerm); err != nil {
+		return err
+	}
+	result, err := getContainer(azureConfig).NewBlobClient(key).DownloadStream(context.Background(), nil)
+	if err != nil {
+		return fmt.Errorf("failed to download %s, %v", getUrl(azureConfig, key), err)
+	}
+	body := result.NewRetryReader(context.Background(), nil)
+	defer body.Close()
+	err = transfer.WriteFileAtomic(filename, info.LastModified, func(f *os.File) error {
+		_, err := io.Copy(transfer.Writer(f), body)
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("failed to download %s, %v", getUrl(azureConfig, key), err)
+	}
+	return nil
+}
+
+// DeleteObject removes a single blob from the workspace container. Deleting a blob that
+// doesn't exist is not an error, as with S3.
+func DeleteObject(azureConfig types.AzureBlobWorkspacePersistenceRemoteConfiguration, key string) error {
+	_, err := getContainer(azureConfig).NewBlobClient(key).Delete(context.Background(), nil)
+	if err != nil && !bloberror.HasCode(err, bloberror.BlobNotFound) {
+		return fmt.Errorf("failed to delete %s, %v", getUrl(azureConfig, key), err)
+	}
+	return nil
+}
+
+// ListObjects returns every blob of the workspace container under the prefix
+func ListObjects(azureConfig types.AzureBlobWorkspacePersistenceRemoteConfiguration, prefix string) ([]types.ObjectInfo, error) {
+	objects := []types.ObjectInfo{}
+	pager := getContainer(azureConfig).NewListBlobsFlatPager(&container.ListBlobsFlatOptions{Prefix: to.Ptr(prefix)})
+	for pager.More() {
+		page, err := pager.NextPage(context.Background())
+		if err != nil {
+			return objects, fmt.Errorf("failed to list %s, %v", getUrl(azureConfig, prefix), err)
+		}
+		for _, item := range page.Segment.BlobItems {
+			if item.Name == nil || item.Properties == nil {
+				continue
+			}
+			objects = append(objects, getObjectInfo(*item.Name, item.Properties.ContentLength, item.Properties.LastModified, item.Properties.ContentMD5, item.Properties.ETag))
+		}
+	}
+	return objects, nil
+}
+
+// GetObjectInfo returns the size, last modified time and metadata of a blob in the workspace
+// container. Exists is false if there is no such blob.
+func GetObjectInfo(azureConfig types.AzureBlobWorkspacePersistenceRemoteConfiguration, key string) (types.ObjectInfo, error) {
+	props, err := getContainer(azureConfig).NewBlobClient(key).GetProperties(context.Background(), nil)
+	if bloberror.HasCode(err, bloberror.BlobNotFound) {
+		return types.ObjectInfo{Key: key}, nil
+	}
+	if err != nil {
+		return types.ObjectInfo{}, fmt.Errorf("cannot access %s, %v", getUrl(azureConfig, key), err)
+	}
+	info := getObjectInfo(key, props.ContentLength, props.LastModified, props.ContentMD5, props.ETag)
+	info.Metadata = map[string]string{}
+	for name, value := range props.Metadata {
+		if value != nil {
+			info.Metadata[name] = *value
+		}
+	}
+	return info, nil
+}
+
+// getObjectInfo uses the hex MD5 of a blob as its ETag, so it can be compared with a local file
+// the same way as an S3 ETag. Blobs without an MD5 fall back to their Azure ETag.
+func getObjectInfo(key string, size *int64, lastModified *time.Time, contentMD5 []byte, etag *azcore.ETag) types.ObjectInfo {
+	info := types.ObjectInfo{Key: key, Exists: true, ETag: hex.EncodeToString(contentMD5)}
+	if size != nil {
+		info.Size = *size
+	}
+	if lastModified != nil {
+		info.LastModified = *lastModified
+	}
+	if len(contentMD5) == 0 && etag != nil {
+		info.ETag = strings.Trim(string(*etag), "\"")
+	}
+	return info
+}
+
+// GetObjectContent reads a whole blob of the workspace container into memory
+func GetObjectContent(azureConfig types.AzureBlobWorkspacePersistenceRemoteConfiguration, key string) ([]byte, error) {
+	result, err := getContainer(azureConfig).NewBlobClient(key).DownloadStream(context.Background(), nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s, %v", getUrl(azureConfig, key), err)
+	}
+	defer result.Body.Close()
+	content, err := io.ReadAll(result.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s, %v", getUrl(azureConfig, key), err)
+	}
+	return content, nil
+}
+
+// PutObjectContent writes a blob of the workspace container from memory
+func PutObjectContent(azureConfig types.AzureBlobWorkspacePersistenceRemoteConfiguration, key string, content []byte) error {
+	sum := md5.Sum(content)
+	_, err := getContainer(azureConfig).NewBlockBlobClient(key).UploadBuffer(context.Background(), content, &blockblob.UploadBufferOptions{
+		HTTPHeaders: &blob.HTTPHeaders{BlobContentMD5: sum[:]},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to write %s, %v", getUrl(azureConfig, key), err)
+	}
+	return nil
+}
+
+// CopyObject copies a blob of the workspace container within the container, waiting for the
+// copy to complete. If versionId is set that version of the source blob is copied.
+func CopyObject(azureConfig types.AzureBlobWorkspacePersistenceRemoteConfiguration, srcKey string, versionId string, dstKey string) (types.ObjectInfo, error) {
+	client := getContainer(azureConfig)
+	// the source URL carries the SAS token of a SAS client, which authorizes reading the source
+	source, err := url.Parse(client.NewBlobClient(srcKey).URL())
+	if err != nil {
+		return types.ObjectInfo{}, err
+	}
+	if versionId != "" {
+		query := source.Query()
+		query.Set("versionid", versionId)
+		source.RawQuery = query.Encode()
+	}
+	dst := client.NewBlobClient(dstKey)
+	ctx := context.Background()
+	if _, err := dst.StartCopyFromURL(ctx, source.String(), nil); err != nil {
+		return types.ObjectInfo{}, fmt.Errorf("failed to copy %s to %s, %v", getUrl(azureConfig, srcKey), dstKey, err)
+	}
+	for {
+		props, err := dst.GetProperties(ctx, nil)
+		if err != nil {
+			return types.ObjectInfo{}, fmt.Errorf("failed to copy %s to %s, %v", getUrl(azureConfig, srcKey), dstKey, err)
+		}
+		var status blob.CopyStatusType
+		if props.CopyStatus != nil {
+			status = *props.CopyStatus
+		}
+		if status == blob.CopyStatusTypePending {
+			time.Sleep(copyPollInterval)
+			continue
+		}
+		if status != "" && status != blob.CopyStatusTypeSuccess {
+			var description string
+			if props.CopyStatusDescription != nil {
+				description = *props.CopyStatusDescription
+			}
+			return types.ObjectInfo{}, fmt.Errorf("failed to copy %s to %s, the copy is %s: %s", getUrl(azureConfig, srcKey), dstKey, status, description)
+		}
+		return getObjectInfo(dstKey, props.ContentLength, props.LastModified, props.ContentMD5, props.ETag), nil
+	}
+}
+
+func getUrl(azureConfig types.AzureBlobWorkspacePersistenceRemoteConfiguration, key string) string {
+	return fmt.Sprintf("azureblob://%s/%s/%s", azureConfig.AccountName, azureConfig.ContainerName, key)
+}
+
+// getServiceUrl returns the blob endpoint of the storage account
+func getServiceUrl(azureConfig types.AzureBlobWorkspacePersistenceRemoteConfiguration) string {
+	if azureConfig.Endpoint != "" {
+		return strings.TrimSuffix(azureConfig.Endpoint, "/")
+	}
+	return fmt.Sprintf("https://%s.blob.core.windows.net", azureConfig.AccountName)
+}
+
+// getContainer returns a client for the workspace container, authenticated with the connection
+// string, SAS token or account key of the configuration, in that order of preference
+func getContainer(azureConfig types.AzureBlobWorkspacePersistenceRemoteConfiguration) *container.Client {
+	clientsMu.Lock()
+	defer clientsMu.Unlock()
+	if client, ok := clients[azureConfig]; ok {
+		return client
+	}
+	client, err := newContainerClient(azureConfig)
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+	clients[azureConfig] = client
+	return client
+}
+
+func newContainerClient(azureConfig types.AzureBlobWorkspacePersistenceRemoteConfiguration) (*container.Client, error) {
+	containerUrl := getServiceUrl(azureConfig) + "/" + url.PathEscape(azureConfig.ContainerName)
+	switch {
+	case azureConfig.ConnectionString != "":
+		return container.NewClientFromConnectionString(azureConfig.ConnectionString, azureConfig.ContainerName, nil)
+	case azureConfig.SASToken != "":
+		return container.NewClientWithNoCredential(containerUrl+"?"+strings.TrimPrefix(azureConfig.SASToken, "?"), nil)
+	case azureConfig.AccountKey != "":
+		cred, err := container.NewSharedKeyCredential(azureConfig.AccountName, azureConfig.AccountKey)
+		if err != nil {
+			return nil, err
+		}
+		return container.NewClientWithSharedKeyCredential(containerUrl, cred, nil)
+	}
+	return nil, errors.New("the azureblob workspace remote needs a connection string, SAS token or account key")
+}
@@ -16,18 +16,28 @@ limitations under the License.
 package cli
 
 import (
+	"archive/tar"
 	"context"
+	"errors"
 	"fmt"
+	"io"
+	"io/fs"
 	"os"
+	"os/signal"
+	"path"
+	"path/filepath"
+	"strings"
+	"syscall"
 	"text/template"
 
 	"github.com/docker/docker/api/types"
 	"github.com/docker/docker/api/types/container"
 	"github.com/docker/docker/api/types/filters"
 	"github.com/docker/docker/client"
-	"github.com/docker/docker/pkg/archive"
 	"github.com/docker/docker/pkg/jsonmessage"
 	"github.com/docker/docker/pkg/stdcopy"
+	"github.com/docker/go-units"
+	"github.com/gohypergiant/hyperdrive/hyper/client/ignore"
 	HyperTypes "github.com/gohypergiant/hyperdrive/hyper/types"
 	"github.com/moby/term"
 )
@@ -38,17 +48,29 @@ type DockerClient struct {
 }
 
 func NewDockerClient() *DockerClient {
-	cli, err := client.NewClientWithOpts(client.FromEnv)
+	dockerClient, err := OpenDockerClient()
 	if err != nil {
 		panic(err)
 	}
 
-	dockerClient := &DockerClient{
+	return dockerClient
+}
+
+// OpenDockerClient creates a client of the docker daemon configured by the environment, for the
+// callers that carry on without docker. It is closed with Close.
+func OpenDockerClient() (*DockerClient, error) {
+	cli, err := client.NewClientWithOpts(client.FromEnv)
+	if err != nil {
+		return nil, err
+	}
+	return &DockerClient{
 		Cli: *cli,
 		Ctx: context.Background(),
-	}
+	}, nil
+}
 
-	return dockerClient
+func (dockerClient *DockerClient) Close() error {
+	return dockerClient.Cli.Close()
 }
 
 func (dockerClient *DockerClient) CreateContainer(
@@ -105,6 +127,78 @@ func (dockerClient *DockerClient) ExecuteContainer(containerID string, attach bo
 	}
 }
 
+// ErrInterrupted is returned by RunContainer when hyper is interrupted while the container runs
+var ErrInterrupted = errors.New("interrupted")
+
+// RunContainer creates and starts a container, streams its output until it exits and removes it.
+// It returns the exit code of the container's command. If hyper is interrupted while it runs, the
+// container is removed right away and ErrInterrupted is returned, for the caller to clean up.
+func (dockerClient *DockerClient) RunContainer(
+	image, name string, contConfig *container.Config,
+	hostConfig *container.HostConfig, pullImage bool,
+) (int64, error) {
+	containerID, err := dockerClient.CreateContainer(image, name, contConfig, hostConfig, pullImage)
+	if err != nil {
+		return -1, err
+	}
+	remove := func() {
+		_ = dockerClient.Cli.ContainerRemove(dockerClient.Ctx, containerID, types.ContainerRemoveOptions{Force: true})
+	}
+	defer remove()
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	defer signal.Stop(signals)
+	done := make(chan struct{})
+	defer close(done)
+	interrupted := make(chan struct{})
+	go func() {
+		select {
+		case <-signals:
+			fmt.Printf("Interrupted, removing container %s\n", name)
+			// removing the container ends its log stream and wait, so RunContainer returns
+			close(interrupted)
+			remove()
+		case <-done:
+		}
+	}()
+
+	exitCode, err := dockerClient.runCreatedContainer(containerID)
+	select {
+	case <-interrupted:
+		return -1, ErrInterrupted
+	default:
+		return exitCode, err
+	}
+}
+
+// runCreatedContainer starts a container, streams its output and waits for it to exit
+func (dockerClient *DockerClient) runCreatedContainer(containerID string) (int64, error) {
+	if err := dockerClient.Cli.ContainerStart(dockerClient.Ctx, containerID, types.ContainerStartOptions{}); err != nil {
+		return -1, err
+	}
+	out, err := dockerClient.Cli.ContainerLogs(dockerClient.Ctx, containerID, types.ContainerLogsOptions{ShowStdout: true, ShowStderr: true, Follow: true})
+	if err != nil {
+		return -1, err
+	}
+	defer out.Close()
+	_, err = stdcopy.StdCopy(os.Stdout, os.Stderr, out)
+	if err != nil {
+		return -1, err
+	}
+
+	statusCh, errCh := dockerClient.Cli.ContainerWait(dockerClient.Ctx, containerID, container.WaitConditionNotRunning)
+	select {
+	case err := <-errCh:
+		return -1, err
+	case status := <-statusCh:
+		if status.Error != nil {
+			return status.StatusCode, errors.New(status.Error.Message)
+		}
+		return status.StatusCode, nil
+	}
+}
+
 func (dockerClient *DockerClient) ListContainers(containerName string) ([]types.Container, error) {
 	containerListOptions := types.ContainerListOptions{}
 	if containerName != "" {
@@ -134,6 +228,19 @@ func (dockerClient *DockerClient) ListImages() ([]types.ImageSummary, error) {
 	return images, err
 }
 
+// HasImage reports whether the image is already in the local image cache
+func (dockerClient *DockerClient) HasImage(image string) bool {
+	images, _ := dockerClient.ListImages()
+	for _, clientImage := range images {
+		for _, tag := range clientImage.RepoTags {
+			if tag == image {
+				return true
+			}
+		}
+	}
+	return false
+}
+
 func (dockerClient *DockerClient) InspectContainer(containerId string) types.ContainerJSON {
 	containerJSON, _, err := dockerClient.Cli.ContainerInspectWithRaw(dockerClient.Ctx, containerId, false)
 
@@ -144,6 +251,30 @@ func (dockerClient *DockerClient) InspectContainer(containerId string) types.Con
 	return containerJSON
 }
 
+// GetContainerHealth returns the state of every container, including stopped ones
+func (dockerClient *DockerClient) GetContainerHealth() ([]HyperTypes.ContainerHealth, error) {
+	containers, err := dockerClient.Cli.ContainerList(dockerClient.Ctx, types.ContainerListOptions{All: true})
+	if err != nil {
+		return nil, err
+	}
+	health := []HyperTypes.ContainerHealth{}
+	for _, listedContainer := range containers {
+		containerJSON, err := dockerClient.Cli.ContainerInspect(dockerClient.Ctx, listedContainer.ID)
+		if err != nil {
+			return nil, err
+		}
+		containerHealth := HyperTypes.ContainerHealth{Name: strings.TrimPrefix(containerJSON.Name, "/")}
+		if containerJSON.State != nil {
+			containerHealth.Running = containerJSON.State.Running
+			if containerJSON.State.Health != nil {
+				containerHealth.Health = containerJSON.State.Health.Status
+			}
+		}
+		health = append(health, containerHealth)
+	}
+	return health, nil
+}
+
 func (dockerClient *DockerClient) RemoveContainer(containerId string) error {
 	errStop := dockerClient.Cli.ContainerStop(dockerClient.Ctx, containerId, nil)
 
@@ -225,13 +356,16 @@ RUN echo "*** Fast App API key is: $FASTKEY ***"
 		os.Exit(1)
 	}
 }
-func (dockerClient *DockerClient) BuildImage(dockerfilePath string, tags []string) {
+// BuildImage builds an image from the current directory. The Dockerfile and requiredPaths are
+// always sent with the build context, even if they are ignored.
+func (dockerClient *DockerClient) BuildImage(dockerfilePath string, tags []string, requiredPaths ...string) {
 
-	dockerBuildContext, err := archive.Tar("./", archive.Uncompressed) // TODO: pass this path in as a flag
+	dockerBuildContext, err := getBuildContext("./", append(requiredPaths, dockerfilePath)) // TODO: pass this path in as a flag
 	if err != nil {
 		fmt.Println(err)
 		os.Exit(1)
 	}
+	defer dockerBuildContext.Close()
 
 	opts := types.ImageBuildOptions{
 		Dockerfile: dockerfilePath,
@@ -250,3 +384,87 @@ func (dockerClient *DockerClient) BuildImage(dockerfilePath string, tags []strin
 		os.Exit(1)
 	}
 }
+
+// getBuildContext tars the build context directory, leaving out the files excluded by its
+// .hyperignore and .dockerignore unless they are required. The tar is streamed as it is read,
+// rather than held in memory; closing the reader stops the walk.
+func getBuildContext(contextPath string, requiredPaths []string) (io.ReadCloser, error) {
+	matcher, err := ignore.Load(contextPath)
+	if err != nil {
+		return nil, err
+	}
+	required := map[string]bool{}
+	for _, requiredPath := range requiredPaths {
+		rel := filepath.ToSlash(filepath.Clean(requiredPath))
+		required[rel] = true
+		// the directories of a required file have to be walked even if they are ignored
+		for dir := path.Dir(rel); dir != "." && dir != "/"; dir = path.Dir(dir) {
+			required[dir] = true
+		}
+	}
+	reader, writer := io.Pipe()
+	go func() {
+		writer.CloseWithError(writeBuildContext(writer, contextPath, required, matcher))
+	}()
+	return reader, nil
+}
+
+// writeBuildContext writes the tar of the build context to the writer
+func writeBuildContext(writer io.Writer, contextPath string, required map[string]bool, matcher *ignore.Matcher) error {
+	tarWriter := tar.NewWriter(writer)
+	files, size := 0, int64(0)
+	err := filepath.WalkDir(contextPath, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(contextPath, path)
+		if err != nil || rel == "." {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+		if !required[rel] && matcher.Ignored(rel, entry.IsDir()) {
+			if entry.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		info, err := entry.Info()
+		if err != nil {
+			return err
+		}
+		link := ""
+		if info.Mode()&os.ModeSymlink != 0 {
+			if link, err = os.Readlink(path); err != nil {
+				return err
+			}
+		}
+		header, err := tar.FileInfoHeader(info, link)
+		if err != nil {
+			return err
+		}
+		header.Name = rel
+		if err := tarWriter.WriteHeader(header); err != nil {
+			return err
+		}
+		if !info.Mode().IsRegular() {
+			return nil
+		}
+		f, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		written, err := io.Copy(tarWriter, f)
+		files++
+		size += written
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	if err := tarWriter.Close(); err != nil {
+		return err
+	}
+	fmt.Printf("Sent build context: %d files, %s\n", files, units.HumanSize(float64(size)))
+	return nil
+}
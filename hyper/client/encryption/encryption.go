@@ -0,0 +1,348 @@
+package encryption
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"golang.org/x/crypto/scrypt"
+)
+
+// MAGIC starts every encrypted file, so encrypted and plaintext objects can be told apart
+const MAGIC string = "HYPERENC"
+const VERSION byte = 1
+
+// KEY_SIZE is the size of both the workspace key and the data keys, for AES-256
+const KEY_SIZE = 32
+
+// CHUNK_SIZE is how much plaintext each sealed chunk of a file holds
+const CHUNK_SIZE = 64 * 1024
+
+const keyIdSize = 8
+const noncePrefixSize = 7
+const wrappedKeySize = 12 + KEY_SIZE + 16
+
+// HEADER_SIZE is the size of the header an encrypted file starts with:
+// magic | version | key id | wrapped data key | nonce prefix | chunk size
+const HEADER_SIZE = len(MAGIC) + 1 + keyIdSize + wrappedKeySize + noncePrefixSize + 4
+
+// Default scrypt parameters for keys derived from a passphrase
+const SCRYPT_N = 1 << 15
+const SCRYPT_R = 8
+const SCRYPT_P = 1
+
+var ErrNotEncrypted = errors.New("not an encrypted file")
+var ErrWrongKey = errors.New("encrypted with a different key")
+
+// Key is a workspace key. Every file is encrypted with its own random data key, which is
+// stored in the file's header wrapped with the workspace key.
+type Key struct {
+	key []byte
+	id  []byte
+}
+
+func NewKey(key []byte) (Key, error) {
+	if len(key) != KEY_SIZE {
+		return Key{}, fmt.Errorf("workspace keys must be %d bytes, got %d", KEY_SIZE, len(key))
+	}
+	sum := sha256.Sum256(key)
+	return Key{key: key, id: sum[:keyIdSize]}, nil
+}
+
+// Id identifies the key without revealing it, so a file encrypted with another key is reported
+// as such instead of failing to decrypt
+func (k Key) Id() string {
+	return base64.RawURLEncoding.EncodeToString(k.id)
+}
+
+// LoadKeyFile reads a base64 encoded key, as written by GenerateKeyFile
+func LoadKeyFile(path string) (Key, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return Key{}, fmt.Errorf("could not read the workspace key, %v", err)
+	}
+	key, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(content)))
+	if err != nil {
+		return Key{}, fmt.Errorf("could not read the workspace key %s, %v", path, err)
+	}
+	return NewKey(key)
+}
+
+// GenerateKeyFile writes a new random key, readable only by the current user. An existing file
+// is never overwritten, as the files encrypted with it could no longer be decrypted.
+func GenerateKeyFile(path string) error {
+	key := make([]byte, KEY_SIZE)
+	if _, err := rand.Read(key); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintln(f, base64.StdEncoding.EncodeToString(key))
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+// DeriveKey derives a key from a passphrase with scrypt
+func DeriveKey(passphrase string, salt []byte, n int, r int, p int) (Key, error) {
+	if passphrase == "" {
+		return Key{}, errors.New("the workspace passphrase is empty")
+	}
+	key, err := scrypt.Key([]byte(passphrase), salt, n, r, p, KEY_SIZE)
+	if err != nil {
+		return Key{}, err
+	}
+	return NewKey(key)
+}
+
+// EncryptedSize returns the size of a file of the given size once encrypted
+func EncryptedSize(size int64) int64 {
+	chunks := (size + CHUNK_SIZE - 1) / CHUNK_SIZE
+	if chunks == 0 {
+		chunks = 1
+	}
+	return int64(HEADER_SIZE) + size + chunks*16
+}
+
+// HasHeader reports whether content starts with the header of an encrypted file
+func HasHeader(content []byte) bool {
+	return len(content) >= len(MAGIC) && string(content[:len(MAGIC)]) == MAGIC
+}
+
+// IsEncryptedFile reports whether a file starts with the header of an encrypted file
+func IsEncryptedFile(path string) (bool, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return false, err
+	}
+	defer f.Close()
+	magic := make([]byte, len(MAGIC))
+	if _, err := io.ReadFull(f, magic); err != nil {
+		if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+			return false, nil
+		}
+		return false, err
+	}
+	return HasHeader(magic), nil
+}
+
+// Encrypt encrypts everything read from r into w. The plaintext is sealed with AES-GCM in
+// chunks, each with a nonce made of a random prefix, its index and whether it is the last one,
+// so chunks can't be reordered, dropped or truncated without decryption failing.
+func (k Key) Encrypt(w io.Writer, r io.Reader) error {
+	dataKey := make([]byte, KEY_SIZE)
+	if _, err := rand.Read(dataKey); err != nil {
+		return err
+	}
+	header := bytes.NewBuffer(make([]byte, 0, HEADER_SIZE))
+	header.WriteString(MAGIC)
+	header.WriteByte(VERSION)
+	header.Write(k.id)
+	wrapped, err := k.wrap(dataKey, header.Bytes())
+	if err != nil {
+		return err
+	}
+	header.Write(wrapped)
+	noncePrefix := make([]byte, noncePrefixSize)
+	if _, err := rand.Read(noncePrefix); err != nil {
+		return err
+	}
+	header.Write(noncePrefix)
+	binary.Write(header, binary.BigEndian, uint32(CHUNK_SIZE))
+	if _, err := w.Write(header.Bytes()); err != nil {
+		return err
+	}
+
+	aead, err := newGCM(dataKey)
+	if err != nil {
+		return err
+	}
+	in := bufio.NewReaderSize(r, CHUNK_SIZE)
+	chunk := make([]byte, CHUNK_SIZE)
+	sealed := make([]byte, 0, CHUNK_SIZE+aead.Overhead())
+	for index := uint32(0); ; index++ {
+		n, err := io.ReadFull(in, chunk)
+		if err != nil && !errors.Is(err, io.EOF) && !errors.Is(err, io.ErrUnexpectedEOF) {
+			return err
+		}
+		last := err != nil
+		if !last {
+			if _, err := in.Peek(1); errors.Is(err, io.EOF) {
+				last = true
+			}
+		}
+		sealed = aead.Seal(sealed[:0], getChunkNonce(noncePrefix, index, last), chunk[:n], header.Bytes())
+		if _, err := w.Write(sealed); err != nil {
+			return err
+		}
+		if last {
+			return nil
+		}
+	}
+}
+
+// Decrypt decrypts a file encrypted by Encrypt from r into w
+func (k Key) Decrypt(w io.Writer, r io.Reader) error {
+	header := make([]byte, HEADER_SIZE)
+	if n, err := io.ReadFull(r, header); err != nil {
+		if HasHeader(header[:n]) {
+			return errors.New("the encrypted file is truncated")
+		}
+		return ErrNotEncrypted
+	}
+	if !HasHeader(header) {
+		return ErrNotEncrypted
+	}
+	offset := len(MAGIC)
+	if header[offset] != VERSION {
+		return fmt.Errorf("unsupported encryption version %d", header[offset])
+	}
+	offset++
+	if !bytes.Equal(header[offset:offset+keyIdSize], k.id) {
+		return ErrWrongKey
+	}
+	offset += keyIdSize
+	dataKey, err := k.unwrap(header[offset:offset+wrappedKeySize], header[:offset])
+	if err != nil {
+		return err
+	}
+	offset += wrappedKeySize
+	noncePrefix := header[offset : offset+noncePrefixSize]
+	offset += noncePrefixSize
+	chunkSize := binary.BigEndian.Uint32(header[offset:])
+	if chunkSize == 0 || chunkSize > 16*1024*1024 {
+		return fmt.Errorf("invalid chunk size %d", chunkSize)
+	}
+
+	aead, err := newGCM(dataKey)
+	if err != nil {
+		return err
+	}
+	in := bufio.NewReaderSize(r, int(chunkSize)+aead.Overhead())
+	sealed := make([]byte, int(chunkSize)+aead.Overhead())
+	plain := make([]byte, 0, chunkSize)
+	for index := uint32(0); ; index++ {
+		n, err := io.ReadFull(in, sealed)
+		if err != nil && !errors.Is(err, io.EOF) && !errors.Is(err, io.ErrUnexpectedEOF) {
+			return err
+		}
+		last := err != nil
+		if !last {
+			if _, err := in.Peek(1); errors.Is(err, io.EOF) {
+				last = true
+			}
+		}
+		plain, err = aead.Open(plain[:0], getChunkNonce(noncePrefix, index, last), sealed[:n], header)
+		if err != nil {
+			return errors.New("the encrypted file is corrupted or truncated")
+		}
+		if _, err := w.Write(plain); err != nil {
+			return err
+		}
+		if last {
+			return nil
+		}
+	}
+}
+
+// EncryptBytes encrypts content held in memory
+func (k Key) EncryptBytes(content []byte) ([]byte, error) {
+	var out bytes.Buffer
+	err := k.Encrypt(&out, bytes.NewReader(content))
+	return out.Bytes(), err
+}
+
+// DecryptBytes decrypts content held in memory
+func (k Key) DecryptBytes(content []byte) ([]byte, error) {
+	var out bytes.Buffer
+	err := k.Decrypt(&out, bytes.NewReader(content))
+	return out.Bytes(), err
+}
+
+// EncryptFile encrypts the file at src into dst
+func (k Key) EncryptFile(src string, dst string) error {
+	return transformFile(src, dst, k.Encrypt)
+}
+
+// DecryptFile decrypts the file at src into dst
+func (k Key) DecryptFile(src string, dst string) error {
+	return transformFile(src, dst, k.Decrypt)
+}
+
+func transformFile(src string, dst string, transform func(io.Writer, io.Reader) error) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	out, err := os.Create(dst)
+	if err != nil {
+		return err
+	}
+	w := bufio.NewWriter(out)
+	err = transform(w, in)
+	if err == nil {
+		err = w.Flush()
+	}
+	if closeErr := out.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+// wrap seals a data key with the workspace key
+func (k Key) wrap(dataKey []byte, additionalData []byte) ([]byte, error) {
+	aead, err := newGCM(k.key)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	return aead.Seal(nonce, nonce, dataKey, additionalData), nil
+}
+
+func (k Key) unwrap(wrapped []byte, additionalData []byte) ([]byte, error) {
+	aead, err := newGCM(k.key)
+	if err != nil {
+		return nil, err
+	}
+	nonceSize := aead.NonceSize()
+	dataKey, err := aead.Open(nil, wrapped[:nonceSize], wrapped[nonceSize:], additionalData)
+	if err != nil {
+		return nil, errors.New("the data key of the encrypted file could not be unwrapped")
+	}
+	return dataKey, nil
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+func getChunkNonce(prefix []byte, index uint32, last bool) []byte {
+	nonce := make([]byte, noncePrefixSize+5)
+	copy(nonce, prefix)
+	binary.BigEndian.PutUint32(nonce[noncePrefixSize:], index)
+	if last {
+		nonce[noncePrefixSize+4] = 1
+	}
+	return nonce
+}
@@ -12,6 +12,7 @@ import (
 	"net/http"
 	"os"
 	"strings"
+	"time"
 )
 
 func ListServers(configuration types.FireflyComputeRemoteConfiguration) types.ListServersResponse {
@@ -166,6 +167,15 @@ func MkDir(configuration types.FireflyComputeRemoteConfiguration, notebookName s
 }
 
 func UploadData(configuration types.FireflyComputeRemoteConfiguration, notebookName string, localPath string, remotePath string) {
+	uploadEncodedContent(configuration, notebookName, GetEncodedFile(localPath), remotePath)
+}
+
+// UploadContent uploads in-memory content to remotePath on the notebook server
+func UploadContent(configuration types.FireflyComputeRemoteConfiguration, notebookName string, content []byte, remotePath string) {
+	uploadEncodedContent(configuration, notebookName, base64.StdEncoding.EncodeToString(content), remotePath)
+}
+
+func uploadEncodedContent(configuration types.FireflyComputeRemoteConfiguration, notebookName string, encodedFile string, remotePath string) {
 
 	//Create parent directory
 	splitPath := strings.Split(remotePath, "/")
@@ -176,7 +186,6 @@ func UploadData(configuration types.FireflyComputeRemoteConfiguration, notebookN
 
 	rootUrl := GetNotebookAPIRoot(configuration, notebookName)
 	endpoint := fmt.Sprintf("%s/contents%s", rootUrl, remotePath)
-	encodedFile := GetEncodedFile(localPath)
 	reqBody, _ := json.Marshal(types.UploadDataBody{
 		Content:  encodedFile,
 		Format:   Base64UploadFormat,
@@ -200,21 +209,32 @@ func UploadData(configuration types.FireflyComputeRemoteConfiguration, notebookN
 	//fmt.Println(string(body))
 }
 
-const (
-	TrainingPending  types.TrainingStatus = "pending"
-	TrainingStarted  types.TrainingStatus = "started"
-	TrainingComplete types.TrainingStatus = "completed"
-)
-
-func GetTrainingStatus(configuration types.FireflyComputeRemoteConfiguration, notebookName string, studyDir string) types.TrainingStatus {
-	startedPath := fmt.Sprintf("%s/STARTED", studyDir)
-	completedPath := fmt.Sprintf("%s/COMPLETED", studyDir)
-	if FileExists(configuration, notebookName, startedPath) {
-		return TrainingStarted
-	} else if FileExists(configuration, notebookName, completedPath) {
-		return TrainingComplete
+// GetFileModTime returns when a file on the notebook server was last modified, and whether it
+// exists
+func GetFileModTime(configuration types.FireflyComputeRemoteConfiguration, notebookName string, filepath string) (time.Time, bool, error) {
+	rootUrl := GetNotebookAPIRoot(configuration, notebookName)
+	endpoint := fmt.Sprintf("%s/contents%s?content=0", rootUrl, filepath)
+	req, err := http.NewRequest("GET", endpoint, nil)
+	if err != nil {
+		return time.Time{}, false, err
+	}
+	req.Header.Add("Authorization", fmt.Sprintf("token %s", configuration.HubToken))
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return time.Time{}, false, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotFound {
+		return time.Time{}, false, nil
+	}
+	if resp.StatusCode != http.StatusOK {
+		return time.Time{}, false, fmt.Errorf("the notebook server responded with %s", resp.Status)
+	}
+	var fileInfo types.FileInfoResponse
+	if err := json.NewDecoder(resp.Body).Decode(&fileInfo); err != nil {
+		return time.Time{}, false, err
 	}
-	return TrainingPending
+	return fileInfo.LastModified, true, nil
 }
 
 func FileExists(configuration types.FireflyComputeRemoteConfiguration, notebookName string, filepath string) bool {
@@ -0,0 +1,238 @@
+package gcp
+
+import (
+	"context"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+
+	"cloud.google.com/go/storage"
+	"github.com/gohypergiant/hyperdrive/hyper/client/transfer"
+	"github.com/gohypergiant/hyperdrive/hyper/types"
+	"google.golang.org/api/iterator"
+	"google.golang.org/api/option"
+)
+
+var clientsMu sync.Mutex
+var clients = map[types.GCSWorkspacePersistenceRemoteConfiguration]*storage.Client{}
+
+// UploadFile uploads a single file to the workspace bucket, with the metadata if it isn't nil, and
+// returns the uploaded object's info.
+// Files of at least the multipart threshold are sent in chunks with a resumable upload, so a
+// chunk that fails is sent again instead of the whole file.
+func UploadFile(gcsConfig types.GCSWorkspacePersistenceRemoteConfiguration, filename string, key string, metadata map[string]string) (types.ObjectInfo, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return types.ObjectInfo{}, err
+	}
+	defer f.Close()
+	stat, err := f.Stat()
+	if err != nil {
+		return types.ObjectInfo{}, err
+	}
+	ctx := context.Background()
+	w := getBucket(gcsConfig).Object(key).NewWriter(ctx)
+	w.ChunkSize = 0
+	w.Metadata = metadata
+	if transferSettings := transfer.GetSettings(); stat.Size() >= transferSettings.MultipartThreshold {
+		w.ChunkSize = int(transferSettings.MultipartChunkSize)
+	}
+	_, err = io.Copy(w, transfer.Reader(f))
+	if closeErr := w.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return types.ObjectInfo{}, fmt.Errorf("failed to upload %s, %v", filename, err)
+	}
+	return getObjectInfo(w.Attrs(), false), nil
+}
+
+// DownloadFile downloads a single object of the workspace bucket, creating any missing parent
+// directories, and sets the file's modification time to the object's last modified time
+func DownloadFile(gcsConfig types.GCSWorkspacePersistenceRemoteConfiguration, key string, filename string) error {
+	ctx := context.Background()
+	r, err := getBucket(gcsConfig).Object(key).NewReader(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to download %s, %v", getUrl(gcsConfig, key), err)
+	}
+	defer r.Close()
+	if err := os.MkdirAll(filepath.Dir(filename), os.ModePerm); err != nil {
+		return err
+	}
+	err = transfer.WriteFileAtomic(filename, r.Attrs.LastModified, func(f *os.File) error {
+		_, err := io.Copy(transfer.Writer(f), r)
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("failed to download %s, %v", getUrl(gcsConfig, key), err)
+	}
+	return nil
+}
+
+// DeleteObject removes a single object from the workspace bucket. Deleting an object that
+// doesn't exist is not an error, as with S3.
+func DeleteObject(gcsConfig types.GCSWorkspacePersistenceRemoteConfiguration, key string) error {
+	err := getBucket(gcsConfig).Object(key).Delete(context.Background())
+	if err != nil && !errors.Is(err, storage.ErrObjectNotExist) {
+		return fmt.Errorf("failed to delete %s, %v", getUrl(gcsConfig, key), err)
+	}
+	return nil
+}
+
+// ListObjects returns every object of the workspace bucket under the prefix
+func ListObjects(gcsConfig types.GCSWorkspacePersistenceRemoteConfiguration, prefix string) ([]types.ObjectInfo, error) {
+	return listObjects(gcsConfig, prefix, false)
+}
+
+// ListCurrentObjectVersions returns every object of a versioned workspace bucket under the
+// prefix, with its generation as the version id. Deleted objects are left out.
+func ListCurrentObjectVersions(gcsConfig types.GCSWorkspacePersistenceRemoteConfiguration, prefix string) ([]types.ObjectInfo, error) {
+	return listObjects(gcsConfig, prefix, true)
+}
+
+func listObjects(gcsConfig types.GCSWorkspacePersistenceRemoteConfiguration, prefix string, withVersions bool) ([]types.ObjectInfo, error) {
+	objects := []types.ObjectInfo{}
+	it := getBucket(gcsConfig).Objects(context.Background(), &storage.Query{Prefix: prefix})
+	for {
+		attrs, err := it.Next()
+		if errors.Is(err, iterator.Done) {
+			break
+		}
+		if err != nil {
+			return objects, fmt.Errorf("failed to list %s, %v", getUrl(gcsConfig, prefix), err)
+		}
+		objects = append(objects, getObjectInfo(attrs, withVersions))
+	}
+	return objects, nil
+}
+
+// GetObjectInfo returns the size and last modified time of an object in the workspace bucket.
+// Exists is false if there is no such object.
+func GetObjectInfo(gcsConfig types.GCSWorkspacePersistenceRemoteConfiguration, key string) (types.ObjectInfo, error) {
+	attrs, err := getBucket(gcsConfig).Object(key).Attrs(context.Background())
+	if errors.Is(err, storage.ErrObjectNotExist) {
+		return types.ObjectInfo{Key: key}, nil
+	}
+	if err != nil {
+		return types.ObjectInfo{}, fmt.Errorf("cannot access %s, %v", getUrl(gcsConfig, key), err)
+	}
+	return getObjectInfo(attrs, false), nil
+}
+
+// getObjectInfo uses the hex MD5 of an object as its ETag, so it can be compared with a local
+// file the same way as an S3 ETag. Composite objects have no MD5 and fall back to their generation.
+func getObjectInfo(attrs *storage.ObjectAttrs, withVersion bool) types.ObjectInfo {
+	info := types.ObjectInfo{
+		Key:          attrs.Name,
+		Exists:       true,
+		Size:         attrs.Size,
+		LastModified: attrs.Updated,
+		ETag:         hex.EncodeToString(attrs.MD5),
+		Metadata:     attrs.Metadata,
+	}
+	if len(attrs.MD5) == 0 {
+		info.ETag = "g" + strconv.FormatInt(attrs.Generation, 10)
+	}
+	if withVersion {
+		info.VersionId = strconv.FormatInt(attrs.Generation, 10)
+	}
+	return info
+}
+
+// GetObjectContent reads a whole object of the workspace bucket into memory
+func GetObjectContent(gcsConfig types.GCSWorkspacePersistenceRemoteConfiguration, key string) ([]byte, error) {
+	r, err := getBucket(gcsConfig).Object(key).NewReader(context.Background())
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s, %v", getUrl(gcsConfig, key), err)
+	}
+	defer r.Close()
+	content, err := io.ReadAll(r)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s, %v", getUrl(gcsConfig, key), err)
+	}
+	return content, nil
+}
+
+// PutObjectContent writes an object of the workspace bucket from memory
+func PutObjectContent(gcsConfig types.GCSWorkspacePersistenceRemoteConfiguration, key string, content []byte) error {
+	w := getBucket(gcsConfig).Object(key).NewWriter(context.Background())
+	_, err := w.Write(content)
+	if closeErr := w.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return fmt.Errorf("failed to write %s, %v", getUrl(gcsConfig, key), err)
+	}
+	return nil
+}
+
+// CopyObject copies an object of the workspace bucket within the bucket. If versionId is set
+// that generation of the source object is copied, otherwise its live generation.
+func CopyObject(gcsConfig types.GCSWorkspacePersistenceRemoteConfiguration, srcKey string, versionId string, dstKey string) (types.ObjectInfo, error) {
+	bucket := getBucket(gcsConfig)
+	src := bucket.Object(srcKey)
+	if versionId != "" {
+		generation, err := strconv.ParseInt(versionId, 10, 64)
+		if err != nil {
+			return types.ObjectInfo{}, fmt.Errorf("invalid generation %q of %s", versionId, getUrl(gcsConfig, srcKey))
+		}
+		src = src.Generation(generation)
+	}
+	attrs, err := bucket.Object(dstKey).CopierFrom(src).Run(context.Background())
+	if err != nil {
+		return types.ObjectInfo{}, fmt.Errorf("failed to copy %s to %s, %v", getUrl(gcsConfig, srcKey), dstKey, err)
+	}
+	return getObjectInfo(attrs, false), nil
+}
+
+// IsVersioningEnabled reports whether object versioning is enabled on the workspace bucket
+func IsVersioningEnabled(gcsConfig types.GCSWorkspacePersistenceRemoteConfiguration) (bool, error) {
+	attrs, err := getBucket(gcsConfig).Attrs(context.Background())
+	if err != nil {
+		return false, fmt.Errorf("failed to get the versioning of gs://%s, %v", gcsConfig.BucketName, err)
+	}
+	return attrs.VersioningEnabled, nil
+}
+
+func getUrl(gcsConfig types.GCSWorkspacePersistenceRemoteConfiguration, key string) string {
+	return fmt.Sprintf("gs://%s/%s", gcsConfig.BucketName, key)
+}
+
+// getBucket returns a handle on the workspace bucket. Clients are kept for the life of the
+// process, as each one holds its own connection pool and credentials.
+func getBucket(gcsConfig types.GCSWorkspacePersistenceRemoteConfiguration) *storage.BucketHandle {
+	clientsMu.Lock()
+	defer clientsMu.Unlock()
+	client, ok := clients[gcsConfig]
+	if !ok {
+		var err error
+		client, err = storage.NewClient(context.Background(), getClientOptions(gcsConfig)...)
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+		clients[gcsConfig] = client
+	}
+	return client.Bucket(gcsConfig.BucketName)
+}
+
+// getClientOptions authenticates with the service account key of the configuration, or the
+// application default credentials without one. Emulators are used without authentication.
+func getClientOptions(gcsConfig types.GCSWorkspacePersistenceRemoteConfiguration) []option.ClientOption {
+	opts := []option.ClientOption{}
+	if gcsConfig.CredentialsFile != "" {
+		opts = append(opts, option.WithCredentialsFile(gcsConfig.CredentialsFile))
+	}
+	if gcsConfig.Endpoint != "" {
+		opts = append(opts, option.WithEndpoint(gcsConfig.Endpoint))
+		if gcsConfig.CredentialsFile == "" {
+			opts = append(opts, option.WithoutAuthentication())
+		}
+	}
+	return opts
+}
@@ -0,0 +1,194 @@
+package ignore
+
+import (
+	"bufio"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// HYPERIGNORE_FILE_NAME lists the files workspace sync and docker build contexts leave out,
+// using gitignore syntax
+const HYPERIGNORE_FILE_NAME string = ".hyperignore"
+const DOCKERIGNORE_FILE_NAME string = ".dockerignore"
+
+type rule struct {
+	pattern *regexp.Regexp
+	negate  bool
+	dirOnly bool
+}
+
+// Matcher decides whether a path is ignored. Paths are relative to the directory the ignore
+// files were loaded from, using forward slashes.
+type Matcher struct {
+	rules []rule
+}
+
+// Load reads the .dockerignore and .hyperignore files at the root of a directory. Rules of the
+// .hyperignore come last, so they can re-include files the .dockerignore excludes. Missing
+// files are not an error, the matcher then ignores nothing.
+func Load(root string) (*Matcher, error) {
+	m := &Matcher{}
+	if err := m.addFile(filepath.Join(root, DOCKERIGNORE_FILE_NAME), parseDockerignoreLine); err != nil {
+		return m, err
+	}
+	if err := m.addFile(filepath.Join(root, HYPERIGNORE_FILE_NAME), parseGitignoreLine); err != nil {
+		return m, err
+	}
+	return m, nil
+}
+
+func (m *Matcher) addFile(filename string, parse func(string) (rule, bool)) error {
+	f, err := os.Open(filename)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		if r, ok := parse(scanner.Text()); ok {
+			m.rules = append(m.rules, r)
+		}
+	}
+	return scanner.Err()
+}
+
+// Ignored reports whether a path is ignored, either itself or because one of its parent
+// directories is. As in git, a file can't be re-included if its directory is ignored.
+func (m *Matcher) Ignored(rel string, isDir bool) bool {
+	if m == nil || len(m.rules) == 0 {
+		return false
+	}
+	rel = strings.Trim(path.Clean(filepath.ToSlash(rel)), "/")
+	if rel == "." || rel == "" {
+		return false
+	}
+	parts := strings.Split(rel, "/")
+	for i := 1; i < len(parts); i++ {
+		if m.match(strings.Join(parts[:i], "/"), true) {
+			return true
+		}
+	}
+	return m.match(rel, isDir)
+}
+
+// match applies the rules to a single path, the last matching rule wins
+func (m *Matcher) match(rel string, isDir bool) bool {
+	ignored := false
+	for _, r := range m.rules {
+		if r.dirOnly && !isDir {
+			continue
+		}
+		if r.pattern.MatchString(rel) {
+			ignored = !r.negate
+		}
+	}
+	return ignored
+}
+
+// parseGitignoreLine parses a line of gitignore syntax. Patterns without a slash (other than a
+// trailing one) match at any depth, others are relative to the root; a trailing slash only
+// matches directories.
+func parseGitignoreLine(line string) (rule, bool) {
+	line = strings.TrimRight(line, " \t\r")
+	if line == "" || strings.HasPrefix(line, "#") {
+		return rule{}, false
+	}
+	r := rule{}
+	if strings.HasPrefix(line, "!") {
+		r.negate = true
+		line = line[1:]
+	} else if strings.HasPrefix(line, `\!`) || strings.HasPrefix(line, `\#`) {
+		line = line[1:]
+	}
+	if strings.HasSuffix(line, "/") {
+		r.dirOnly = true
+		line = strings.TrimRight(line, "/")
+	}
+	if line == "" {
+		return rule{}, false
+	}
+	anchored := strings.Contains(line, "/")
+	line = strings.TrimPrefix(line, "/")
+	return compile(r, line, anchored)
+}
+
+// parseDockerignoreLine parses a line of .dockerignore syntax, where every pattern is relative
+// to the root and may match files or directories
+func parseDockerignoreLine(line string) (rule, bool) {
+	line = strings.TrimSpace(line)
+	if line == "" || strings.HasPrefix(line, "#") {
+		return rule{}, false
+	}
+	r := rule{}
+	if strings.HasPrefix(line, "!") {
+		r.negate = true
+		line = strings.TrimSpace(line[1:])
+	}
+	line = strings.Trim(path.Clean(line), "/")
+	if line == "" || line == "." {
+		return rule{}, false
+	}
+	return compile(r, line, true)
+}
+
+func compile(r rule, pattern string, anchored bool) (rule, bool) {
+	expression := globToRegexp(pattern)
+	if anchored {
+		expression = "^" + expression + "$"
+	} else {
+		expression = "^(?:.*/)?" + expression + "$"
+	}
+	compiled, err := regexp.Compile(expression)
+	if err != nil {
+		return rule{}, false
+	}
+	r.pattern = compiled
+	return r, true
+}
+
+// globToRegexp translates a glob with gitignore's ** extension to a regular expression
+func globToRegexp(pattern string) string {
+	var b strings.Builder
+	for i := 0; i < len(pattern); i++ {
+		c := pattern[i]
+		switch {
+		case strings.HasPrefix(pattern[i:], "**/"):
+			b.WriteString("(?:.*/)?")
+			i += 2
+		case strings.HasPrefix(pattern[i:], "/**") && i+3 == len(pattern):
+			b.WriteString("/.*")
+			i += 2
+		case pattern[i:] == "**":
+			b.WriteString(".*")
+			i++
+		case c == '*':
+			b.WriteString("[^/]*")
+		case c == '?':
+			b.WriteString("[^/]")
+		case c == '\\' && i+1 < len(pattern):
+			i++
+			b.WriteString(regexp.QuoteMeta(string(pattern[i])))
+		case c == '[':
+			end := strings.IndexByte(pattern[i+1:], ']')
+			if end < 0 {
+				b.WriteString(`\[`)
+				continue
+			}
+			class := pattern[i+1 : i+1+end]
+			if strings.HasPrefix(class, "!") {
+				class = "^" + class[1:]
+			}
+			b.WriteString("[" + strings.ReplaceAll(class, `\`, `\\`) + "]")
+			i += end + 1
+		default:
+			b.WriteString(regexp.QuoteMeta(string(c)))
+		}
+	}
+	return b.String()
+}
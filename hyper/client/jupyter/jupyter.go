@@ -0,0 +1,56 @@
+package jupyter
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gohypergiant/hyperdrive/hyper/types"
+)
+
+// requestTimeout caps how long the notebook server has to answer
+const requestTimeout = 10 * time.Second
+
+// GetKernels lists the kernels running on the notebook server
+func GetKernels(url string, token string) ([]types.JupyterKernel, error) {
+	kernels := []types.JupyterKernel{}
+	_, err := get(url, "/api/kernels", token, &kernels)
+	return kernels, err
+}
+
+// GetStatus returns the status of the notebook server. Reading it isn't counted as activity of
+// the server, unlike the other APIs.
+func GetStatus(url string, token string) (types.JupyterStatus, error) {
+	status := types.JupyterStatus{}
+	found, err := get(url, "/api/status", token, &status)
+	if err == nil && !found {
+		err = fmt.Errorf("the notebook server has no status API")
+	}
+	return status, err
+}
+
+// get decodes the response of the API at the path into the value, reporting whether it exists
+func get(url string, path string, token string, value interface{}) (bool, error) {
+	req, err := http.NewRequest("GET", strings.TrimSuffix(url, "/")+path, nil)
+	if err != nil {
+		return false, err
+	}
+	if token != "" {
+		req.Header.Set("Authorization", "token "+token)
+	}
+	client := &http.Client{Timeout: requestTimeout}
+	resp, err := client.Do(req)
+	if err != nil {
+		return false, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotFound {
+		return false, nil
+	}
+	if resp.StatusCode != http.StatusOK {
+		return true, fmt.Errorf("the notebook server responded to %s with %s", path, resp.Status)
+	}
+	return true, json.NewDecoder(resp.Body).Decode(value)
+}
@@ -76,3 +76,149 @@ func GetName(manifestPath string) string {
 func GetProjectName(manifestPath string) string {
 	return GetManifest(manifestPath).ProjectName
 }
+
+// IsRemoteSource reports whether a training data source points at object storage
+// (e.g. s3://bucket/key) rather than a path relative to the study directory.
+func IsRemoteSource(source string) bool {
+	return strings.HasPrefix(strings.ToLower(source), "s3://")
+}
+
+// GetManifestDocument reads the manifest as an ordered YAML document so it can be
+// modified and re-serialized without dropping fields that types.Manifest doesn't model.
+func GetManifestDocument(manifestPath string) yaml.MapSlice {
+	// Make sure the study and project names have been generated before reading the raw document
+	GetManifest(manifestPath)
+
+	var document yaml.MapSlice
+	yamlFile, err := ioutil.ReadFile(manifestPath)
+	if err != nil {
+		log.Fatalf("yamlFile.Get err   #%v ", err)
+	}
+	err = yaml.Unmarshal(yamlFile, &document)
+	if err != nil {
+		log.Fatalf("Unmarshal: %v", err)
+	}
+	return document
+}
+
+// SetValue sets the value at keyPath in the document, creating any intermediate mappings. Values
+// along the path that are set to something other than a mapping, e.g. a list, are never replaced.
+func SetValue(document yaml.MapSlice, keyPath []string, value interface{}) (yaml.MapSlice, error) {
+	if len(keyPath) == 0 {
+		return document, nil
+	}
+	for i, item := range document {
+		if fmt.Sprint(item.Key) != keyPath[0] {
+			continue
+		}
+		if len(keyPath) == 1 {
+			document[i].Value = value
+			return document, nil
+		}
+		child, isMap := item.Value.(yaml.MapSlice)
+		if !isMap && item.Value != nil {
+			return nil, fmt.Errorf("%s is not a mapping, %s can't be set in it", keyPath[0], strings.Join(keyPath[1:], "."))
+		}
+		childValue, err := SetValue(child, keyPath[1:], value)
+		if err != nil {
+			return nil, fmt.Errorf("%s.%v", keyPath[0], err)
+		}
+		document[i].Value = childValue
+		return document, nil
+	}
+	if len(keyPath) == 1 {
+		return append(document, yaml.MapItem{Key: keyPath[0], Value: value}), nil
+	}
+	childValue, err := SetValue(yaml.MapSlice{}, keyPath[1:], value)
+	if err != nil {
+		return nil, err
+	}
+	return append(document, yaml.MapItem{Key: keyPath[0], Value: childValue}), nil
+}
+
+// ResolveManifest applies command line overrides (key=value) to an in-memory copy of the manifest.
+// The manifest on disk is left untouched.
+func ResolveManifest(manifestPath string, overrides []string) (yaml.MapSlice, types.Manifest, error) {
+	var m types.Manifest
+	document := GetManifestDocument(manifestPath)
+	for _, override := range overrides {
+		var err error
+		document, err = applyOverride(document, override)
+		if err != nil {
+			return nil, m, err
+		}
+	}
+
+	resolvedYAML, err := yaml.Marshal(document)
+	if err != nil {
+		return nil, m, err
+	}
+	err = yaml.Unmarshal(resolvedYAML, &m)
+	if err != nil {
+		return nil, m, err
+	}
+	return document, m, nil
+}
+
+func applyOverride(document yaml.MapSlice, override string) (yaml.MapSlice, error) {
+	separatorIndex := strings.Index(override, "=")
+	if separatorIndex <= 0 {
+		return nil, fmt.Errorf("invalid override %q, expected key=value", override)
+	}
+	keyPath := resolveKeyPath(document, splitKey(override[:separatorIndex]))
+	if keyPath[0] == "study_name" || keyPath[0] == "project_name" {
+		return nil, fmt.Errorf("invalid override %q, %s cannot be overridden", override, keyPath[0])
+	}
+
+	var value interface{}
+	err := yaml.Unmarshal([]byte(override[separatorIndex+1:]), &value)
+	if err != nil {
+		return nil, fmt.Errorf("invalid override %q, %v", override, err)
+	}
+	document, err = SetValue(document, keyPath, value)
+	if err != nil {
+		return nil, fmt.Errorf("invalid override %q, %v", override, err)
+	}
+	return document, nil
+}
+
+// splitKey splits a dotted key into its segments. Segments wrapped in brackets are kept whole,
+// so keys that contain dots can be addressed explicitly, e.g. models.[sklearn.svm.SVC].C
+func splitKey(key string) []string {
+	var segments []string
+	var segment strings.Builder
+	bracketed := false
+	for _, r := range key {
+		switch {
+		case r == '[' && segment.Len() == 0:
+			bracketed = true
+		case r == ']' && bracketed:
+			bracketed = false
+		case r == '.' && !bracketed:
+			segments = append(segments, segment.String())
+			segment.Reset()
+		default:
+			segment.WriteRune(r)
+		}
+	}
+	return append(segments, segment.String())
+}
+
+// resolveKeyPath matches key segments against the keys that already exist in the document.
+// The longest run of segments naming an existing key wins, since model names such as
+// sklearn.linear_model.LogisticRegression contain dots themselves.
+func resolveKeyPath(document yaml.MapSlice, segments []string) []string {
+	if len(segments) == 0 {
+		return segments
+	}
+	for n := len(segments); n > 0; n-- {
+		key := strings.Join(segments[:n], ".")
+		for _, item := range document {
+			if fmt.Sprint(item.Key) == key {
+				child, _ := item.Value.(yaml.MapSlice)
+				return append([]string{key}, resolveKeyPath(child, segments[n:])...)
+			}
+		}
+	}
+	return segments
+}
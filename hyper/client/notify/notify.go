@@ -0,0 +1,132 @@
+package notify
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/gohypergiant/hyperdrive/hyper/types"
+)
+
+// DEFAULT_RETRIES is how many times a notification is resent after a failed attempt
+const DEFAULT_RETRIES = 4
+
+// requestTimeout caps how long a sink has to accept a notification
+const requestTimeout = 10 * time.Second
+
+// maxRetryDelay caps the delay between two attempts of a notification
+const maxRetryDelay = 30 * time.Second
+
+// Notify sends the notification to every sink that subscribes to its event. Sinks that can't be
+// reached are reported, but never fail the caller, as notifications are a side effect.
+func Notify(sinks []types.NotificationSinkConfiguration, notification types.Notification) {
+	NotifyWithRetries(sinks, notification, DEFAULT_RETRIES)
+}
+
+// NotifyWithRetries notifies the sinks like Notify, resending a failed notification at most the
+// given number of times, for callers that can't wait on sinks that are down
+func NotifyWithRetries(sinks []types.NotificationSinkConfiguration, notification types.Notification, retries int) {
+	if notification.Time.IsZero() {
+		notification.Time = time.Now().UTC()
+	}
+	for _, sink := range sinks {
+		if !IsSubscribed(sink, notification.Event) {
+			continue
+		}
+		if err := SendWithRetries(sink, notification, retries); err != nil {
+			fmt.Printf("Could not notify %s: %v\n", sink.Url, err)
+		}
+	}
+}
+
+// IsSubscribed reports whether the sink is sent the notifications of an event. Sinks that don't
+// list their events are sent the default ones.
+func IsSubscribed(sink types.NotificationSinkConfiguration, event types.NotificationEvent) bool {
+	events := sink.Events
+	if len(events) == 0 {
+		events = types.DefaultNotificationEvents
+	}
+	for _, subscribed := range events {
+		if subscribed == event {
+			return true
+		}
+	}
+	return false
+}
+
+// Send posts the notification to the sink, retrying with a delay twice as long after every failed
+// attempt. Sinks that reject the notification, with a 4xx other than 429, aren't retried.
+func Send(sink types.NotificationSinkConfiguration, notification types.Notification) error {
+	return SendWithRetries(sink, notification, DEFAULT_RETRIES)
+}
+
+// SendWithRetries posts the notification to the sink like Send, retrying at most the given number
+// of times
+func SendWithRetries(sink types.NotificationSinkConfiguration, notification types.Notification, retries int) error {
+	payload, err := getPayload(sink, notification)
+	if err != nil {
+		return err
+	}
+	client := &http.Client{Timeout: requestTimeout}
+	delay := time.Second
+	for attempt := 0; ; attempt++ {
+		retry, err := post(client, sink.Url, payload)
+		if err == nil || !retry || attempt >= retries {
+			return err
+		}
+		fmt.Printf("Retrying the notification in %s (%d/%d): %v\n", delay, attempt+1, retries, err)
+		time.Sleep(delay)
+		delay *= 2
+		if delay > maxRetryDelay {
+			delay = maxRetryDelay
+		}
+	}
+}
+
+// post sends the payload, reporting whether a failed attempt is worth retrying
+func post(client *http.Client, url string, payload []byte) (bool, error) {
+	response, err := client.Post(url, "application/json", bytes.NewReader(payload))
+	if err != nil {
+		return true, err
+	}
+	response.Body.Close()
+	if response.StatusCode >= 200 && response.StatusCode < 300 {
+		return false, nil
+	}
+	retry := response.StatusCode >= 500 || response.StatusCode == http.StatusTooManyRequests
+	return retry, fmt.Errorf("the sink responded with %s", response.Status)
+}
+
+func getPayload(sink types.NotificationSinkConfiguration, notification types.Notification) ([]byte, error) {
+	switch sink.Type {
+	case types.WebhookSink, "":
+		return json.Marshal(notification)
+	case types.SlackSink:
+		return json.Marshal(map[string]string{"text": getSlackText(notification)})
+	}
+	return nil, fmt.Errorf("invalid notification sink type %q, must be one of %v", sink.Type, types.ValidNotificationSinkTypes)
+}
+
+func getSlackText(notification types.Notification) string {
+	title := fmt.Sprintf("%s is %s", notification.Source, notification.Event)
+	switch notification.Event {
+	case types.NotificationEvent(types.PhaseReady):
+		title = fmt.Sprintf(":white_check_mark: %s is ready", notification.Source)
+	case types.NotificationEvent(types.PhaseFailed):
+		title = fmt.Sprintf(":x: %s failed", notification.Source)
+	case types.NotificationEvent(types.PhaseInterrupted):
+		title = fmt.Sprintf(":warning: %s is being interrupted", notification.Source)
+	case types.NotifyTrainingCompleted:
+		title = fmt.Sprintf(":tada: Training of %s completed", notification.Source)
+	case types.NotifyTrainingFailed:
+		title = fmt.Sprintf(":x: Training of %s failed", notification.Source)
+	case types.NotifyTest:
+		title = fmt.Sprintf(":bell: Test notification from %s", notification.Source)
+	}
+	if notification.Message == "" {
+		return "*" + title + "*"
+	}
+	return fmt.Sprintf("*%s*\n%s", title, notification.Message)
+}
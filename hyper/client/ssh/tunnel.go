@@ -0,0 +1,123 @@
+package ssh
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"net"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Tunnel forwards a port on localhost to a port of a remote server through ssh
+type Tunnel struct {
+	LocalPort int
+	cmd       *exec.Cmd
+	done      chan error
+}
+
+// OpenTunnel forwards a free local port to remotePort on the remote server, with the ssh client
+// of the system. The private key is left to the ssh agent when its path is empty.
+func OpenTunnel(username string, privateKeyPath string, knownHostsPath string, remoteServerIP string, remotePort int, timeout time.Duration) (*Tunnel, error) {
+	bin, err := exec.LookPath("ssh")
+	if err != nil {
+		return nil, err
+	}
+	localPort, err := getFreePort()
+	if err != nil {
+		return nil, err
+	}
+	args := append([]string{
+		"-N",
+		"-o", "ExitOnForwardFailure=yes",
+		"-L", fmt.Sprintf("127.0.0.1:%d:localhost:%d", localPort, remotePort),
+	}, getSshArgs(username, privateKeyPath, knownHostsPath, remoteServerIP, timeout)...)
+
+	tunnel := &Tunnel{LocalPort: localPort, cmd: exec.Command(bin, args...), done: make(chan error, 1)}
+	var stderr bytes.Buffer
+	tunnel.cmd.Stderr = &stderr
+	if err := tunnel.cmd.Start(); err != nil {
+		return nil, err
+	}
+	go func() {
+		tunnel.done <- tunnel.cmd.Wait()
+	}()
+
+	address := net.JoinHostPort("127.0.0.1", strconv.Itoa(localPort))
+	deadline := time.Now().Add(timeout)
+	for time.Now().Before(deadline) {
+		select {
+		case err := <-tunnel.done:
+			if message := strings.TrimSpace(stderr.String()); message != "" {
+				err = errors.New(message)
+			} else if err == nil {
+				err = errors.New("ssh exited")
+			}
+			return nil, fmt.Errorf("could not open an ssh tunnel to %s, %v", remoteServerIP, err)
+		default:
+		}
+		if conn, err := net.DialTimeout("tcp", address, time.Second); err == nil {
+			conn.Close()
+			return tunnel, nil
+		}
+		time.Sleep(200 * time.Millisecond)
+	}
+	tunnel.Close()
+	return nil, fmt.Errorf("timed out opening an ssh tunnel to %s", remoteServerIP)
+}
+
+// Run runs a command on the remote server with the ssh client of the system, and returns its
+// output
+func Run(username string, privateKeyPath string, knownHostsPath string, remoteServerIP string, command string, timeout time.Duration) (string, error) {
+	bin, err := exec.LookPath("ssh")
+	if err != nil {
+		return "", err
+	}
+	cmd := exec.Command(bin, append(getSshArgs(username, privateKeyPath, knownHostsPath, remoteServerIP, timeout), command)...)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	output, err := cmd.Output()
+	if message := strings.TrimSpace(stderr.String()); err != nil && message != "" {
+		err = errors.New(message)
+	}
+	return string(output), err
+}
+
+// getSshArgs returns the options to connect to the remote server with. The host key is checked
+// against, and added to, the known hosts file, kept apart from the user's so the keys of
+// short-lived instances don't pile up there.
+func getSshArgs(username string, privateKeyPath string, knownHostsPath string, remoteServerIP string, timeout time.Duration) []string {
+	args := []string{
+		"-o", "BatchMode=yes",
+		"-o", "StrictHostKeyChecking=accept-new",
+		"-o", "UserKnownHostsFile=" + knownHostsPath,
+		"-o", fmt.Sprintf("ConnectTimeout=%d", int(timeout.Seconds())),
+	}
+	if privateKeyPath != "" {
+		args = append(args, "-i", privateKeyPath)
+	}
+	return append(args, fmt.Sprintf("%s@%s", username, remoteServerIP))
+}
+
+// Close stops forwarding the port
+func (t *Tunnel) Close() error {
+	if t.cmd.Process == nil {
+		return nil
+	}
+	if err := t.cmd.Process.Kill(); err != nil {
+		return err
+	}
+	<-t.done
+	return nil
+}
+
+func getFreePort() (int, error) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return 0, err
+	}
+	defer listener.Close()
+	return listener.Addr().(*net.TCPAddr).Port, nil
+}
@@ -0,0 +1,260 @@
+package transfer
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/gohypergiant/hyperdrive/hyper/types"
+)
+
+const mib = 1024 * 1024
+
+// Defaults for the transfer settings that aren't set
+const DEFAULT_PARALLEL = 4
+const DEFAULT_RETRIES = 3
+const DEFAULT_MULTIPART_THRESHOLD = 8 * mib
+const DEFAULT_MULTIPART_CHUNK_SIZE = 8 * mib
+
+// throttleChunkSize is the most that is read or written at once under a bandwidth limit, so
+// transfers are slowed down smoothly instead of in bursts
+const throttleChunkSize = 32 * 1024
+
+// maxRetryDelay caps the delay between two attempts of a transfer
+const maxRetryDelay = 30 * time.Second
+
+var settingsMu sync.RWMutex
+var settings = withDefaults(types.WorkspaceTransferSettings{Retries: DEFAULT_RETRIES})
+var limiter *bandwidthLimiter
+
+// Configure sets the transfer settings of every workspace transfer of the process. Settings
+// that aren't set keep their default, except for the retries as none is a valid setting.
+func Configure(transferSettings types.WorkspaceTransferSettings) {
+	settingsMu.Lock()
+	defer settingsMu.Unlock()
+	settings = withDefaults(transferSettings)
+	limiter = nil
+	if settings.MaxBandwidth > 0 {
+		limiter = newBandwidthLimiter(settings.MaxBandwidth)
+	}
+}
+
+// GetSettings returns the transfer settings, with the defaults of those that weren't set
+func GetSettings() types.WorkspaceTransferSettings {
+	settingsMu.RLock()
+	defer settingsMu.RUnlock()
+	return settings
+}
+
+func withDefaults(transferSettings types.WorkspaceTransferSettings) types.WorkspaceTransferSettings {
+	if transferSettings.Parallel <= 0 {
+		transferSettings.Parallel = DEFAULT_PARALLEL
+	}
+	if transferSettings.Retries < 0 {
+		transferSettings.Retries = 0
+	}
+	if transferSettings.MultipartThreshold <= 0 {
+		transferSettings.MultipartThreshold = DEFAULT_MULTIPART_THRESHOLD
+	}
+	if transferSettings.MultipartChunkSize <= 0 {
+		transferSettings.MultipartChunkSize = DEFAULT_MULTIPART_CHUNK_SIZE
+	}
+	return transferSettings
+}
+
+func getLimiter() *bandwidthLimiter {
+	settingsMu.RLock()
+	defer settingsMu.RUnlock()
+	return limiter
+}
+
+// Retry calls f until it succeeds or the retries are used up, waiting twice as long after every
+// failed attempt. The error of the last attempt is returned.
+func Retry(description string, f func() error) error {
+	retries := GetSettings().Retries
+	delay := time.Second
+	for attempt := 0; ; attempt++ {
+		err := f()
+		if err == nil || attempt >= retries {
+			return err
+		}
+		fmt.Printf("Retrying %s in %s (%d/%d): %v\n", description, delay, attempt+1, retries, err)
+		time.Sleep(delay)
+		delay *= 2
+		if delay > maxRetryDelay {
+			delay = maxRetryDelay
+		}
+	}
+}
+
+// Reader limits how fast r can be read to the bandwidth limit, shared by every transfer
+func Reader(r io.Reader) io.Reader {
+	l := getLimiter()
+	if l == nil {
+		return r
+	}
+	return &throttledReader{r: r, limiter: l}
+}
+
+// ReadSeeker limits how fast r can be read to the bandwidth limit, for the request bodies that
+// must be seekable so they can be sent again
+func ReadSeeker(r io.ReadSeeker) io.ReadSeeker {
+	l := getLimiter()
+	if l == nil {
+		return r
+	}
+	return &throttledReadSeeker{throttledReader: throttledReader{r: r, limiter: l}, seeker: r}
+}
+
+// Writer limits how fast w can be written to the bandwidth limit, shared by every transfer
+func Writer(w io.Writer) io.Writer {
+	l := getLimiter()
+	if l == nil {
+		return w
+	}
+	return &throttledWriter{w: w, limiter: l}
+}
+
+// WriterAt limits how fast w can be written to the bandwidth limit, for parallel downloads
+func WriterAt(w io.WriterAt) io.WriterAt {
+	l := getLimiter()
+	if l == nil {
+		return w
+	}
+	return &throttledWriterAt{w: w, limiter: l}
+}
+
+// TMP_FILE_PREFIX marks the files a transfer is still writing. They are renamed into place once
+// complete, so a file is never seen half written, and are left out of listings.
+const TMP_FILE_PREFIX string = ".hyper-tmp-"
+
+// WriteFileAtomic writes a file with write into a temporary file next to it, and renames it into
+// place once written, so a failed or interrupted download never leaves a partial file behind. The
+// file keeps the permissions of the file it replaces, and gets the modification time unless it is
+// zero.
+func WriteFileAtomic(filename string, modTime time.Time, write func(f *os.File) error) error {
+	mode := os.FileMode(0644)
+	if stat, err := os.Stat(filename); err == nil {
+		mode = stat.Mode().Perm()
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(filename), TMP_FILE_PREFIX)
+	if err != nil {
+		return err
+	}
+	err = write(tmp)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Chmod(tmp.Name(), mode)
+	}
+	if err == nil && !modTime.IsZero() {
+		err = os.Chtimes(tmp.Name(), modTime, modTime)
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), filename)
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+	}
+	return err
+}
+
+// bandwidthLimiter is a token bucket holding up to a second of bandwidth. Callers that take more
+// than is available reserve it, and wait until it has been refilled.
+type bandwidthLimiter struct {
+	mu        sync.Mutex
+	rate      float64
+	available float64
+	last      time.Time
+}
+
+func newBandwidthLimiter(bytesPerSecond int64) *bandwidthLimiter {
+	return &bandwidthLimiter{rate: float64(bytesPerSecond), available: float64(bytesPerSecond), last: time.Now()}
+}
+
+func (l *bandwidthLimiter) wait(n int) {
+	l.mu.Lock()
+	now := time.Now()
+	l.available += now.Sub(l.last).Seconds() * l.rate
+	if l.available > l.rate {
+		l.available = l.rate
+	}
+	l.last = now
+	l.available -= float64(n)
+	delay := time.Duration(-l.available / l.rate * float64(time.Second))
+	l.mu.Unlock()
+	if delay > 0 {
+		time.Sleep(delay)
+	}
+}
+
+type throttledReader struct {
+	r       io.Reader
+	limiter *bandwidthLimiter
+}
+
+func (t *throttledReader) Read(p []byte) (int, error) {
+	if len(p) > throttleChunkSize {
+		p = p[:throttleChunkSize]
+	}
+	n, err := t.r.Read(p)
+	t.limiter.wait(n)
+	return n, err
+}
+
+type throttledReadSeeker struct {
+	throttledReader
+	seeker io.Seeker
+}
+
+func (t *throttledReadSeeker) Seek(offset int64, whence int) (int64, error) {
+	return t.seeker.Seek(offset, whence)
+}
+
+type throttledWriter struct {
+	w       io.Writer
+	limiter *bandwidthLimiter
+}
+
+func (t *throttledWriter) Write(p []byte) (int, error) {
+	written := 0
+	for written < len(p) {
+		end := written + throttleChunkSize
+		if end > len(p) {
+			end = len(p)
+		}
+		t.limiter.wait(end - written)
+		n, err := t.w.Write(p[written:end])
+		written += n
+		if err != nil {
+			return written, err
+		}
+	}
+	return written, nil
+}
+
+type throttledWriterAt struct {
+	w       io.WriterAt
+	limiter *bandwidthLimiter
+}
+
+func (t *throttledWriterAt) WriteAt(p []byte, offset int64) (int, error) {
+	written := 0
+	for written < len(p) {
+		end := written + throttleChunkSize
+		if end > len(p) {
+			end = len(p)
+		}
+		t.limiter.wait(end - written)
+		n, err := t.w.WriteAt(p[written:end], offset+int64(written))
+		written += n
+		if err != nil {
+			return written, err
+		}
+	}
+	return written, nil
+}
@@ -3,11 +3,15 @@ package cmd
 import (
 	"errors"
 	"fmt"
+	"github.com/gohypergiant/hyperdrive/hyper/client/encryption"
+	"github.com/gohypergiant/hyperdrive/hyper/client/notify"
 	"github.com/gohypergiant/hyperdrive/hyper/types"
 	"github.com/google/uuid"
 	"log"
 	"os"
+	"path/filepath"
 	"strings"
+	"time"
 
 	"github.com/gohypergiant/hyperdrive/hyper/services/config"
 	"github.com/manifoldco/promptui"
@@ -48,6 +52,50 @@ var workspaceRemotesAddCmd = &cobra.Command{
 		initializeWorkspacePersistenceRemoteConfig()
 	},
 }
+var notificationsCmd = &cobra.Command{
+	Short: "Interact with the notification sinks",
+	Use:   "notifications",
+}
+var notificationsListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List Notification Sinks",
+	Run: func(cmd *cobra.Command, args []string) {
+		for _, sink := range config.GetNotificationSinks() {
+			events := sink.Events
+			if len(events) == 0 {
+				events = types.DefaultNotificationEvents
+			}
+			fmt.Println("sink: ", sink.Url)
+			fmt.Println("    type: ", sink.Type)
+			fmt.Println("    events: ", events)
+		}
+	},
+}
+var notificationsTestCmd = &cobra.Command{
+	Use:   "test",
+	Short: "Send a test notification to every notification sink",
+	Run: func(cmd *cobra.Command, args []string) {
+		sinks := config.GetNotificationSinks()
+		if len(sinks) == 0 {
+			fmt.Println("No notification sinks configured, add them to the notifications of ~/.hyperdrive")
+			os.Exit(1)
+		}
+		host, _ := os.Hostname()
+		failed := false
+		for _, sink := range sinks {
+			err := notify.Send(sink, types.Notification{Event: types.NotifyTest, Source: host, Message: "This is a test notification", Time: time.Now().UTC()})
+			if err != nil {
+				fmt.Printf("%s: %v\n", sink.Url, err)
+				failed = true
+				continue
+			}
+			fmt.Printf("%s: sent\n", sink.Url)
+		}
+		if failed {
+			os.Exit(1)
+		}
+	},
+}
 
 // trainCmd represents the train command
 var configCmd = &cobra.Command{
@@ -65,6 +113,8 @@ var ec2Profile string
 var ec2AccessKey string
 var ec2Secret string
 var ec2Region string
+var ec2Spot bool
+var ec2MaxPrice string
 var workspacePersistenceRemoteName string
 var workspacePersistenceRemoteTypeInput string
 var workspacePersistenceRemoteJupyterAPIKey string
@@ -73,6 +123,25 @@ var workspaceS3AccessKey string
 var workspaceS3Secret string
 var workspaceS3Region string
 var workspaceS3BucketName string
+var workspaceS3Endpoint string
+var workspaceS3PathStyle bool
+var workspaceS3CABundle string
+var workspaceFilesystemPath string
+var workspaceGCSBucketName string
+var workspaceGCSCredentialsFile string
+var workspaceGCSEndpoint string
+var workspaceAzureAccountName string
+var workspaceAzureContainerName string
+var workspaceAzureConnectionString string
+var workspaceAzureSASToken string
+var workspaceAzureAccountKey string
+var workspaceAzureEndpoint string
+var workspaceEncryptionKeyFile string
+var workspaceEncryptionPassphrase string
+
+// WORKSPACE_PASSPHRASE_ENV can hold the workspace encryption passphrase, so it needn't be
+// stored in the config or passed on the command line
+const WORKSPACE_PASSPHRASE_ENV string = "HYPER_WORKSPACE_PASSPHRASE"
 
 func getValidatedString(message string, validate promptui.ValidateFunc) string {
 	prompt := promptui.Prompt{
@@ -154,6 +223,16 @@ func getS3Config() types.WorkspacePersistenceRemoteConfiguration {
 		}
 	}
 
+	if workspaceS3Endpoint == "" {
+		workspaceS3Endpoint = getOptionalString("Enter the endpoint URL of an S3-compatible store such as MinIO or Ceph (leave blank to use AWS S3)")
+		if workspaceS3Endpoint != "" {
+			workspaceS3PathStyle = getYesNo("Use path-style addressing (required by most S3-compatible stores)")
+			if workspaceS3CABundle == "" {
+				workspaceS3CABundle = getOptionalString("Enter the path to a PEM CA bundle to trust for the endpoint (leave blank to use the system roots)")
+			}
+		}
+	}
+
 	if workspaceS3Region == "" {
 		workspaceS3Region = getValidatedString("Enter the region you wish to provision S3 buckets in", func(input string) error {
 			if len(input) <= 0 {
@@ -166,14 +245,47 @@ func getS3Config() types.WorkspacePersistenceRemoteConfiguration {
 	return types.WorkspacePersistenceRemoteConfiguration{
 		Type: types.S3,
 		S3Configuration: types.S3WorkspacePersistenceRemoteConfiguration{
-			Profile:    workspaceS3Profile,
-			AccessKey:  workspaceS3AccessKey,
-			Secret:     workspaceS3Secret,
-			Region:     workspaceS3Region,
-			BucketName: getWorkspaceBucketName(),
+			Profile:        workspaceS3Profile,
+			AccessKey:      workspaceS3AccessKey,
+			Secret:         workspaceS3Secret,
+			Region:         workspaceS3Region,
+			BucketName:     getWorkspaceBucketName(),
+			Endpoint:       workspaceS3Endpoint,
+			ForcePathStyle: workspaceS3PathStyle,
+			CABundle:       getConfigFilePath(workspaceS3CABundle, "CA bundle"),
 		},
 	}
 }
+
+// getConfigFilePath returns the absolute path of a file referenced by the configuration, such
+// as a CA bundle, so the configuration works from any directory
+func getConfigFilePath(path string, description string) string {
+	if path == "" {
+		return ""
+	}
+	absPath, err := filepath.Abs(path)
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+	if _, err := os.Stat(absPath); err != nil {
+		fmt.Printf("Could not read the %s: %v\n", description, err)
+		os.Exit(1)
+	}
+	return absPath
+}
+func getYesNo(message string) bool {
+	prompt := promptui.Select{
+		Label: message,
+		Items: []string{"yes", "no"},
+	}
+	_, result, err := prompt.Run()
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+	return result == "yes"
+}
 func getEC2Config() types.ComputeRemoteConfiguration {
 
 	if ec2Profile == "" {
@@ -217,12 +329,184 @@ func getEC2Config() types.ComputeRemoteConfiguration {
 			AccessKey: ec2AccessKey,
 			Secret:    ec2Secret,
 			Region:    ec2Region,
+			Spot:      ec2Spot,
+			MaxPrice:  ec2MaxPrice,
 		},
 	}
 }
+func getFilesystemConfig() types.WorkspacePersistenceRemoteConfiguration {
+	if workspaceFilesystemPath == "" {
+		workspaceFilesystemPath = getValidatedString("Enter the directory to keep workspaces in, e.g. a mounted NFS share", func(input string) error {
+			if len(input) <= 0 {
+				return errors.New("must provide a directory")
+			}
+			return nil
+		})
+	}
+	absPath, err := filepath.Abs(workspaceFilesystemPath)
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+	if stat, err := os.Stat(absPath); err != nil || !stat.IsDir() {
+		fmt.Printf("%s is not a directory\n", absPath)
+		os.Exit(1)
+	}
+	return types.WorkspacePersistenceRemoteConfiguration{
+		Type:                    types.Filesystem,
+		FilesystemConfiguration: types.FilesystemWorkspacePersistenceRemoteConfiguration{Path: absPath},
+	}
+}
+func getGCSConfig() types.WorkspacePersistenceRemoteConfiguration {
+	if workspaceGCSBucketName == "" {
+		workspaceGCSBucketName = getValidatedString("Enter the name of the GCS bucket to use", func(input string) error {
+			if len(input) <= 0 {
+				return errors.New("must provide a bucket name")
+			}
+			return nil
+		})
+	}
+	if workspaceGCSCredentialsFile == "" {
+		workspaceGCSCredentialsFile = getOptionalString("Enter the path to a service account JSON key (leave blank to use the application default credentials)")
+	}
+	if workspaceGCSEndpoint == "" {
+		workspaceGCSEndpoint = getOptionalString("Enter the endpoint URL of a GCS emulator such as fake-gcs-server (leave blank to use Google Cloud Storage)")
+	}
+	return types.WorkspacePersistenceRemoteConfiguration{
+		Type: types.GCS,
+		GCSConfiguration: types.GCSWorkspacePersistenceRemoteConfiguration{
+			BucketName:      workspaceGCSBucketName,
+			CredentialsFile: getConfigFilePath(workspaceGCSCredentialsFile, "service account key"),
+			Endpoint:        workspaceGCSEndpoint,
+		},
+	}
+}
+func getAzureBlobConfig() types.WorkspacePersistenceRemoteConfiguration {
+	if workspaceAzureConnectionString == "" && workspaceAzureSASToken == "" && workspaceAzureAccountKey == "" {
+		workspaceAzureConnectionString = getOptionalString("Enter the storage account connection string (leave blank to enter an account name and SAS token or key)")
+	}
+
+	// Without a connection string, the account is named and authenticated separately
+	if workspaceAzureConnectionString == "" {
+		if workspaceAzureAccountName == "" {
+			workspaceAzureAccountName = getValidatedString("Enter the name of the storage account", func(input string) error {
+				if len(input) <= 0 {
+					return errors.New("must provide a storage account name")
+				}
+				return nil
+			})
+		}
+		if workspaceAzureSASToken == "" && workspaceAzureAccountKey == "" {
+			workspaceAzureSASToken = getOptionalString("Enter a SAS token for the container (leave blank to enter the account key)")
+		}
+		if workspaceAzureSASToken == "" && workspaceAzureAccountKey == "" {
+			workspaceAzureAccountKey = getValidatedString("Enter the storage account key", func(input string) error {
+				if len(input) <= 0 {
+					return errors.New("must provide an account key")
+				}
+				return nil
+			})
+		}
+	}
+
+	if workspaceAzureContainerName == "" {
+		workspaceAzureContainerName = getValidatedString("Enter the name of the blob container to use", func(input string) error {
+			if len(input) <= 0 {
+				return errors.New("must provide a container name")
+			}
+			return nil
+		})
+	}
+	return types.WorkspacePersistenceRemoteConfiguration{
+		Type: types.AzureBlob,
+		AzureBlobConfiguration: types.AzureBlobWorkspacePersistenceRemoteConfiguration{
+			AccountName:      workspaceAzureAccountName,
+			ContainerName:    workspaceAzureContainerName,
+			ConnectionString: workspaceAzureConnectionString,
+			SASToken:         workspaceAzureSASToken,
+			AccountKey:       workspaceAzureAccountKey,
+			Endpoint:         workspaceAzureEndpoint,
+		},
+	}
+}
+func getEncryptionConfig() types.WorkspaceEncryptionConfiguration {
+	if workspaceEncryptionKeyFile == "" && workspaceEncryptionPassphrase == "" {
+		prompt := promptui.Select{
+			Label: "Encrypt workspace files before they are uploaded",
+			Items: []string{"no", "with a key file", "with a passphrase"},
+		}
+		choice, _, err := prompt.Run()
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+		switch choice {
+		case 1:
+			workspaceEncryptionKeyFile = getOptionalString("Enter the path to the key file (leave blank to generate ~/.hyperdrive-" + workspacePersistenceRemoteName + ".key)")
+			if workspaceEncryptionKeyFile == "" {
+				home, err := os.UserHomeDir()
+				if err != nil {
+					fmt.Println(err)
+					os.Exit(1)
+				}
+				workspaceEncryptionKeyFile = filepath.Join(home, ".hyperdrive-"+workspacePersistenceRemoteName+".key")
+			}
+		case 2:
+			passphrasePrompt := promptui.Prompt{
+				Label: "Enter the passphrase (leave blank to read it from $" + WORKSPACE_PASSPHRASE_ENV + " instead of storing it)",
+				Mask:  '*',
+			}
+			workspaceEncryptionPassphrase, err = passphrasePrompt.Run()
+			if err != nil {
+				fmt.Println(err)
+				os.Exit(1)
+			}
+		}
+	}
+	if workspaceEncryptionKeyFile == "" {
+		return types.WorkspaceEncryptionConfiguration{Passphrase: workspaceEncryptionPassphrase}
+	}
+
+	absPath, err := filepath.Abs(workspaceEncryptionKeyFile)
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+	if _, err := os.Stat(absPath); os.IsNotExist(err) {
+		if err := encryption.GenerateKeyFile(absPath); err != nil {
+			fmt.Println("Could not generate the key file: ", err)
+			os.Exit(1)
+		}
+		log.Printf("A new workspace key has been written to %s. Keep a copy of it somewhere safe, the workspace can't be decrypted without it.", absPath)
+	}
+	if _, err := encryption.LoadKeyFile(absPath); err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+	return types.WorkspaceEncryptionConfiguration{KeyFile: absPath}
+}
 func getWorkspacePersistenceRemoteType() types.WorkspacePersistenceRemoteType {
-	//For now we only support one persistence remote type, but in the future update this to add prompts to configure it
-	return types.S3
+	if workspacePersistenceRemoteTypeInput == "" {
+		prompt := promptui.Select{
+			Label: "Choose a workspace remote type",
+			Items: types.ValidWorkspacePersistenceRemoteTypes,
+		}
+		_, remoteTypeInput, err := prompt.Run()
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+		return types.WorkspacePersistenceRemoteType(remoteTypeInput)
+	}
+	for _, remoteType := range types.ValidWorkspacePersistenceRemoteTypes {
+		if workspacePersistenceRemoteTypeInput == string(remoteType) {
+			return remoteType
+		}
+	}
+
+	fmt.Println("Invalid or unsupported workspace remote type")
+	os.Exit(1)
+	return types.WorkspacePersistenceRemoteType(workspacePersistenceRemoteTypeInput)
 }
 func getComputeRemoteType() types.ComputeRemoteType {
 	if computeRemoteTypeInput == "" {
@@ -271,6 +555,15 @@ func initializeWorkspacePersistenceRemoteConfig() {
 	}
 	remoteType := getWorkspacePersistenceRemoteType()
 	switch remoteType {
+	case types.Filesystem:
+		remoteConfig = getFilesystemConfig()
+		fmt.Printf("Adding %s workspace remote at %s", workspacePersistenceRemoteName, remoteConfig.FilesystemConfiguration.Path)
+	case types.GCS:
+		remoteConfig = getGCSConfig()
+		fmt.Printf("Adding %s workspace remote at gs://%s", workspacePersistenceRemoteName, remoteConfig.GCSConfiguration.BucketName)
+	case types.AzureBlob:
+		remoteConfig = getAzureBlobConfig()
+		fmt.Printf("Adding %s workspace remote for container %s", workspacePersistenceRemoteName, remoteConfig.AzureBlobConfiguration.ContainerName)
 	case types.S3:
 		fallthrough
 	default:
@@ -278,16 +571,17 @@ func initializeWorkspacePersistenceRemoteConfig() {
 		fmt.Printf("Adding %s workspace remote", workspacePersistenceRemoteName)
 		break
 	}
+	remoteConfig.Encryption = getEncryptionConfig()
 
 	config.UpdateWorkspaceRemote(workspacePersistenceRemoteName, remoteConfig)
 }
 func getWorkspaceBucketName() string {
 	if workspaceS3BucketName == "" {
-		workspaceS3BucketName = getOptionalString("Enter the name of the S3 bucket to use. Bucket names must be globally unique. If it doesn't exist we will attempt to create it the first time we sync. (Leave blank to let us generate one)")
+		workspaceS3BucketName = getOptionalString("Enter the name of the S3 bucket to use. Bucket names must be globally unique. If it doesn't exist, create it with `hyper workspace init`. (Leave blank to let us generate one)")
 		if workspaceS3BucketName == "" {
 
 			workspaceS3BucketName = uuid.NewString()
-			log.Printf("A bucket named %s will be created on the first sync if it doesn't exist.", workspaceS3BucketName)
+			log.Printf("Run `hyper workspace init` to create the bucket %s before the first sync.", workspaceS3BucketName)
 		}
 	}
 	return workspaceS3BucketName
@@ -352,18 +646,53 @@ func init() {
 	initCmd.Flags().StringVar(&ec2AccessKey, "ec2AccessKey", "", "AWS Access Key for provisioning EC2 instances")
 	initCmd.Flags().StringVar(&ec2Secret, "ec2Secret", "", "AWS Secret for provisioning EC2 instances")
 	initCmd.Flags().StringVar(&ec2Region, "ec2Region", "", "AWS Region for provisioning EC2 instances")
+	initCmd.Flags().BoolVar(&ec2Spot, "ec2Spot", false, "Start the EC2 instances of the remote as spot instances by default")
+	initCmd.Flags().StringVar(&ec2MaxPrice, "ec2MaxPrice", "", "Default maximum hourly price of the spot instances, in USD")
 
 	/*
 	* Workspace S3 flags
 	 */
-	initCmd.Flags().StringVar(&workspaceS3Profile, "workspaceS3Profile", "", "Named AWS profile to use (from ~/.aws/config)")
-	initCmd.Flags().StringVar(&workspaceS3AccessKey, "workspaceS3AccessKey", "", "AWS Access Key for provisioning S3 instances")
-	initCmd.Flags().StringVar(&workspaceS3Secret, "workspaceS3Secret", "", "AWS Secret for provisioning S3 instances")
-	initCmd.Flags().StringVar(&workspaceS3Region, "workspaceS3Region", "", "AWS Region for provisioning S3 instances")
+	for _, cmd := range []*cobra.Command{initCmd, workspaceRemotesAddCmd} {
+		cmd.Flags().StringVar(&workspaceS3Profile, "workspaceS3Profile", "", "Named AWS profile to use (from ~/.aws/config)")
+		cmd.Flags().StringVar(&workspaceS3AccessKey, "workspaceS3AccessKey", "", "AWS Access Key for provisioning S3 instances")
+		cmd.Flags().StringVar(&workspaceS3Secret, "workspaceS3Secret", "", "AWS Secret for provisioning S3 instances")
+		cmd.Flags().StringVar(&workspaceS3Region, "workspaceS3Region", "", "AWS Region for provisioning S3 instances")
+		cmd.Flags().StringVar(&workspaceS3Endpoint, "workspaceS3Endpoint", "", "Endpoint URL of an S3-compatible store (e.g. https://minio.example.com:9000)")
+		cmd.Flags().BoolVar(&workspaceS3PathStyle, "workspaceS3PathStyle", false, "Use path-style addressing for the S3-compatible store")
+		cmd.Flags().StringVar(&workspaceS3CABundle, "workspaceS3CABundle", "", "PEM CA bundle to trust for the S3-compatible store")
+	}
+	for _, cmd := range []*cobra.Command{initCmd, workspaceRemotesAddCmd} {
+		cmd.Flags().StringVar(&workspacePersistenceRemoteTypeInput, "workspaceRemoteType", "", "Workspace remote type [s3|filesystem|gcs|azureblob]")
+		cmd.Flags().StringVar(&workspaceFilesystemPath, "workspacePath", "", "Directory to keep workspaces in, for filesystem workspace remotes")
+	}
+	/*
+	* Workspace GCS and Azure Blob Storage flags
+	 */
+	for _, cmd := range []*cobra.Command{initCmd, workspaceRemotesAddCmd} {
+		cmd.Flags().StringVar(&workspaceGCSBucketName, "workspaceGCSBucketName", "", "Name of the GCS bucket to use")
+		cmd.Flags().StringVar(&workspaceGCSCredentialsFile, "workspaceGCSCredentialsFile", "", "Service account JSON key for accessing the GCS bucket")
+		cmd.Flags().StringVar(&workspaceGCSEndpoint, "workspaceGCSEndpoint", "", "Endpoint URL of a GCS emulator (e.g. http://localhost:4443/storage/v1/)")
+		cmd.Flags().StringVar(&workspaceAzureAccountName, "workspaceAzureAccountName", "", "Name of the Azure storage account")
+		cmd.Flags().StringVar(&workspaceAzureContainerName, "workspaceAzureContainerName", "", "Name of the blob container to use")
+		cmd.Flags().StringVar(&workspaceAzureConnectionString, "workspaceAzureConnectionString", "", "Connection string of the Azure storage account")
+		cmd.Flags().StringVar(&workspaceAzureSASToken, "workspaceAzureSASToken", "", "SAS token for accessing the blob container")
+		cmd.Flags().StringVar(&workspaceAzureAccountKey, "workspaceAzureAccountKey", "", "Key of the Azure storage account")
+		cmd.Flags().StringVar(&workspaceAzureEndpoint, "workspaceAzureEndpoint", "", "Blob endpoint of the storage account, e.g. for Azurite")
+	}
+	/*
+	* Workspace encryption flags
+	 */
+	for _, cmd := range []*cobra.Command{initCmd, workspaceRemotesAddCmd} {
+		cmd.Flags().StringVar(&workspaceEncryptionKeyFile, "workspaceEncryptionKeyFile", "", "Key file to encrypt workspace files with, generated if it doesn't exist")
+		cmd.Flags().StringVar(&workspaceEncryptionPassphrase, "workspaceEncryptionPassphrase", "", "Passphrase to encrypt workspace files with")
+	}
+	workspaceRemotesAddCmd.Flags().StringVar(&workspacePersistenceRemoteName, "workspaceRemoteName", "", "Name of the workspace remote")
+	workspaceRemotesAddCmd.Flags().StringVar(&workspaceS3BucketName, "workspaceS3BucketName", "", "Name of the S3 bucket to use")
 	rootCmd.AddCommand(configCmd)
 	configCmd.AddCommand(initCmd)
 	configCmd.AddCommand(computeRemotesCmd)
 	configCmd.AddCommand(workspaceRemotesCmd)
+	configCmd.AddCommand(notificationsCmd)
 
 	//remote subcommands
 	computeRemotesCmd.AddCommand(computeRemotesListCmd)
@@ -372,4 +701,7 @@ func init() {
 	//
 	//workspaceRemotesCmd.AddCommand(workspaceRemotesListCmd)
 	workspaceRemotesCmd.AddCommand(workspaceRemotesAddCmd)
+
+	notificationsCmd.AddCommand(notificationsListCmd)
+	notificationsCmd.AddCommand(notificationsTestCmd)
 }
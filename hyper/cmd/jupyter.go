@@ -18,10 +18,12 @@ package cmd
 import (
 	"fmt"
 	"math/rand"
+	"os"
 	"time"
 
 	"github.com/gohypergiant/hyperdrive/hyper/client/cli"
 	"github.com/gohypergiant/hyperdrive/hyper/services/notebook"
+	"github.com/gohypergiant/hyperdrive/hyper/services/remote"
 	"github.com/gohypergiant/hyperdrive/hyper/types"
 	"github.com/spf13/cobra"
 	"log"
@@ -42,6 +44,14 @@ var (
 	amiID           string
 	hostPort        string
 	jupyterApiKey   string
+	jupyterCPUs     float64
+	jupyterMemory   string
+	waitForRemote   bool
+	waitTimeout     time.Duration
+	useSpot         bool
+	spotMaxPrice    string
+	idleTimeout     time.Duration
+	idleAction      string
 )
 
 func checkPortAvailability(port string) bool {
@@ -95,6 +105,28 @@ func getPort(isRemote bool) int {
 	return port
 }
 
+// getEC2StartOptions returns the options of the instance to start. The spot default of the remote
+// is only overridden if --spot is given, and --maxPrice implies it. The idle shutdown is only
+// set up by the commands that have an --idleTimeout.
+func getEC2StartOptions(cmd *cobra.Command, wait bool, timeout time.Duration) types.EC2StartOptions {
+	options := types.EC2StartOptions{InstanceType: ec2InstanceType, AmiId: amiID, Wait: wait, WaitTimeout: timeout, MaxPrice: spotMaxPrice}
+	if cmd.Flags().Lookup("idleTimeout") != nil {
+		if idleAction != string(types.IdleStop) && idleAction != string(types.IdleTerminate) {
+			fmt.Printf("Invalid --idleAction %q, must be one of %v\n", idleAction, types.ValidIdleActions)
+			os.Exit(1)
+		}
+		options.IdleTimeout = idleTimeout
+		options.IdleAction = types.IdleAction(idleAction)
+	}
+	if cmd.Flags().Changed("spot") {
+		options.Spot = &useSpot
+	} else if spotMaxPrice != "" {
+		spot := true
+		options.Spot = &spot
+	}
+	return options
+}
+
 // jupyterCmd represents the jupyter command
 var jupyterCmd = &cobra.Command{
 	Use:   "jupyter",
@@ -110,6 +142,8 @@ var jupyterCmd = &cobra.Command{
 			APIKey:        jupyterApiKey,
 			S3AwsProfile:  s3AwsProfile,
 			HostPort:      getPort(RemoteName != ""),
+			CPUs:          jupyterCPUs,
+			Memory:        parseMemory(jupyterMemory),
 		}
 		notebook.NotebookService(
 			RemoteName,
@@ -118,7 +152,7 @@ var jupyterCmd = &cobra.Command{
 			s3AccessSecret,
 			s3Region).Start(
 			launchOptions,
-			types.EC2StartOptions{InstanceType: ec2InstanceType, AmiId: amiID},
+			getEC2StartOptions(cmd, waitForRemote, waitTimeout),
 			getWorkspaceSyncOptions(),
 		)
 	},
@@ -172,7 +206,13 @@ func init() {
 	jupyterCmd.AddCommand(jupyterStopCmd)
 	jupyterCmd.AddCommand(jupyterRemoteHost)
 
+	jupyterCmd.Flags().Float64Var(&jupyterCPUs, "cpus", 0, "Limit the number of CPUs the local jupyter container can use")
+	jupyterCmd.Flags().StringVar(&jupyterMemory, "memory", "", "Limit the memory the local jupyter container can use, e.g. 4g")
 	jupyterCmd.Flags().BoolVarP(&jupyterBrowser, "browser", "", false, "Open jupyter in a browser after launching")
+	jupyterCmd.Flags().BoolVar(&waitForRemote, "wait", false, "With --remote, wait until jupyter lab is ready on the instance")
+	jupyterCmd.Flags().DurationVar(&waitTimeout, "waitTimeout", remote.DefaultWaitTimeout, "How long to wait for jupyter lab to be ready")
+	jupyterCmd.Flags().DurationVar(&idleTimeout, "idleTimeout", 0, "With --remote, shut the instance down after this long without notebook activity, e.g. 1h (Default: never)")
+	jupyterCmd.Flags().StringVar(&idleAction, "idleAction", string(types.IdleStop), "What to do with the idle instance [stop|terminate]")
 	jupyterCmd.PersistentFlags().BoolVarP(&pullImage, "pull", "", false, "Pull latest image before running")
 	jupyterCmd.PersistentFlags().BoolVarP(&requirements, "requirements", "", false, "Install more packages from a requirements.txt file")
 	jupyterCmd.PersistentFlags().StringVar(&image, "image", "pytorch", "Image to be used [huggingface-pytorch|huggingface-tensorflow|pytorch|spark|tensorflow|xgboost]")
@@ -182,6 +222,8 @@ func init() {
 	jupyterCmd.PersistentFlags().StringVar(&s3AwsProfile, "s3AwsProfile", "", "Named AWS profile")
 	jupyterCmd.PersistentFlags().StringVar(&ec2InstanceType, "ec2InstanceType", "", "The type of EC2 instance to be created")
 	jupyterCmd.PersistentFlags().StringVar(&amiID, "amiId", "", "The ID of the AMI")
+	jupyterCmd.PersistentFlags().BoolVar(&useSpot, "spot", false, "Start the EC2 instance as a spot instance (Default: the spot setting of the remote)")
+	jupyterCmd.PersistentFlags().StringVar(&spotMaxPrice, "maxPrice", "", "Maximum hourly price of the spot instance, in USD (Default: the on-demand price)")
 	jupyterCmd.PersistentFlags().StringVar(&jupyterApiKey, "apiKey", "", "API key to use for the jupyter instance")
 	jupyterCmd.PersistentFlags().StringVar(&hostPort, "hostPort", "-1", "Host port for container")
 	jupyterCmd.PersistentFlags().StringVarP(&workspaceRemoteName, "workspaceRemote", "r", "", "name of the jupyter remote to use for syncing")
@@ -191,5 +233,10 @@ func init() {
 	jupyterCmd.PersistentFlags().StringVar(&workspaceS3Token, "workspaceS3Token", "", "AWS Token for accessing S3 buckets [Overrides workspaceRemote]")
 	jupyterCmd.PersistentFlags().StringVar(&workspaceS3Region, "workspaceS3Region", "", "AWS Region for accessing S3 buckets [Overrides workspaceRemote]")
 	jupyterCmd.PersistentFlags().StringVar(&workspaceS3BucketName, "workspaceS3BucketName", "", "Bucket name for accessing S3 buckets [Overrides workspaceRemote]")
+	jupyterCmd.PersistentFlags().StringVar(&workspaceS3Endpoint, "workspaceS3Endpoint", "", "Endpoint URL of an S3-compatible store [Overrides workspaceRemote]")
+	jupyterCmd.PersistentFlags().BoolVar(&workspaceS3PathStyle, "workspaceS3PathStyle", false, "Use path-style addressing for the S3-compatible store [Overrides workspaceRemote]")
+	jupyterCmd.PersistentFlags().StringVar(&workspaceS3CABundle, "workspaceS3CABundle", "", "PEM CA bundle to trust for the S3-compatible store [Overrides workspaceRemote]")
+	jupyterCmd.PersistentFlags().StringVar(&workspaceEncryptionKeyFile, "workspaceEncryptionKeyFile", "", "Key file to encrypt workspace files with [Overrides workspaceRemote]")
+	jupyterCmd.PersistentFlags().StringVar(&workspaceEncryptionPassphrase, "workspaceEncryptionPassphrase", "", "Passphrase to encrypt workspace files with, also read from $"+WORKSPACE_PASSPHRASE_ENV+" [Overrides workspaceRemote]")
 	jupyterStopCmd.Flags().StringVar(&mountPoint, "mountPoint", "", "Mount Point of Jupyter Server to be stopped")
 }
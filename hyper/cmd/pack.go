@@ -53,7 +53,7 @@ var runCmd = &cobra.Command{
 			dockerfileSavePath,
 			imageTags,
 			types.JupyterLaunchOptions{},
-			types.EC2StartOptions{InstanceType: ec2InstanceType, AmiId: amiID},
+			getEC2StartOptions(cmd, false, 0),
 			getWorkspaceSyncOptions(),
 			types.DockerOptions{HostPort: portInt, LocalOnly: localOnly})
 	},
@@ -71,7 +71,7 @@ var buildCmd = &cobra.Command{
 		if dockerfileSavePath == "" {
 			dockerfileSavePath = fmt.Sprintf("./%s.Dockerfile", studyName)
 		}
-		fmt.Println("🚀 Building hyperpackage %s. Dockerfile will be saved to ", dockerfileSavePath)
+		fmt.Printf("🚀 Building hyperpackage %s. Dockerfile will be saved to %s\n", hyperpackagePath, dockerfileSavePath)
 		hyperpackage.HyperpackageService(hyperpackagePath, manifestPath, RemoteName).Build(dockerfileSavePath, imageTags, types.WorkspaceSyncOptions{})
 	},
 }
@@ -133,8 +133,15 @@ func init() {
 	packCmd.PersistentFlags().StringVar(&workspaceS3Token, "workspaceS3Token", "", "AWS Token for accessing S3 buckets [Overrides workspaceRemote]")
 	packCmd.PersistentFlags().StringVar(&workspaceS3Region, "workspaceS3Region", "", "AWS Region for accessing S3 buckets [Overrides workspaceRemote]")
 	packCmd.PersistentFlags().StringVar(&workspaceS3BucketName, "workspaceS3BucketName", "", "Bucket name for accessing S3 buckets [Overrides workspaceRemote]")
+	packCmd.PersistentFlags().StringVar(&workspaceS3Endpoint, "workspaceS3Endpoint", "", "Endpoint URL of an S3-compatible store [Overrides workspaceRemote]")
+	packCmd.PersistentFlags().BoolVar(&workspaceS3PathStyle, "workspaceS3PathStyle", false, "Use path-style addressing for the S3-compatible store [Overrides workspaceRemote]")
+	packCmd.PersistentFlags().StringVar(&workspaceS3CABundle, "workspaceS3CABundle", "", "PEM CA bundle to trust for the S3-compatible store [Overrides workspaceRemote]")
+	packCmd.PersistentFlags().StringVar(&workspaceEncryptionKeyFile, "workspaceEncryptionKeyFile", "", "Key file to encrypt workspace files with [Overrides workspaceRemote]")
+	packCmd.PersistentFlags().StringVar(&workspaceEncryptionPassphrase, "workspaceEncryptionPassphrase", "", "Passphrase to encrypt workspace files with, also read from $"+WORKSPACE_PASSPHRASE_ENV+" [Overrides workspaceRemote]")
 	runCmd.PersistentFlags().StringVar(&ec2InstanceType, "ec2InstanceType", "", "The type of EC2 instance to be created")
 	runCmd.PersistentFlags().StringVar(&amiID, "amiId", "", "The ID of the AMI")
+	runCmd.PersistentFlags().BoolVar(&useSpot, "spot", false, "Start the EC2 instance as a spot instance (Default: the spot setting of the remote)")
+	runCmd.PersistentFlags().StringVar(&spotMaxPrice, "maxPrice", "", "Maximum hourly price of the spot instance, in USD (Default: the on-demand price)")
 	runCmd.PersistentFlags().StringVar(&hostPort, "hostPort", "-1", "Host port for container")
 	runCmd.PersistentFlags().BoolVarP(&localOnly, "localOnly", "", true, "Make API accessible only locally (localhost)")
 	packCmd.AddCommand(stopCmd)
@@ -0,0 +1,91 @@
+/*
+Copyright © 2022 Hypergiant, LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package cmd
+
+import (
+	"time"
+
+	"github.com/gohypergiant/hyperdrive/hyper/services/remote"
+	"github.com/gohypergiant/hyperdrive/hyper/types"
+	"github.com/spf13/cobra"
+)
+
+var (
+	watchRemoteStatus   bool
+	remoteStatusHistory bool
+	remoteWaitTimeout   time.Duration
+	waitForResume       bool
+	resumeWaitTimeout   time.Duration
+)
+
+var remoteCmd = &cobra.Command{
+	Use:   "remote",
+	Short: "Manage the instance of the study on a compute remote",
+}
+
+var remoteInstanceStatusCmd = &cobra.Command{
+	Use:   "status",
+	Short: "Show the status the instance of the study reports",
+	Run: func(cmd *cobra.Command, args []string) {
+		remote.RemoteService(RemoteName, manifestPath).Status(types.RemoteStatusOptions{
+			Watch:   watchRemoteStatus,
+			History: remoteStatusHistory,
+			Timeout: remoteWaitTimeout,
+		})
+	},
+}
+
+var remotePauseCmd = &cobra.Command{
+	Use:   "pause",
+	Short: "Stop the instance of the study, keeping its disk and network",
+	Run: func(cmd *cobra.Command, args []string) {
+		remote.RemoteService(RemoteName, manifestPath).Pause()
+	},
+}
+
+var remoteResumeCmd = &cobra.Command{
+	Use:   "resume",
+	Short: "Start the paused instance of the study",
+	Run: func(cmd *cobra.Command, args []string) {
+		remote.RemoteService(RemoteName, manifestPath).Resume(types.RemoteResumeOptions{
+			Wait:    waitForResume,
+			Timeout: resumeWaitTimeout,
+		})
+	},
+}
+
+var remoteDestroyCmd = &cobra.Command{
+	Use:   "destroy",
+	Short: "Terminate the instance of the study and tear down its network",
+	Run: func(cmd *cobra.Command, args []string) {
+		remote.RemoteService(RemoteName, manifestPath).Destroy()
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(remoteCmd)
+	remoteCmd.AddCommand(remoteInstanceStatusCmd)
+	remoteCmd.AddCommand(remotePauseCmd)
+	remoteCmd.AddCommand(remoteResumeCmd)
+	remoteCmd.AddCommand(remoteDestroyCmd)
+
+	remoteInstanceStatusCmd.Flags().BoolVarP(&watchRemoteStatus, "watch", "w", false, "Follow the status until the instance is ready or has failed")
+	remoteInstanceStatusCmd.Flags().BoolVar(&remoteStatusHistory, "history", false, "List every status update of the instance")
+	remoteInstanceStatusCmd.Flags().DurationVar(&remoteWaitTimeout, "timeout", remote.DefaultWaitTimeout, "In watch mode, how long to wait for the instance to be ready")
+
+	remoteResumeCmd.Flags().BoolVar(&waitForResume, "wait", false, "Wait until jupyter lab is ready on the resumed instance")
+	remoteResumeCmd.Flags().DurationVar(&resumeWaitTimeout, "waitTimeout", remote.DefaultWaitTimeout, "How long to wait for jupyter lab to be ready")
+}
@@ -16,36 +16,93 @@ limitations under the License.
 package cmd
 
 import (
+	"strconv"
+	"time"
+
 	"github.com/gohypergiant/hyperdrive/hyper/services/status"
+	"github.com/gohypergiant/hyperdrive/hyper/types"
 	"github.com/spf13/cobra"
 )
 
 var (
 	statusEndpointPort		string
 	statusFilePath				string
+	statusPhase					string
+	statusProgress				int
+	statusBindAddress			string
+	statusToken					string
+	statusTLS					bool
+	statusFingerprintFile		string
+	statusWorkspacePath			string
+	statusNotificationsFile		string
+	idleShutdownTimeout		time.Duration
+	idleShutdownAction			string
+	idleJupyterUrl				string
+	idleJupyterToken			string
+	idleSyncScript				string
 )
 
 var remoteStatusCmd = &cobra.Command{
 	Use:   "remoteStatus",
 	Short: "Summons an endpoint to obtain the status of the remote server",
 	Run: func(cmd *cobra.Command, args []string) {
-		status.StartEndpoint(statusEndpointPort, statusFilePath)
+		status.StartEndpoint(types.RemoteStatusEndpointOptions{
+			Port:            statusEndpointPort,
+			StatusFilePath:  statusFilePath,
+			WorkspacePath:   statusWorkspacePath,
+			BindAddress:     statusBindAddress,
+			Token:           statusToken,
+			TLS:             statusTLS,
+			FingerprintFile: statusFingerprintFile,
+		})
 	},
 }
 
 var remoteStatusUpdateCmd = &cobra.Command{
-	Use:   "update",
+	Use:   "update [message]",
 	Short: "Updates the status of the remote server",
+	Args:  cobra.MaximumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		status.UpdateStatus(args, statusFilePath, statusPhase, statusProgress, statusNotificationsFile)
+	},
+}
+
+var remoteStatusIdleShutdownCmd = &cobra.Command{
+	Use:   "idleShutdown",
+	Short: "Shuts the remote server down once its notebook has been idle for the idle timeout",
 	Run: func(cmd *cobra.Command, args []string) {
-		status.UpdateStatus(args, statusFilePath)
+		status.WatchIdle(types.IdleShutdownOptions{
+			Timeout:           idleShutdownTimeout,
+			Action:            types.IdleAction(idleShutdownAction),
+			JupyterUrl:        idleJupyterUrl,
+			JupyterToken:      idleJupyterToken,
+			SyncScript:        idleSyncScript,
+			StatusFilePath:    statusFilePath,
+			NotificationsFile: statusNotificationsFile,
+		})
 	},
 }
 
 func init() {
 	rootCmd.AddCommand(remoteStatusCmd)
 	remoteStatusCmd.AddCommand(remoteStatusUpdateCmd)
+	remoteStatusCmd.AddCommand(remoteStatusIdleShutdownCmd)
 	
-	remoteStatusCmd.Flags().StringVar(&statusEndpointPort, "port", "3001", "Override the default remotestatus port")
-	remoteStatusCmd.Flags().StringVar(&statusFilePath, "statusFile", "/statusfile.json", "Override the default statusfile path")
+	remoteStatusCmd.Flags().StringVar(&statusEndpointPort, "port", strconv.Itoa(status.DEFAULT_PORT), "Override the default remotestatus port")
+	remoteStatusCmd.Flags().StringVar(&statusBindAddress, "bind", "", "Interface address to listen on, e.g. 127.0.0.1 (Default: all interfaces)")
+	remoteStatusCmd.Flags().StringVar(&statusToken, "token", "", "Bearer token requests must carry, also read from $"+status.STATUS_TOKEN_ENV)
+	remoteStatusCmd.Flags().BoolVar(&statusTLS, "tls", false, "Serve TLS with a self-signed certificate generated at start")
+	remoteStatusCmd.Flags().StringVar(&statusFingerprintFile, "tlsFingerprintFile", "", "File to write the SHA-256 fingerprint of the certificate to, for clients to pin it")
+	remoteStatusCmd.Flags().StringVar(&statusWorkspacePath, "workspace", "", "Path of the workspace synced with workspace sync --watch, to report its syncs with the metrics")
+	remoteStatusCmd.PersistentFlags().StringVar(&statusFilePath, "statusFile", "/statusfile.json", "Override the default statusfile path")
+	remoteStatusUpdateCmd.Flags().StringVar(&statusPhase, "phase", "", "Phase of the remote server [provisioning|pulling-workspace|launching-notebook|ready|failed|interrupted|paused|terminated|training-pending|training|training-completed|training-failed] (Default: the current phase)")
+	remoteStatusUpdateCmd.Flags().IntVar(&statusProgress, "progress", -1, "Progress of the phase, as a percentage")
+	remoteStatusUpdateCmd.Flags().StringVar(&statusNotificationsFile, "notificationsFile", "", "JSON file of the sinks to notify of phase changes (Default: the notifications of the config)")
+	remoteStatusIdleShutdownCmd.Flags().DurationVar(&idleShutdownTimeout, "idleTimeout", 0, "How long the notebook can go without activity")
+	remoteStatusIdleShutdownCmd.Flags().StringVar(&idleShutdownAction, "idleAction", string(types.IdleStop), "What the instance is set to do as it shuts down, reported with its final status [stop|terminate]")
+	remoteStatusIdleShutdownCmd.Flags().StringVar(&idleJupyterUrl, "jupyterUrl", "http://localhost:8888", "URL of the notebook server")
+	remoteStatusIdleShutdownCmd.Flags().StringVar(&idleJupyterToken, "jupyterToken", "", "Token of the notebook server's API")
+	remoteStatusIdleShutdownCmd.Flags().StringVar(&idleSyncScript, "syncScript", "", "Script that syncs the workspace before shutting down")
+	remoteStatusIdleShutdownCmd.Flags().StringVar(&statusNotificationsFile, "notificationsFile", "", "JSON file of the sinks to notify of phase changes (Default: the notifications of the config)")
 
 }
@@ -19,15 +19,31 @@ package cmd
 import (
 	"fmt"
 	"github.com/gohypergiant/hyperdrive/hyper/client/manifest"
+	"github.com/gohypergiant/hyperdrive/hyper/services/config"
 	"github.com/gohypergiant/hyperdrive/hyper/services/notebook"
+	"github.com/gohypergiant/hyperdrive/hyper/services/training"
+	"github.com/gohypergiant/hyperdrive/hyper/services/workspace"
+	"github.com/gohypergiant/hyperdrive/hyper/types"
 	"os"
-	"os/exec"
+	"runtime"
 
+	"github.com/docker/go-units"
 	"github.com/spf13/cobra"
 )
 
 var (
-	fetchTimeout int
+	fetchTimeout       int
+	stageData          bool
+	manifestOverrides  []string
+	trainCPUs          float64
+	trainMemory        string
+	jobCPUs            float64
+	jobMemory          string
+	workerConcurrency  int
+	workerCPUs         float64
+	workerMemory       string
+	workerFollow       bool
+	trainingStatusJson bool
 )
 
 // trainCmd represents the train command
@@ -36,51 +52,250 @@ var trainCmd = &cobra.Command{
 	Short: "Train a model",
 	Run: func(cmd *cobra.Command, args []string) {
 		fmt.Println("🚂choo choo🚂")
+		_, studyManifest, err := manifest.ResolveManifest(manifestPath, manifestOverrides)
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+		trainingJobOptions := types.TrainingJobOptions{StageRemoteData: stageData, Overrides: manifestOverrides}
+		if hasRemoteDataSources(studyManifest) {
+			trainingJobOptions.SyncOptions = getWorkspaceSyncOptions()
+		}
 		notebookService := notebook.NotebookService(RemoteName, manifestPath, s3AccessKey, s3AccessSecret, s3Region)
-		notebookService.UploadTrainingJobData()
+		job := notebookService.UploadTrainingJobData(trainingJobOptions)
+		training.RecordSubmittedRun(job, RemoteName)
 		fmt.Println("Ready to execute training...")
 
 		if RemoteName == "" {
 			fmt.Println("Executing local hypertraining...")
-
-			studyManifest := manifest.GetManifest(manifestPath)
-
-			features := studyManifest.Training.Data.Features.Source
-			target := studyManifest.Training.Data.Target.Source
-			containerName, jobName := studyManifest.StudyName, studyManifest.StudyName
-			studyYaml := fmt.Sprintf("/home/jovyan/_jobs/%s/_study.yaml", jobName)
-			notebookOutPath := fmt.Sprintf("/home/jovyan/_jobs/%s/outs.ipynb", jobName)
-
-			_, err := exec.Command("docker", "exec", containerName, "papermill",
-				"/home/jovyan/.executor/notebooks/executor-low-code.ipynb", notebookOutPath,
-				"-p", "features", features, "-p", "target", target, "-p", "job_name", jobName,
-				"-p", "study_yaml", studyYaml).Output()
-			if err != nil {
-				fmt.Println("Error with papermill execution in the docker container: ", err)
-				os.Exit(1)
+			containerOptions := types.TrainingContainerOptions{
+				Flavor:    image,
+				PullImage: pullImage,
+				CPUs:      trainCPUs,
+				Memory:    parseMemory(trainMemory),
+			}
+			if manifest.IsRemoteSource(job.Metadata.FeaturesSource) || manifest.IsRemoteSource(job.Metadata.TargetSource) {
+				containerOptions.Env = getExecutorCredentialEnv(trainingJobOptions.SyncOptions.S3Config)
+				containerOptions.CABundle = trainingJobOptions.SyncOptions.S3Config.CABundle
 			}
+			jobsPath := notebook.LocalNotebookService{ManifestPath: manifestPath}.GetJobsPath()
+			training.RunTrainingContainer(job, jobsPath, containerOptions)
 		}
 
 		fmt.Println("To look for a completed hyperpackage, use the fetch subcommand.")
 	},
 }
+
+func hasRemoteDataSources(studyManifest types.Manifest) bool {
+	return manifest.IsRemoteSource(studyManifest.Training.Data.Features.Source) ||
+		manifest.IsRemoteSource(studyManifest.Training.Data.Target.Source)
+}
+
+// getExecutorCredentialEnv returns the container environment that hands the workspace remote
+// credentials to the executor so it can read remote data sources itself. s3fs reads its options
+// for S3-compatible stores from FSSPEC_S3.
+func getExecutorCredentialEnv(s3Config types.S3WorkspacePersistenceRemoteConfiguration) []string {
+	if s3Config.Profile != "" {
+		namedProfileConfig := config.GetNamedProfileConfig(s3Config.Profile)
+		s3Config.AccessKey = namedProfileConfig.AccessKey
+		s3Config.Secret = namedProfileConfig.Secret
+		s3Config.Token = namedProfileConfig.Token
+	}
+	env := []string{
+		fmt.Sprintf("AWS_ACCESS_KEY_ID=%s", s3Config.AccessKey),
+		fmt.Sprintf("AWS_SECRET_ACCESS_KEY=%s", s3Config.Secret),
+		fmt.Sprintf("AWS_SESSION_TOKEN=%s", s3Config.Token),
+		fmt.Sprintf("AWS_DEFAULT_REGION=%s", s3Config.Region),
+	}
+	if s3Config.Endpoint != "" {
+		env = append(env, fmt.Sprintf("AWS_ENDPOINT_URL_S3=%s", s3Config.Endpoint))
+	}
+	if s3Config.ForcePathStyle {
+		env = append(env, `FSSPEC_S3={"config_kwargs": {"s3": {"addressing_style": "path"}}}`)
+	}
+	return env
+}
+
 var fetchCmd = &cobra.Command{
 	Use:   "fetch",
 	Short: "fetch resulting hyperpackage from training session",
 	Run: func(cmd *cobra.Command, args []string) {
 		fmt.Println("🥎🐕 Fetching")
-		notebookService := notebook.NotebookService(RemoteName, manifestPath, s3AccessKey, s3AccessSecret, s3Region)
-		notebookService.WaitForTrainingToComplete(fetchTimeout)
-		notebookService.DownloadHyperpack()
+		trainingStatus := training.WaitForTrainingToComplete(training.TrainingStatusProvider(RemoteName, manifestPath), manifest.GetName(manifestPath), fetchTimeout)
+		hyperpackPath := downloadHyperpack()
+		training.CompleteLatestRun(manifest.GetName(manifestPath), hyperpackPath, trainingStatus.UpdatedAt)
+	},
+}
+
+// downloadHyperpack downloads the hyperpack of the study's training, and returns where it was
+// saved. EC2 instances train in the workspace they sync, so their hyperpack is in its bucket.
+func downloadHyperpack() string {
+	if RemoteName != "" && config.GetComputeRemote(RemoteName).Type == types.EC2 {
+		workspaceSyncOptions := getWorkspaceSyncOptions()
+		workspace.WorkspaceService(workspaceRemoteName, manifestPath, workspaceSyncOptions).Pack(workspaceSyncOptions.StudyName, "")
+		return workspaceSyncOptions.StudyName + ".hyperpack.zip"
+	}
+	notebookService := notebook.NotebookService(RemoteName, manifestPath, s3AccessKey, s3AccessSecret, s3Region)
+	notebookService.DownloadHyperpack()
+	return notebookService.GetHyperpackSavePath()
+}
+
+var trainingStatusCmd = &cobra.Command{
+	Use:   "status",
+	Short: "Show the status of the training of the study",
+	Run: func(cmd *cobra.Command, args []string) {
+		training.PrintTrainingStatus(training.TrainingStatusProvider(RemoteName, manifestPath), trainingStatusJson)
+	},
+}
+
+var historyCmd = &cobra.Command{
+	Use:   "history",
+	Short: "List the archived training runs of the study",
+	Run: func(cmd *cobra.Command, args []string) {
+		training.PrintHistory(manifest.GetName(manifestPath))
+	},
+}
+
+var compareCmd = &cobra.Command{
+	Use:   "compare <run1> <run2>",
+	Short: "Compare the metrics, data and manifest of two training runs",
+	Args:  cobra.ExactArgs(2),
+	Run: func(cmd *cobra.Command, args []string) {
+		training.CompareRuns(manifest.GetName(manifestPath), args[0], args[1])
+	},
+}
+
+var submitCmd = &cobra.Command{
+	Use:   "submit",
+	Short: "Add a training job for the study to the local training queue",
+	Run: func(cmd *cobra.Command, args []string) {
+		if RemoteName != "" {
+			fmt.Println("The training queue runs jobs on this host, --remote is not supported")
+			os.Exit(1)
+		}
+		// resolve the manifest now so a bad manifest or override fails at submission, not overnight
+		_, studyManifest, err := manifest.ResolveManifest(manifestPath, manifestOverrides)
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+		studyPath, err := os.Getwd()
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+		job := training.SubmitJob(types.QueuedTrainingJob{
+			StudyName:       studyManifest.StudyName,
+			StudyPath:       studyPath,
+			ManifestPath:    manifestPath,
+			Overrides:       manifestOverrides,
+			Flavor:          image,
+			StageRemoteData: stageData,
+			WorkspaceRemote: workspaceRemoteName,
+			CPUs:            jobCPUs,
+			Memory:          parseMemory(jobMemory),
+		})
+		fmt.Printf("Submitted job %s for study %s\n", job.Id, job.StudyName)
+		fmt.Println("Run `hyper train worker` to process the queue, and `hyper train queue` to follow it.")
 	},
 }
 
+var queueCmd = &cobra.Command{
+	Use:   "queue",
+	Short: "List the jobs in the local training queue",
+	Run: func(cmd *cobra.Command, args []string) {
+		training.PrintQueue()
+	},
+}
+
+var queueCancelCmd = &cobra.Command{
+	Use:   "cancel <job id>",
+	Short: "Cancel a queued or running training job",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		training.CancelJob(args[0])
+	},
+}
+
+var queueClearCmd = &cobra.Command{
+	Use:   "clear",
+	Short: "Remove finished jobs from the local training queue",
+	Run: func(cmd *cobra.Command, args []string) {
+		training.ClearFinishedJobs()
+	},
+}
+
+var workerCmd = &cobra.Command{
+	Use:   "worker",
+	Short: "Run the jobs in the local training queue",
+	Run: func(cmd *cobra.Command, args []string) {
+		if workerConcurrency < 1 {
+			fmt.Println("--concurrency must be at least 1")
+			os.Exit(1)
+		}
+		training.RunWorker(types.TrainingWorkerOptions{
+			Concurrency: workerConcurrency,
+			CPUs:        workerCPUs,
+			Memory:      parseMemory(workerMemory),
+			Follow:      workerFollow,
+		})
+	},
+}
+
+// parseMemory parses a docker style memory size (e.g. 512m, 4g), an empty size means no limit
+func parseMemory(memory string) int64 {
+	if memory == "" {
+		return 0
+	}
+	bytes, err := units.RAMInBytes(memory)
+	if err != nil {
+		fmt.Printf("Invalid memory size %q: %v\n", memory, err)
+		os.Exit(1)
+	}
+	return bytes
+}
+
 func init() {
 	fetchCmd.Flags().IntVarP(&fetchTimeout, "fetchTimeout", "t", 3600, "Timeout in seconds to wait for training to complete (default 3600)")
 	trainCmd.AddCommand(fetchCmd)
+	trainCmd.AddCommand(trainingStatusCmd)
+	trainingStatusCmd.Flags().BoolVar(&trainingStatusJson, "json", false, "Print the status as JSON, in the schema of the remote status endpoint")
+	trainCmd.AddCommand(historyCmd)
+	trainCmd.AddCommand(compareCmd)
+	trainCmd.AddCommand(submitCmd)
+	trainCmd.AddCommand(queueCmd)
+	trainCmd.AddCommand(workerCmd)
+	queueCmd.AddCommand(queueCancelCmd)
+	queueCmd.AddCommand(queueClearCmd)
+	submitCmd.Flags().StringVar(&image, "image", "pytorch", "Image to be used [huggingface-pytorch|huggingface-tensorflow|pytorch|spark|tensorflow|xgboost]")
+	submitCmd.Flags().StringArrayVar(&manifestOverrides, "set", []string{}, "Override a study manifest value for this run only, e.g. --set n_trials=50 (repeatable)")
+	submitCmd.Flags().BoolVar(&stageData, "stageData", false, "Download remote (s3://) data sources and copy them into the job instead of letting the executor read them directly")
+	submitCmd.Flags().Float64Var(&jobCPUs, "cpus", 1, "Number of CPUs the job needs from the worker budget")
+	submitCmd.Flags().StringVar(&jobMemory, "memory", "", "Memory the job needs from the worker budget, e.g. 4g")
+	workerCmd.Flags().IntVar(&workerConcurrency, "concurrency", 1, "Maximum number of jobs to run at the same time")
+	workerCmd.Flags().Float64Var(&workerCPUs, "cpus", float64(runtime.NumCPU()), "Total CPUs available to running jobs (0 for no limit)")
+	workerCmd.Flags().StringVar(&workerMemory, "memory", "", "Total memory available to running jobs, e.g. 16g (no limit if empty)")
+	workerCmd.Flags().BoolVar(&workerFollow, "follow", false, "Keep waiting for new jobs once the queue is drained")
 	trainCmd.Flags().StringVar(&image, "image", "pytorch", "Image to be used [huggingface-pytorch|huggingface-tensorflow|pytorch|spark|tensorflow|xgboost]")
 	trainCmd.Flags().StringVar(&s3AccessKey, "s3AccessKey", "", "S3 Access Key to use")
 	trainCmd.Flags().StringVar(&s3AccessSecret, "s3AccessSecret", "", "S3 Secret to use")
 	trainCmd.Flags().StringVar(&s3Region, "s3Region", "", "S3 Region")
+	trainCmd.Flags().BoolVar(&pullImage, "pull", false, "Pull latest image before running the training container")
+	trainCmd.Flags().Float64Var(&trainCPUs, "cpus", 0, "Limit the number of CPUs the training container can use")
+	trainCmd.Flags().StringVar(&trainMemory, "memory", "", "Limit the memory the training container can use, e.g. 4g")
+	trainCmd.Flags().StringArrayVar(&manifestOverrides, "set", []string{}, "Override a study manifest value for this run only, e.g. --set n_trials=50 (repeatable)")
+	trainCmd.Flags().BoolVar(&stageData, "stageData", false, "Download remote (s3://) data sources and copy them into the job instead of letting the executor read them directly")
+	trainCmd.PersistentFlags().StringVarP(&workspaceRemoteName, "workspaceRemote", "r", "", "name of the workspace remote whose credentials are used to read remote data sources")
+	trainCmd.PersistentFlags().StringVar(&workspaceS3Profile, "workspaceS3Profile", "", "Named AWS profile to use (from ~/.aws/config) [Overrides workspaceRemote]")
+	trainCmd.PersistentFlags().StringVar(&workspaceS3AccessKey, "workspaceS3AccessKey", "", "AWS Access Key for accessing S3 buckets [Overrides workspaceRemote]")
+	trainCmd.PersistentFlags().StringVar(&workspaceS3Secret, "workspaceS3Secret", "", "AWS Secret for accessing S3 buckets [Overrides workspaceRemote]")
+	trainCmd.PersistentFlags().StringVar(&workspaceS3Token, "workspaceS3Token", "", "AWS Token for accessing S3 buckets [Overrides workspaceRemote]")
+	trainCmd.PersistentFlags().StringVar(&workspaceS3Region, "workspaceS3Region", "", "AWS Region for accessing S3 buckets [Overrides workspaceRemote]")
+	trainCmd.PersistentFlags().StringVar(&workspaceS3BucketName, "workspaceS3BucketName", "", "Bucket name for accessing S3 buckets [Overrides workspaceRemote]")
+	trainCmd.PersistentFlags().StringVar(&workspaceS3Endpoint, "workspaceS3Endpoint", "", "Endpoint URL of an S3-compatible store [Overrides workspaceRemote]")
+	trainCmd.PersistentFlags().BoolVar(&workspaceS3PathStyle, "workspaceS3PathStyle", false, "Use path-style addressing for the S3-compatible store [Overrides workspaceRemote]")
+	trainCmd.PersistentFlags().StringVar(&workspaceS3CABundle, "workspaceS3CABundle", "", "PEM CA bundle to trust for the S3-compatible store [Overrides workspaceRemote]")
+	trainCmd.PersistentFlags().StringVar(&workspaceEncryptionKeyFile, "workspaceEncryptionKeyFile", "", "Key file to encrypt workspace files with [Overrides workspaceRemote]")
+	trainCmd.PersistentFlags().StringVar(&workspaceEncryptionPassphrase, "workspaceEncryptionPassphrase", "", "Passphrase to encrypt workspace files with, also read from $"+WORKSPACE_PASSPHRASE_ENV+" [Overrides workspaceRemote]")
 	rootCmd.AddCommand(trainCmd)
 }
@@ -2,7 +2,11 @@ package cmd
 
 import (
 	"fmt"
+	"os"
+	"time"
 
+	"github.com/docker/go-units"
+	"github.com/gohypergiant/hyperdrive/hyper/client/transfer"
 	"github.com/gohypergiant/hyperdrive/hyper/services/config"
 	"github.com/gohypergiant/hyperdrive/hyper/services/notebook"
 	"github.com/gohypergiant/hyperdrive/hyper/services/workspace"
@@ -12,11 +16,26 @@ import (
 
 var (
 	watchSync           = false
+	watchDebounce       time.Duration
+	watchPullInterval   time.Duration
+	watchEventQueueUrl  string
+	conflictPolicy      string
+	dryRun              bool
 	localWorkspacePath  string
 	workspaceRemoteName string
 	workspaceS3Token    string
 	studyName           string
 	remotePackPath      string
+	snapshotMessage     string
+	decryptOutputPath   string
+	maxBandwidth        string
+	parallelTransfers   int
+	transferRetries     int
+	multipartThreshold  string
+	multipartChunkSize  string
+	bucketVersioning    bool
+	expireJobsAfter     int64
+	abortUploadsAfter   int64
 )
 
 var workspaceCmd = &cobra.Command{
@@ -28,8 +47,27 @@ var workspaceSyncCmd = &cobra.Command{
 	Short: "sync",
 	Run: func(cmd *cobra.Command, args []string) {
 		//notebook.NotebookService(RemoteName, manifestPath, s3AccessKey, s3AccessSecret, s3Region).List()
+		if watchSync && dryRun {
+			fmt.Println("--dry-run can't be used with --watch")
+			os.Exit(1)
+		}
+		workspaceSyncOptions := getWorkspaceSyncOptions()
+		workspace.WorkspaceService(workspaceRemoteName, manifestPath, workspaceSyncOptions).Sync(localWorkspacePath, studyName, types.WorkspaceSyncSettings{
+			Watch:          watchSync,
+			Debounce:       watchDebounce,
+			PullInterval:   watchPullInterval,
+			EventQueueUrl:  watchEventQueueUrl,
+			ConflictPolicy: getConflictPolicy(),
+			DryRun:         dryRun,
+		})
+	},
+}
+var workspaceStatusCmd = &cobra.Command{
+	Use:   "status",
+	Short: "Show the changes and conflicts the next sync would have to handle",
+	Run: func(cmd *cobra.Command, args []string) {
 		workspaceSyncOptions := getWorkspaceSyncOptions()
-		workspace.WorkspaceService(workspaceRemoteName, manifestPath, workspaceSyncOptions.S3Config).Sync(localWorkspacePath, watchSync, studyName)
+		workspace.WorkspaceService(workspaceRemoteName, manifestPath, workspaceSyncOptions).Status(localWorkspacePath, studyName)
 	},
 }
 var workspacePullCmd = &cobra.Command{
@@ -38,7 +76,7 @@ var workspacePullCmd = &cobra.Command{
 	Run: func(cmd *cobra.Command, args []string) {
 		//notebook.NotebookService(RemoteName, manifestPath, s3AccessKey, s3AccessSecret, s3Region).List()
 		workspaceSyncOptions := getWorkspaceSyncOptions()
-		workspace.WorkspaceService(workspaceRemoteName, manifestPath, workspaceSyncOptions.S3Config).Pull(localWorkspacePath, studyName)
+		workspace.WorkspaceService(workspaceRemoteName, manifestPath, workspaceSyncOptions).Pull(localWorkspacePath, studyName, dryRun)
 	},
 }
 var workspacePackCmd = &cobra.Command{
@@ -47,10 +85,67 @@ var workspacePackCmd = &cobra.Command{
 	Run: func(cmd *cobra.Command, args []string) {
 		//notebook.NotebookService(RemoteName, manifestPath, s3AccessKey, s3AccessSecret, s3Region).List()
 		workspaceSyncOptions := getWorkspaceSyncOptions()
-		workspace.WorkspaceService(workspaceRemoteName, manifestPath, workspaceSyncOptions.S3Config).Pack(studyName, remotePackPath)
+		workspace.WorkspaceService(workspaceRemoteName, manifestPath, workspaceSyncOptions).Pack(studyName, remotePackPath)
+	},
+}
+var workspaceSnapshotCmd = &cobra.Command{
+	Use:   "snapshot",
+	Short: "Record the current state of the remote workspace",
+	Run: func(cmd *cobra.Command, args []string) {
+		workspaceSyncOptions := getWorkspaceSyncOptions()
+		workspace.WorkspaceService(workspaceRemoteName, manifestPath, workspaceSyncOptions).Snapshot(studyName, snapshotMessage)
+	},
+}
+var workspaceSnapshotsCmd = &cobra.Command{
+	Use:   "snapshots",
+	Short: "List the snapshots of the remote workspace",
+	Run: func(cmd *cobra.Command, args []string) {
+		workspaceSyncOptions := getWorkspaceSyncOptions()
+		workspace.WorkspaceService(workspaceRemoteName, manifestPath, workspaceSyncOptions).Snapshots(studyName)
+	},
+}
+var workspaceDecryptCmd = &cobra.Command{
+	Use:   "decrypt <file>",
+	Short: "Decrypt a file downloaded from an encrypted workspace remote, such as a hyperpack",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		workspaceSyncOptions := getWorkspaceSyncOptions()
+		workspace.WorkspaceService(workspaceRemoteName, manifestPath, workspaceSyncOptions).Decrypt(args[0], decryptOutputPath)
+	},
+}
+var workspaceInitCmd = &cobra.Command{
+	Use:   "init",
+	Short: "Create the bucket of the workspace remote, and configure it securely",
+	Run: func(cmd *cobra.Command, args []string) {
+		workspaceSyncOptions := getWorkspaceSyncOptions()
+		workspace.Init(workspaceRemoteName, workspaceSyncOptions, types.WorkspaceInitSettings{
+			Versioning:                      bucketVersioning,
+			ExpireJobsAfterDays:             expireJobsAfter,
+			AbortIncompleteUploadsAfterDays: abortUploadsAfter,
+		})
+	},
+}
+var workspaceRestoreCmd = &cobra.Command{
+	Use:   "restore <snapshot> [paths]",
+	Short: "Restore files from a snapshot, on the remote and locally",
+	Args:  cobra.MinimumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		workspaceSyncOptions := getWorkspaceSyncOptions()
+		workspace.WorkspaceService(workspaceRemoteName, manifestPath, workspaceSyncOptions).Restore(localWorkspacePath, studyName, args[0], args[1:])
 	},
 }
 
+func getConflictPolicy() types.ConflictPolicy {
+	for _, policy := range types.ValidConflictPolicies {
+		if string(policy) == conflictPolicy {
+			return policy
+		}
+	}
+	fmt.Printf("Invalid conflict policy %q, must be one of %v\n", conflictPolicy, types.ValidConflictPolicies)
+	os.Exit(1)
+	return ""
+}
+
 func workspaceS3IsManuallySpecified() bool {
 	if workspaceRemoteName != "" {
 		return false
@@ -79,33 +174,107 @@ func getWorkspaceSyncOptions() types.WorkspaceSyncOptions {
 
 	if workspaceRemoteName != "" {
 		remoteConfig := config.GetWorkspacePersistenceRemote(workspaceRemoteName)
+		workpaceSyncOptions.Type = remoteConfig.Type
 		workpaceSyncOptions.S3Config = remoteConfig.S3Configuration
+		workpaceSyncOptions.FilesystemConfig = remoteConfig.FilesystemConfiguration
+		workpaceSyncOptions.GCSConfig = remoteConfig.GCSConfiguration
+		workpaceSyncOptions.AzureBlobConfig = remoteConfig.AzureBlobConfiguration
+	} else if workspaceFilesystemPath != "" {
+		workpaceSyncOptions.Type = types.Filesystem
+		workpaceSyncOptions.FilesystemConfig = types.FilesystemWorkspacePersistenceRemoteConfiguration{Path: workspaceFilesystemPath}
 	} else if workspaceS3IsManuallySpecified() {
+		workpaceSyncOptions.Type = types.S3
 
 		workpaceSyncOptions.S3Config = types.S3WorkspacePersistenceRemoteConfiguration{
-			Secret:     workspaceS3Secret,
-			AccessKey:  workspaceS3AccessKey,
-			Token:      workspaceS3Token,
-			Profile:    workspaceS3Profile,
-			BucketName: workspaceS3BucketName,
-			Region:     workspaceS3Region,
+			Secret:         workspaceS3Secret,
+			AccessKey:      workspaceS3AccessKey,
+			Token:          workspaceS3Token,
+			Profile:        workspaceS3Profile,
+			BucketName:     workspaceS3BucketName,
+			Region:         workspaceS3Region,
+			Endpoint:       workspaceS3Endpoint,
+			ForcePathStyle: workspaceS3PathStyle,
+			CABundle:       workspaceS3CABundle,
 		}
 
 	} else {
 		fmt.Println("Warning: workspace sync not configured")
 	}
+	workpaceSyncOptions.Encryption = getWorkspaceEncryption(workpaceSyncOptions.Encryption)
+	workpaceSyncOptions.Transfer = types.WorkspaceTransferSettings{
+		MaxBandwidth:       parseTransferSize("--max-bandwidth", maxBandwidth),
+		Parallel:           parallelTransfers,
+		Retries:            transferRetries,
+		MultipartThreshold: parseTransferSize("--multipart-threshold", multipartThreshold),
+		MultipartChunkSize: parseTransferSize("--multipart-chunk-size", multipartChunkSize),
+	}
 	return workpaceSyncOptions
 }
+
+// parseTransferSize parses a size such as 512k or 8MB, in multiples of 1024. An empty size is
+// left to the default.
+func parseTransferSize(flag string, size string) int64 {
+	if size == "" {
+		return 0
+	}
+	bytes, err := units.RAMInBytes(size)
+	if err != nil || bytes <= 0 {
+		fmt.Printf("Invalid size %q for %s\n", size, flag)
+		os.Exit(1)
+	}
+	return bytes
+}
+
+// getWorkspaceEncryption overrides the encryption of the workspace remote with the encryption
+// flags, or the HYPER_WORKSPACE_PASSPHRASE environment variable
+func getWorkspaceEncryption(encryption types.WorkspaceEncryptionConfiguration) types.WorkspaceEncryptionConfiguration {
+	if workspaceEncryptionPassphrase == "" {
+		workspaceEncryptionPassphrase = os.Getenv(WORKSPACE_PASSPHRASE_ENV)
+	}
+	if workspaceEncryptionKeyFile != "" {
+		return types.WorkspaceEncryptionConfiguration{KeyFile: workspaceEncryptionKeyFile}
+	}
+	if workspaceEncryptionPassphrase != "" {
+		return types.WorkspaceEncryptionConfiguration{Passphrase: workspaceEncryptionPassphrase}
+	}
+	return encryption
+}
 func init() {
 	rootCmd.AddCommand(workspaceCmd)
 	workspaceCmd.AddCommand(workspaceSyncCmd)
 	workspaceCmd.AddCommand(workspacePullCmd)
+	workspaceCmd.AddCommand(workspaceStatusCmd)
 	workspaceCmd.AddCommand(workspacePackCmd)
+	workspaceCmd.AddCommand(workspaceSnapshotCmd)
+	workspaceCmd.AddCommand(workspaceSnapshotsCmd)
+	workspaceCmd.AddCommand(workspaceRestoreCmd)
+	workspaceCmd.AddCommand(workspaceDecryptCmd)
+	workspaceCmd.AddCommand(workspaceInitCmd)
 
 	workspaceSyncCmd.Flags().BoolVarP(&watchSync, "watch", "w", false, "Run sync in watch mode")
+	workspaceSyncCmd.Flags().DurationVar(&watchDebounce, "debounce", workspace.DefaultWatchDebounce, "In watch mode, how long a file must be left unchanged before it is pushed")
+	workspaceSyncCmd.Flags().DurationVar(&watchPullInterval, "pullInterval", workspace.DefaultWatchPullInterval, "In watch mode, how often remote changes are pulled")
+	workspaceSyncCmd.Flags().StringVar(&watchEventQueueUrl, "eventQueueUrl", "", "In watch mode, pull remote changes from this SQS queue of the bucket's S3 event notifications instead of on an interval")
 	workspaceSyncCmd.Flags().StringVarP(&localWorkspacePath, "localWorkspacePath", "l", "", "Local workspace path to sync")
+	workspaceSyncCmd.Flags().StringVar(&conflictPolicy, "onConflict", string(types.ConflictKeepBoth), "What to do with files modified on both sides since the last sync [keep-both|prefer-local|prefer-remote|abort]")
+	workspaceSyncCmd.Flags().BoolVar(&dryRun, "dry-run", false, "List what would be transferred without changing anything")
+	workspacePullCmd.Flags().BoolVar(&dryRun, "dry-run", false, "List what would be transferred without changing anything")
+	workspaceStatusCmd.Flags().StringVarP(&localWorkspacePath, "localWorkspacePath", "l", "", "Local workspace path to sync")
 	workspacePullCmd.Flags().StringVarP(&localWorkspacePath, "localWorkspacePath", "l", "", "Local workspace path to sync")
+	workspaceRestoreCmd.Flags().StringVarP(&localWorkspacePath, "localWorkspacePath", "l", "", "Local workspace path to sync")
+	workspaceSnapshotCmd.Flags().StringVarP(&snapshotMessage, "message", "m", "", "Description of the snapshot")
 	workspacePackCmd.Flags().StringVarP(&remotePackPath, "remotePackPath", "", "", "Path to pack zip file")
+	for _, cmd := range []*cobra.Command{workspaceSyncCmd, workspacePullCmd, workspacePackCmd} {
+		cmd.Flags().StringVar(&maxBandwidth, "max-bandwidth", "", "Limit the bandwidth of all transfers together, per second, e.g. 2M [default: unlimited]")
+		cmd.Flags().IntVar(&parallelTransfers, "parallel", transfer.DEFAULT_PARALLEL, "How many files, or parts of a file, are transferred at once")
+		cmd.Flags().IntVar(&transferRetries, "retries", transfer.DEFAULT_RETRIES, "How many times a failed transfer is retried")
+		cmd.Flags().StringVar(&multipartThreshold, "multipart-threshold", "8M", "Files of at least this size are transferred in parts")
+		cmd.Flags().StringVar(&multipartChunkSize, "multipart-chunk-size", "8M", "Size of the parts large files are transferred in")
+	}
+	workspaceInitCmd.Flags().BoolVar(&bucketVersioning, "versioning", true, "Turn on versioning, which snapshots and restores rely on")
+	workspaceInitCmd.Flags().Int64Var(&expireJobsAfter, "expireJobsAfter", 0, "Delete the study's _jobs artifacts this many days after they are written [default: never]")
+	workspaceInitCmd.Flags().Int64Var(&abortUploadsAfter, "abortIncompleteUploadsAfter", 7, "Clean up the parts of uploads that were never completed after this many days")
+	workspaceDecryptCmd.Flags().StringVarP(&decryptOutputPath, "output", "o", "", "Where to write the decrypted file [default: in place]")
 
 	workspaceCmd.PersistentFlags().StringVarP(&workspaceRemoteName, "remote", "r", "", "name of the workspace remote to use for syncing")
 	workspaceCmd.PersistentFlags().StringVar(&workspaceS3Profile, "s3Profile", "", "Named AWS profile to use (from ~/.aws/config) [Overrides workspaceRemote]")
@@ -114,5 +283,11 @@ func init() {
 	workspaceCmd.PersistentFlags().StringVar(&workspaceS3Token, "s3Token", "", "AWS Token for accessing S3 buckets [Overrides workspaceRemote]")
 	workspaceCmd.PersistentFlags().StringVar(&workspaceS3Region, "s3Region", "", "AWS Region for accessing S3 buckets [Overrides workspaceRemote]")
 	workspaceCmd.PersistentFlags().StringVar(&workspaceS3BucketName, "s3BucketName", "", "Bucket name for accessing S3 buckets [Overrides workspaceRemote]")
+	workspaceCmd.PersistentFlags().StringVar(&workspaceS3Endpoint, "s3Endpoint", "", "Endpoint URL of an S3-compatible store [Overrides workspaceRemote]")
+	workspaceCmd.PersistentFlags().BoolVar(&workspaceS3PathStyle, "s3PathStyle", false, "Use path-style addressing for the S3-compatible store [Overrides workspaceRemote]")
+	workspaceCmd.PersistentFlags().StringVar(&workspaceS3CABundle, "s3CABundle", "", "PEM CA bundle to trust for the S3-compatible store [Overrides workspaceRemote]")
+	workspaceCmd.PersistentFlags().StringVar(&workspaceFilesystemPath, "fsPath", "", "Directory to use as a filesystem workspace remote, e.g. a mounted NFS share [Overrides workspaceRemote]")
+	workspaceCmd.PersistentFlags().StringVar(&workspaceEncryptionKeyFile, "encryptionKeyFile", "", "Key file to encrypt workspace files with [Overrides workspaceRemote]")
+	workspaceCmd.PersistentFlags().StringVar(&workspaceEncryptionPassphrase, "encryptionPassphrase", "", "Passphrase to encrypt workspace files with, also read from $"+WORKSPACE_PASSPHRASE_ENV+" [Overrides workspaceRemote]")
 	workspaceCmd.PersistentFlags().StringVarP(&studyName, "studyName", "n", "", "Bucket name for accessing S3 buckets [Overrides workspaceRemote]")
 }
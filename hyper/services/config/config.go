@@ -76,6 +76,15 @@ func GetWorkspacePersistenceRemote(name string) types.WorkspacePersistenceRemote
 	remotes := GetWorkspacePersistenceRemotes()
 	return remotes[name]
 }
+func GetNotificationSinks() []types.NotificationSinkConfiguration {
+	var sinks []types.NotificationSinkConfiguration
+	err := viper.UnmarshalKey("notifications", &sinks)
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+	return sinks
+}
 func UpdateComputeRemote(name string, configuration types.ComputeRemoteConfiguration) {
 	var config types.Configuration
 	err := viper.Unmarshal(&config)
@@ -13,6 +13,7 @@ import (
 	"github.com/gohypergiant/hyperdrive/hyper/client/cli"
 	"github.com/gohypergiant/hyperdrive/hyper/client/manifest"
 	"github.com/gohypergiant/hyperdrive/hyper/services/notebook"
+	"github.com/gohypergiant/hyperdrive/hyper/services/workspace"
 	"github.com/gohypergiant/hyperdrive/hyper/types"
 )
 
@@ -33,9 +34,19 @@ func (s LocalHyperpackageService) BuildAndRun(dockerfileSavePath string, imageTa
 	s.Run(runTag, dockerOptions)
 }
 func (s LocalHyperpackageService) Build(dockerfileSavePath string, imageTags []string, syncOptions types.WorkspaceSyncOptions) {
+	if syncOptions.Encryption.IsEnabled() && syncOptions.S3Config.IsValid() {
+		// the image can't decrypt the hyperpack it would read from S3, so it's fetched and
+		// decrypted here and built into the image instead
+		hyperpackKey := fmt.Sprintf("_jobs/%[1]s/%[1]s.hyperpack.zip", syncOptions.StudyName)
+		if err := workspace.WorkspaceService("", s.ManifestPath, syncOptions).Fetch(syncOptions.StudyName, hyperpackKey, s.HyperpackagePath); err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+		syncOptions.S3Config = types.S3WorkspacePersistenceRemoteConfiguration{}
+	}
 	dockerClient := cli.NewDockerClient()
 	dockerClient.CreateDockerFile(s.HyperpackagePath, dockerfileSavePath, false, syncOptions)
-	dockerClient.BuildImage(strings.TrimLeft(dockerfileSavePath, "./"), imageTags)
+	dockerClient.BuildImage(strings.TrimLeft(dockerfileSavePath, "./"), imageTags, s.HyperpackagePath)
 }
 func (s LocalHyperpackageService) Run(imageTag string, dockerOptions types.DockerOptions) {
 	var hostIP, hostPort string
@@ -2,10 +2,12 @@ package hyperpackage
 
 import (
 	"fmt"
+	"os"
 
 	"github.com/gohypergiant/hyperdrive/hyper/client/aws"
 	"github.com/gohypergiant/hyperdrive/hyper/client/manifest"
 	"github.com/gohypergiant/hyperdrive/hyper/services/config"
+	"github.com/gohypergiant/hyperdrive/hyper/services/status"
 	"github.com/gohypergiant/hyperdrive/hyper/types"
 )
 
@@ -32,8 +34,12 @@ func (s RemoteHyperpackageService) BuildAndRun(dockerfileSavePath string, imageT
 			s.RemoteConfiguration.EC2Configuration.Region = namedProfileConfig.Region
 			s.RemoteConfiguration.EC2Configuration.Token = namedProfileConfig.Token
 		}
+		if syncOptions.Type != types.S3 && syncOptions.Type != "" {
+			fmt.Printf("%s workspace remotes can't be used from EC2 instances, please use an s3 workspace remote\n", syncOptions.Type)
+			os.Exit(1)
+		}
 		jupyterOptions.HostPort = 8888
-		aws.StartHyperpackageEC2(s.ManifestPath, s.RemoteConfiguration.EC2Configuration, ec2Options.InstanceType, ec2Options.AmiId, syncOptions, dockerOptions)
+		aws.StartHyperpackageEC2(s.ManifestPath, s.RemoteConfiguration.EC2Configuration, ec2Options, syncOptions, dockerOptions, status.DeriveToken(s.RemoteConfiguration.JupyterAPIKey))
 	} else {
 		fmt.Println("Not Implemented")
 	}
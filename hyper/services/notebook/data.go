@@ -0,0 +1,165 @@
+package notebook
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"time"
+
+	"github.com/gohypergiant/hyperdrive/hyper/client/aws"
+	"github.com/gohypergiant/hyperdrive/hyper/client/manifest"
+	"github.com/gohypergiant/hyperdrive/hyper/types"
+	"github.com/google/uuid"
+	"gopkg.in/yaml.v2"
+)
+
+const stagedDataDir string = "data"
+
+// resolveRemoteSource validates that a remote training data source can be read with the workspace
+// remote credentials. When stage is set, the object is downloaded to a temporary file and the
+// returned source is relative to the job directory; otherwise the URI is returned unchanged.
+// Staged sources are named after the data they hold, e.g. features or target, so sources with the
+// same base name don't collide. The second return value is the staged local file, or "" when
+// nothing was staged, to be removed with removeStagedSource once it is uploaded, and the third is
+// a checksum identifying the version of the data that was used.
+func resolveRemoteSource(source string, name string, s3Config types.S3WorkspacePersistenceRemoteConfiguration, stage bool) (string, string, string, error) {
+	if (types.S3WorkspacePersistenceRemoteConfiguration{}) == s3Config {
+		return "", "", "", fmt.Errorf("%s is a remote data source. Please specify a workspace remote (--workspaceRemote) or S3 credentials to access it", source)
+	}
+	bucket, key, err := aws.ParseS3Uri(source)
+	if err != nil {
+		return "", "", "", err
+	}
+	etag, err := aws.CheckObjectAccess(s3Config, bucket, key)
+	if err != nil {
+		return "", "", "", err
+	}
+	if !stage {
+		fmt.Printf("Executor will read %s directly\n", source)
+		return source, "", fmt.Sprintf("etag:%s", etag), nil
+	}
+
+	stagingDir, err := ioutil.TempDir("", "hyper-staging")
+	if err != nil {
+		return "", "", "", err
+	}
+	stagedName := fmt.Sprintf("%s-%s", name, path.Base(key))
+	localPath := filepath.Join(stagingDir, stagedName)
+	fmt.Printf("Staging %s locally\n", source)
+	err = aws.DownloadObjectFromBucket(s3Config, bucket, key, localPath)
+	if err != nil {
+		os.RemoveAll(stagingDir)
+		return "", "", "", err
+	}
+	return path.Join(stagedDataDir, stagedName), localPath, getFileChecksum(localPath), nil
+}
+
+// removeStagedSource removes the temporary directory a remote source was staged in
+func removeStagedSource(stagedPath string) {
+	if stagedPath == "" {
+		return
+	}
+	if err := os.RemoveAll(filepath.Dir(stagedPath)); err != nil {
+		fmt.Println(err)
+	}
+}
+
+func getFileChecksum(filePath string) string {
+	f, err := os.Open(filePath)
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+	defer f.Close()
+
+	hash := sha256.New()
+	if _, err := io.Copy(hash, f); err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+	return fmt.Sprintf("sha256:%s", hex.EncodeToString(hash.Sum(nil)))
+}
+
+func newRunId() string {
+	return fmt.Sprintf("%s-%s", time.Now().UTC().Format("20060102-150405"), uuid.NewString()[:8])
+}
+
+// getJobManifest resolves the manifest for a training job with the command line overrides applied
+func getJobManifest(manifestPath string, options types.TrainingJobOptions) (yaml.MapSlice, types.Manifest) {
+	document, manifestConfig, err := manifest.ResolveManifest(manifestPath, options.Overrides)
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+	return document, manifestConfig
+}
+
+// marshalJobManifest returns the study manifest to upload alongside the job. If any remote data
+// source was staged, its source is rewritten to point at the staged copy. Without overrides or
+// staging the manifest is uploaded as it is on disk.
+func marshalJobManifest(manifestPath string, document yaml.MapSlice, manifestConfig types.Manifest, sources types.TrainingDataSources, options types.TrainingJobOptions) []byte {
+	features := manifestConfig.Training.Data.Features.Source
+	target := manifestConfig.Training.Data.Target.Source
+	if len(options.Overrides) == 0 && features == sources.Features && target == sources.Target {
+		manifestBytes, err := ioutil.ReadFile(manifestPath)
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+		return manifestBytes
+	}
+
+	var err error
+	if features != sources.Features {
+		document, err = manifest.SetValue(document, []string{"training", "data", "features", "source"}, sources.Features)
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+	}
+	if target != sources.Target {
+		document, err = manifest.SetValue(document, []string{"training", "data", "target", "source"}, sources.Target)
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+	}
+	manifestBytes, err := yaml.Marshal(document)
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+	return manifestBytes
+}
+
+func getJobMetadata(manifestConfig types.Manifest, sources types.TrainingDataSources, checksums map[string]string, options types.TrainingJobOptions) types.TrainingJobMetadata {
+	overrides := options.Overrides
+	if overrides == nil {
+		overrides = []string{}
+	}
+	return types.TrainingJobMetadata{
+		RunId:          newRunId(),
+		StudyName:      manifestConfig.StudyName,
+		ProjectName:    manifestConfig.ProjectName,
+		SubmittedAt:    time.Now().UTC(),
+		Overrides:      overrides,
+		FeaturesSource: sources.Features,
+		TargetSource:   sources.Target,
+		DataChecksums:  checksums,
+	}
+}
+
+func marshalJobMetadata(metadata types.TrainingJobMetadata) []byte {
+	metadataBytes, err := json.MarshalIndent(metadata, "", "  ")
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+	return metadataBytes
+}
@@ -120,6 +120,10 @@ func (s LocalNotebookService) Start(jupyterOptions types.JupyterLaunchOptions, _
 			},
 		},
 		RestartPolicy: restartPolicy,
+		Resources: container.Resources{
+			NanoCPUs: int64(jupyterOptions.CPUs * 1e9),
+			Memory:   jupyterOptions.Memory,
+		},
 	}
 
 	if jupyterOptions.Requirements {
@@ -131,7 +135,7 @@ func (s LocalNotebookService) Start(jupyterOptions types.JupyterLaunchOptions, _
 			}
 		}
 		dockerClient.CreateDockerFile("", "Dockerfile.reqs", true, types.WorkspaceSyncOptions{})
-		dockerClient.BuildImage("Dockerfile.reqs", []string{imageName})
+		dockerClient.BuildImage("Dockerfile.reqs", []string{imageName}, "requirements.txt")
 
 		createdIdReqs, errReqs := dockerClient.CreateContainer(imageName, name, contConfig, hostConfig, false)
 		id = createdIdReqs
@@ -230,25 +234,63 @@ func (s LocalNotebookService) Stop(mountPoint string) {
 	}
 
 }
-func (s LocalNotebookService) UploadTrainingJobData() {
+func (s LocalNotebookService) UploadTrainingJobData(options types.TrainingJobOptions) types.TrainingJob {
 
-	manifestConfig := manifest.GetManifest(s.ManifestPath)
+	document, manifestConfig := getJobManifest(s.ManifestPath, options)
 	//Right now, these two are the same, but in the future I'm sure that will change
 	//studyName := manifestConfig.StudyName
 	//notebookName := GetNotebookName(s.ManifestPath)
 	jobsPath := s.GetJobsPath()
+	sources := types.TrainingDataSources{}
+	checksums := map[string]string{}
 
 	fmt.Println("Uploading features data")
 	//upload data
-	featuresDataFilePath := strings.TrimLeft(manifestConfig.Training.Data.Features.Source, "./")
-	s.CopyFile(featuresDataFilePath, fmt.Sprintf("%s/%s", jobsPath, featuresDataFilePath))
+	sources.Features, checksums["features"] = s.uploadDataSource(manifestConfig.Training.Data.Features.Source, "features", jobsPath, options)
 	fmt.Println("Uploading target data")
-	targetDataFilePath := strings.TrimLeft(manifestConfig.Training.Data.Target.Source, "./")
-	s.CopyFile(targetDataFilePath, fmt.Sprintf("%s/%s", jobsPath, targetDataFilePath))
+	sources.Target, checksums["target"] = s.uploadDataSource(manifestConfig.Training.Data.Target.Source, "target", jobsPath, options)
 	fmt.Println("Uploading Study Manifest")
-	s.CopyFile(s.ManifestPath, fmt.Sprintf("%s/_study.yaml", jobsPath))
+	job := types.TrainingJob{
+		Metadata: getJobMetadata(manifestConfig, sources, checksums, options),
+		Manifest: marshalJobManifest(s.ManifestPath, document, manifestConfig, sources, options),
+	}
+	s.WriteFile(job.Manifest, fmt.Sprintf("%s/_study.yaml", jobsPath))
+	s.WriteFile(marshalJobMetadata(job.Metadata), fmt.Sprintf("%s/_job.json", jobsPath))
 
 	fmt.Println("Upload complete")
+	return job
+}
+
+// uploadDataSource copies a data source into the job directory. Remote sources are passed through
+// to the executor, which runs with the workspace credentials, unless staging has been requested.
+func (s LocalNotebookService) uploadDataSource(source string, name string, jobsPath string, options types.TrainingJobOptions) (string, string) {
+	if manifest.IsRemoteSource(source) {
+		executorSource, stagedPath, checksum, err := resolveRemoteSource(source, name, options.SyncOptions.S3Config, options.StageRemoteData)
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+		if stagedPath != "" {
+			s.CopyFile(stagedPath, fmt.Sprintf("%s/%s", jobsPath, executorSource))
+			removeStagedSource(stagedPath)
+		}
+		return executorSource, checksum
+	}
+	dataFilePath := strings.TrimLeft(source, "./")
+	s.CopyFile(dataFilePath, fmt.Sprintf("%s/%s", jobsPath, dataFilePath))
+	return source, getFileChecksum(dataFilePath)
+}
+func (s LocalNotebookService) WriteFile(content []byte, dstPath string) {
+	err := os.MkdirAll(filepath.Dir(dstPath), os.ModePerm)
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+	err = os.WriteFile(dstPath, content, 0644)
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
 }
 func (s LocalNotebookService) CopyFile(srcPath string, dstPath string) {
 
@@ -301,49 +343,6 @@ func (s LocalNotebookService) GetStudyRoot() string {
 	studyName := manifestConfig.StudyName
 	return fmt.Sprintf("/%s/%s", jobsDir, studyName)
 }
-func (s LocalNotebookService) WaitForTrainingToComplete(timeout int) {
-
-	jobsPath := s.GetJobsPath()
-
-	fmt.Print("Waiting for training to complete")
-	fmt.Println()
-	for i := 0; i <= timeout; i++ {
-		if i%3 == 0 || i == timeout {
-			status := s.GetTrainingStatus(fmt.Sprintf("%s/", jobsPath))
-			if status == TrainingComplete {
-				fmt.Println()
-				fmt.Println("Training completed")
-				return
-			}
-			fmt.Printf("\nTraining status: %s.\nWaiting.", status)
-		} else {
-			fmt.Print(".")
-		}
-		time.Sleep(1 * time.Second)
-	}
-	fmt.Println()
-	fmt.Println("Timed out waiting for study to complete")
-	os.Exit(1)
-}
-
-type TrainingStatus string
-
-const (
-	TrainingPending  TrainingStatus = "pending"
-	TrainingStarted  TrainingStatus = "started"
-	TrainingComplete TrainingStatus = "completed"
-)
-
-func (s LocalNotebookService) GetTrainingStatus(studyDir string) TrainingStatus {
-	startedPath := fmt.Sprintf("%s/STARTED", studyDir)
-	completedPath := fmt.Sprintf("%s/COMPLETED", studyDir)
-	if s.FileExists(startedPath) {
-		return TrainingStarted
-	} else if s.FileExists(completedPath) {
-		return TrainingComplete
-	}
-	return TrainingPending
-}
 func (s LocalNotebookService) FileExists(filepath string) bool {
 	_, err := os.Stat(filepath)
 	return !errors.Is(err, os.ErrNotExist)
@@ -5,12 +5,13 @@ import (
 	"fmt"
 	"os"
 	"path"
-	"time"
 
 	"github.com/gohypergiant/hyperdrive/hyper/client/aws"
 	"github.com/gohypergiant/hyperdrive/hyper/client/firefly"
 	"github.com/gohypergiant/hyperdrive/hyper/client/manifest"
 	"github.com/gohypergiant/hyperdrive/hyper/services/config"
+	"github.com/gohypergiant/hyperdrive/hyper/services/remote"
+	"github.com/gohypergiant/hyperdrive/hyper/services/status"
 	"github.com/gohypergiant/hyperdrive/hyper/types"
 )
 
@@ -27,6 +28,7 @@ func (s RemoteNotebookService) Start(jupyterOptions types.JupyterLaunchOptions,
 	name := GetNotebookName(s.ManifestPath)
 	fmt.Println("Starting remote notebook instance")
 	jupyterOptions.APIKey = s.RemoteConfiguration.JupyterAPIKey
+	jupyterOptions.StatusToken = status.DeriveToken(jupyterOptions.APIKey)
 	if s.RemoteConfiguration.Type == types.Firefly {
 		firefly.StartServer(s.RemoteConfiguration.FireflyConfiguration, name, imageOptions.Profile)
 	} else if s.RemoteConfiguration.Type == types.EC2 {
@@ -38,7 +40,19 @@ func (s RemoteNotebookService) Start(jupyterOptions types.JupyterLaunchOptions,
 			s.RemoteConfiguration.EC2Configuration.Region = namedProfileConfig.Region
 			s.RemoteConfiguration.EC2Configuration.Token = namedProfileConfig.Token
 		}
-		aws.StartJupyterEC2(s.ManifestPath, s.RemoteConfiguration.EC2Configuration, ec2Options.InstanceType, ec2Options.AmiId, jupyterOptions, syncOptions)
+		if syncOptions.Type != types.S3 && syncOptions.Type != "" {
+			fmt.Printf("%s workspace remotes can't be used from EC2 instances, please use an s3 workspace remote\n", syncOptions.Type)
+			os.Exit(1)
+		}
+		ip := aws.StartJupyterEC2(s.ManifestPath, s.RemoteConfiguration.EC2Configuration, ec2Options, jupyterOptions, syncOptions)
+		if ip != "" && ec2Options.Wait {
+			fmt.Println("Waiting for jupyter lab to be ready")
+			if _, err := remote.WaitUntilReady(ip, manifest.GetProjectName(s.ManifestPath), jupyterOptions.APIKey, ec2Options.WaitTimeout); err != nil {
+				fmt.Println(err)
+				os.Exit(1)
+			}
+			fmt.Println("Jupyter lab is ready at http://" + ip + ":8888/lab")
+		}
 	} else {
 		fmt.Println("Not Implemented")
 	}
@@ -68,26 +82,52 @@ func (s RemoteNotebookService) Stop(identifier string) {
 		fmt.Println("Not Implemented")
 	}
 }
-func (s RemoteNotebookService) UploadTrainingJobData() {
+func (s RemoteNotebookService) UploadTrainingJobData(options types.TrainingJobOptions) types.TrainingJob {
 
-	manifestConfig := manifest.GetManifest(s.ManifestPath)
+	document, manifestConfig := getJobManifest(s.ManifestPath, options)
 	//Right now, these two are the same, but in the future I'm sure that will change
 	//studyName := manifestConfig.StudyName
 	notebookName := GetNotebookName(s.ManifestPath)
 	studyRoot := s.GetStudyRoot()
+	sources := types.TrainingDataSources{}
+	checksums := map[string]string{}
 	//upload study
 
 	fmt.Println("Uploading features data")
 	//upload data
-	featuresDataFilePath := path.Clean(manifestConfig.Training.Data.Features.Source)
-	firefly.UploadData(s.RemoteConfiguration.FireflyConfiguration, notebookName, featuresDataFilePath, fmt.Sprintf("%s/%s", studyRoot, featuresDataFilePath))
+	sources.Features, checksums["features"] = s.uploadDataSource(manifestConfig.Training.Data.Features.Source, "features", notebookName, studyRoot, options)
 	fmt.Println("Uploading target data")
-	targetDataFilePath := path.Clean(manifestConfig.Training.Data.Target.Source)
-	firefly.UploadData(s.RemoteConfiguration.FireflyConfiguration, notebookName, targetDataFilePath, fmt.Sprintf("%s/%s", studyRoot, targetDataFilePath))
+	sources.Target, checksums["target"] = s.uploadDataSource(manifestConfig.Training.Data.Target.Source, "target", notebookName, studyRoot, options)
 	fmt.Println("Uploading Study Manifest")
-	firefly.UploadData(s.RemoteConfiguration.FireflyConfiguration, notebookName, s.ManifestPath, fmt.Sprintf("%s/_study.yaml", studyRoot))
+	job := types.TrainingJob{
+		Metadata: getJobMetadata(manifestConfig, sources, checksums, options),
+		Manifest: marshalJobManifest(s.ManifestPath, document, manifestConfig, sources, options),
+	}
+	firefly.UploadContent(s.RemoteConfiguration.FireflyConfiguration, notebookName, job.Manifest, fmt.Sprintf("%s/_study.yaml", studyRoot))
+	firefly.UploadContent(s.RemoteConfiguration.FireflyConfiguration, notebookName, marshalJobMetadata(job.Metadata), fmt.Sprintf("%s/_job.json", studyRoot))
 
 	fmt.Println("Upload complete")
+	return job
+}
+
+// uploadDataSource uploads a data source to the job directory on the remote. Remote notebook servers
+// aren't given the workspace credentials, so remote sources are always staged through this machine.
+func (s RemoteNotebookService) uploadDataSource(source string, name string, notebookName string, studyRoot string, options types.TrainingJobOptions) (string, string) {
+	localPath := path.Clean(source)
+	var checksum string
+	if manifest.IsRemoteSource(source) {
+		var err error
+		source, localPath, checksum, err = resolveRemoteSource(source, name, options.SyncOptions.S3Config, true)
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+		defer removeStagedSource(localPath)
+	} else {
+		checksum = getFileChecksum(localPath)
+	}
+	firefly.UploadData(s.RemoteConfiguration.FireflyConfiguration, notebookName, localPath, fmt.Sprintf("%s/%s", studyRoot, path.Clean(source)))
+	return source, checksum
 }
 func (s RemoteNotebookService) GetStudyRoot() string {
 
@@ -96,30 +136,6 @@ func (s RemoteNotebookService) GetStudyRoot() string {
 	studyName := manifestConfig.StudyName
 	return fmt.Sprintf("/%s/%s", jobsDir, studyName)
 }
-func (s RemoteNotebookService) WaitForTrainingToComplete(timeout int) {
-
-	notebookName := GetNotebookName(s.ManifestPath)
-	studyRoot := s.GetStudyRoot()
-	fmt.Print("Waiting for training to complete")
-	fmt.Println()
-	for i := 0; i <= timeout; i++ {
-		if i%3 == 0 || i == timeout {
-			status := firefly.GetTrainingStatus(s.RemoteConfiguration.FireflyConfiguration, notebookName, studyRoot)
-			if status == firefly.TrainingComplete {
-				fmt.Println()
-				fmt.Println("Training completed")
-				return
-			}
-			fmt.Print(fmt.Sprintf("\nTraining status: %s.\nWaiting.", status))
-		} else {
-			fmt.Print(".")
-		}
-		time.Sleep(1 * time.Second)
-	}
-	fmt.Println()
-	fmt.Println("Timed out waiting for study to complete")
-	os.Exit(1)
-}
 func (s RemoteNotebookService) GetRemoteHyperpackPath() string {
 
 	studyRoot := s.GetStudyRoot()
@@ -0,0 +1,40 @@
+package remote
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/gohypergiant/hyperdrive/hyper/types"
+	"github.com/moby/term"
+)
+
+// statusDisplay shows the phase of an instance on a single line that is rewritten as it
+// changes, with the time spent waiting. Output that isn't a terminal gets a line per change.
+type statusDisplay struct {
+	isTerminal bool
+	start      time.Time
+	last       string
+}
+
+func newStatusDisplay() *statusDisplay {
+	_, isTerminal := term.GetFdInfo(os.Stdout)
+	return &statusDisplay{isTerminal: isTerminal, start: time.Now()}
+}
+
+func (d *statusDisplay) show(remoteStatus types.RemoteStatus) {
+	line := fmt.Sprintf("%s: %s", formatPhase(remoteStatus), remoteStatus.Message)
+	elapsed := time.Since(d.start).Round(time.Second)
+	if d.isTerminal {
+		fmt.Printf("\r\033[K[%s] %s", elapsed, line)
+	} else if line != d.last {
+		fmt.Printf("[%s] %s\n", elapsed, line)
+	}
+	d.last = line
+}
+
+func (d *statusDisplay) done() {
+	if d.isTerminal && d.last != "" {
+		fmt.Println()
+	}
+}
@@ -0,0 +1,90 @@
+package remote
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/gohypergiant/hyperdrive/hyper/client/aws"
+	"github.com/gohypergiant/hyperdrive/hyper/client/manifest"
+	"github.com/gohypergiant/hyperdrive/hyper/client/ssh"
+	"github.com/gohypergiant/hyperdrive/hyper/types"
+)
+
+// Pause stops the study's instance, keeping its disk and the network it was started in. The
+// instance reports that it is paused first, if it can be reached.
+func (s ComputeRemoteService) Pause() {
+	s.requireEC2("pause")
+	projectName := manifest.GetProjectName(s.ManifestPath)
+	instance, err := aws.GetInstanceForStudy(projectName, s.RemoteConfiguration.EC2Configuration)
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+	if aws.IsStructureEmpty(instance) {
+		fmt.Printf("No instance is running for %s\n", projectName)
+		os.Exit(1)
+	}
+	if instance.PublicIpAddress != nil {
+		command := aws.GetStatusUpdateCommand("the instance was paused", types.PhasePaused)
+		if _, err := ssh.Run("ec2-user", aws.GetPrivateKeyPath(projectName), aws.GetKnownHostsPath(projectName), *instance.PublicIpAddress, command, tunnelTimeout); err != nil {
+			fmt.Printf("Could not report the pause to the instance: %v\n", err)
+		}
+	}
+	fmt.Printf("Pausing instance %s\n", *instance.InstanceId)
+	if err := aws.PauseInstance(instance, s.RemoteConfiguration.EC2Configuration); err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+	fmt.Println("Instance paused. Resume it with:")
+	fmt.Println()
+	fmt.Println("	hyper remote resume --remote=<REMOTE_PROFILE_NAME>")
+}
+
+// Resume starts the study's paused instance, which restarts its notebook and services as it
+// boots. Resumed instances get a new public IP address.
+func (s ComputeRemoteService) Resume(options types.RemoteResumeOptions) {
+	s.requireEC2("resume")
+	projectName := manifest.GetProjectName(s.ManifestPath)
+	instance, err := aws.GetPausedInstanceForStudy(projectName, s.RemoteConfiguration.EC2Configuration)
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+	if aws.IsStructureEmpty(instance) {
+		fmt.Printf("No instance is paused for %s\n", projectName)
+		os.Exit(1)
+	}
+	fmt.Printf("Resuming instance %s\n", *instance.InstanceId)
+	resumedAt := time.Now()
+	ip, err := aws.ResumeInstance(*instance.InstanceId, s.RemoteConfiguration.EC2Configuration)
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+	fmt.Printf("Instance resumed at %s\n", ip)
+	if !options.Wait {
+		fmt.Println("In a few minutes, you should be able to access jupyter lab at http://" + ip + ":8888/lab")
+		return
+	}
+	fmt.Println("Waiting for jupyter lab to be ready")
+	if _, err := waitUntilReadySince(ip, projectName, s.RemoteConfiguration.JupyterAPIKey, options.Timeout, resumedAt); err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+	fmt.Println("Jupyter lab is ready at http://" + ip + ":8888/lab")
+}
+
+// Destroy terminates the study's instance, running or paused, and tears down the key pair and
+// network it was started in
+func (s ComputeRemoteService) Destroy() {
+	s.requireEC2("destroy")
+	aws.StopServer(s.ManifestPath, s.RemoteConfiguration.EC2Configuration)
+}
+
+func (s ComputeRemoteService) requireEC2(command string) {
+	if s.RemoteConfiguration.Type != types.EC2 {
+		fmt.Printf("hyper remote %s is only supported by ec2 remotes\n", command)
+		os.Exit(1)
+	}
+}
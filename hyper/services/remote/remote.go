@@ -0,0 +1,19 @@
+package remote
+
+import (
+	"github.com/gohypergiant/hyperdrive/hyper/services/config"
+	"github.com/gohypergiant/hyperdrive/hyper/types"
+)
+
+// ComputeRemoteService manages the instance a compute remote runs for the study
+type ComputeRemoteService struct {
+	RemoteConfiguration types.ComputeRemoteConfiguration
+	ManifestPath        string
+}
+
+func RemoteService(remoteName string, manifestPath string) types.IRemoteService {
+	return ComputeRemoteService{
+		RemoteConfiguration: config.GetComputeRemote(remoteName),
+		ManifestPath:        manifestPath,
+	}
+}
@@ -0,0 +1,301 @@
+package remote
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"text/tabwriter"
+	"time"
+
+	"github.com/gohypergiant/hyperdrive/hyper/client/aws"
+	"github.com/gohypergiant/hyperdrive/hyper/client/manifest"
+	"github.com/gohypergiant/hyperdrive/hyper/client/ssh"
+	"github.com/gohypergiant/hyperdrive/hyper/services/status"
+	"github.com/gohypergiant/hyperdrive/hyper/types"
+)
+
+// DefaultWaitTimeout is how long to wait for an instance to be ready, unless overridden
+const DefaultWaitTimeout = 30 * time.Minute
+
+const statusPollInterval = 3 * time.Second
+const tunnelTimeout = 15 * time.Second
+
+// Status prints the status the study's instance reports, or follows it until the instance is
+// ready or has failed
+func (s ComputeRemoteService) Status(options types.RemoteStatusOptions) {
+	if s.RemoteConfiguration.Type != types.EC2 {
+		fmt.Println("hyper remote status is only supported by ec2 remotes")
+		os.Exit(1)
+	}
+	projectName := manifest.GetProjectName(s.ManifestPath)
+	instanceId, ip, err := s.getInstance()
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+	fmt.Printf("Instance: %s (%s)\n", instanceId, ip)
+
+	if options.Watch {
+		remoteStatus, err := WaitUntilReady(ip, projectName, s.RemoteConfiguration.JupyterAPIKey, options.Timeout)
+		if options.History {
+			printStatusHistory(remoteStatus)
+		}
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	endpoint := newStatusEndpoint(ip, projectName, s.RemoteConfiguration.JupyterAPIKey)
+	defer endpoint.close()
+	remoteStatus, err := endpoint.get()
+	if err != nil {
+		fmt.Printf("Could not reach the status endpoint of the instance: %v\n", err)
+		os.Exit(1)
+	}
+	if remoteStatus.UpdatedAt.IsZero() && remoteStatus.Message == "" {
+		fmt.Println("The instance hasn't reported a status yet")
+		return
+	}
+	fmt.Printf("Phase:    %s\n", formatPhase(remoteStatus))
+	fmt.Printf("Message:  %s\n", remoteStatus.Message)
+	if !remoteStatus.UpdatedAt.IsZero() {
+		fmt.Printf("Updated:  %s (%s ago)\n", remoteStatus.UpdatedAt.Local().Format(time.RFC1123), time.Since(remoteStatus.UpdatedAt).Round(time.Second))
+	}
+	if options.History {
+		printStatusHistory(remoteStatus)
+	}
+}
+
+// getInstance returns the id and public IP of the instance of the study's project
+func (s ComputeRemoteService) getInstance() (string, string, error) {
+	projectName := manifest.GetProjectName(s.ManifestPath)
+	instance, err := aws.GetInstanceForStudy(projectName, s.RemoteConfiguration.EC2Configuration)
+	if err != nil {
+		return "", "", err
+	}
+	if aws.IsStructureEmpty(instance) || instance.PublicIpAddress == nil {
+		return "", "", fmt.Errorf("no instance is running for %s", projectName)
+	}
+	return *instance.InstanceId, *instance.PublicIpAddress, nil
+}
+
+// WaitUntilReady follows the status of an instance until it is ready, showing its phase as it
+// goes. An error is returned if the instance failed, or wasn't ready within the timeout. The
+// instance isn't reachable until it has booted, so errors reaching it are retried until then.
+// The endpoint's token is derived from the API key of the remote.
+func WaitUntilReady(ip string, projectName string, apiKey string, timeout time.Duration) (types.RemoteStatus, error) {
+	return waitUntilReadySince(ip, projectName, apiKey, timeout, time.Time{})
+}
+
+// waitUntilReadySince waits like WaitUntilReady, ignoring the status the instance reported before
+// the given time, e.g. the ready status of an instance that was paused since
+func waitUntilReadySince(ip string, projectName string, apiKey string, timeout time.Duration, since time.Time) (types.RemoteStatus, error) {
+	endpoint := newStatusEndpoint(ip, projectName, apiKey)
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	followed := make(chan bool)
+	go func() {
+		endpoint.follow(ctx)
+		close(followed)
+	}()
+	defer func() {
+		cancel()
+		<-followed
+		endpoint.close()
+	}()
+	display := newStatusDisplay()
+	defer display.done()
+
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+	for {
+		remoteStatus := endpoint.getLatest()
+		if remoteStatus.UpdatedAt.Before(since) {
+			remoteStatus = types.RemoteStatus{}
+		}
+		if remoteStatus.Phase == "" && remoteStatus.Message == "" {
+			remoteStatus = types.RemoteStatus{Phase: types.PhaseProvisioning, Message: "waiting for the instance to report its status"}
+		}
+		display.show(remoteStatus)
+		switch remoteStatus.Phase {
+		case types.PhaseReady:
+			return remoteStatus, nil
+		case types.PhaseFailed:
+			return remoteStatus, fmt.Errorf("the instance failed to start: %s", remoteStatus.Message)
+		case types.PhaseInterrupted:
+			return remoteStatus, fmt.Errorf("the spot instance was interrupted: %s", remoteStatus.Message)
+		}
+		select {
+		case <-ctx.Done():
+			return remoteStatus, fmt.Errorf("timed out after %s waiting for the instance to be ready", timeout)
+		case <-ticker.C:
+		}
+	}
+}
+
+// statusEndpoint reaches the status endpoint of an instance directly if its port is open, or
+// through an ssh tunnel otherwise. It reconnects after a failed request. The fingerprint of the
+// endpoint's certificate is read over ssh, which checks the host key of the instance, so the
+// certificate can be trusted.
+type statusEndpoint struct {
+	ip             string
+	privateKeyPath string
+	knownHostsPath string
+	client         status.Client
+	directFailed   bool
+	pollOnly       bool
+	tunnel         *ssh.Tunnel
+
+	mu     sync.Mutex
+	latest types.RemoteStatus
+}
+
+func newStatusEndpoint(ip string, projectName string, apiKey string) *statusEndpoint {
+	return &statusEndpoint{
+		ip:             ip,
+		privateKeyPath: aws.GetPrivateKeyPath(projectName),
+		knownHostsPath: aws.GetKnownHostsPath(projectName),
+		client:         status.Client{Token: status.DeriveToken(apiKey)},
+	}
+}
+
+// follow keeps the latest status of the instance up to date until the context is done, as it
+// is streamed or, if the endpoint doesn't stream it, by polling
+func (e *statusEndpoint) follow(ctx context.Context) {
+	for ctx.Err() == nil {
+		if e.client.Url == "" {
+			if err := e.connect(); err != nil {
+				sleepContext(ctx, statusPollInterval)
+				continue
+			}
+		}
+		if !e.pollOnly {
+			err := e.client.FollowStatus(ctx, func(remoteStatus types.RemoteStatus) bool {
+				e.setLatest(remoteStatus)
+				return false
+			})
+			if errors.Is(err, status.ErrStreamNotSupported) {
+				e.pollOnly = true
+			} else {
+				e.close()
+				sleepContext(ctx, statusPollInterval)
+			}
+			continue
+		}
+		remoteStatus, err := e.get()
+		if err == nil {
+			e.setLatest(remoteStatus)
+		}
+		sleepContext(ctx, statusPollInterval)
+	}
+}
+
+func (e *statusEndpoint) setLatest(remoteStatus types.RemoteStatus) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.latest = remoteStatus
+}
+
+func (e *statusEndpoint) getLatest() types.RemoteStatus {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.latest
+}
+
+func (e *statusEndpoint) get() (types.RemoteStatus, error) {
+	return e.request(status.Client.GetStatus)
+}
+
+func (e *statusEndpoint) getTraining(studyName string) (types.RemoteStatus, error) {
+	return e.request(func(client status.Client) (types.RemoteStatus, error) {
+		return client.GetTrainingStatus(studyName)
+	})
+}
+
+func (e *statusEndpoint) request(get func(status.Client) (types.RemoteStatus, error)) (types.RemoteStatus, error) {
+	if e.client.Url == "" {
+		if err := e.connect(); err != nil {
+			return types.RemoteStatus{}, err
+		}
+	}
+	remoteStatus, err := get(e.client)
+	if err != nil {
+		e.close()
+	}
+	return remoteStatus, err
+}
+
+func (e *statusEndpoint) connect() error {
+	// instances of older releases serve plain http, and have no fingerprint. Without a
+	// fingerprint the endpoint is only reached through the ssh tunnel, so the token is never sent
+	// in the clear, and the fingerprint is read again on every reconnection.
+	if e.client.Fingerprint == "" {
+		fingerprint, err := ssh.Run("ec2-user", e.privateKeyPath, e.knownHostsPath, e.ip, "cat "+aws.STATUS_FINGERPRINT_PATH+" 2>/dev/null || true", tunnelTimeout)
+		if err == nil {
+			e.client.Fingerprint = strings.TrimSpace(fingerprint)
+		}
+	}
+	scheme := "http"
+	if e.client.Fingerprint != "" {
+		scheme = "https"
+	}
+
+	if scheme == "https" && !e.directFailed {
+		e.client.Url = fmt.Sprintf("%s://%s:%d", scheme, e.ip, status.DEFAULT_PORT)
+		if _, err := e.client.GetStatus(); err == nil {
+			return nil
+		}
+		e.directFailed = true
+	}
+	tunnel, err := ssh.OpenTunnel("ec2-user", e.privateKeyPath, e.knownHostsPath, e.ip, status.DEFAULT_PORT, tunnelTimeout)
+	if err != nil {
+		e.client.Url = ""
+		return err
+	}
+	e.tunnel = tunnel
+	e.client.Url = fmt.Sprintf("%s://127.0.0.1:%d", scheme, tunnel.LocalPort)
+	return nil
+}
+
+func (e *statusEndpoint) close() {
+	if e.tunnel != nil {
+		e.tunnel.Close()
+		e.tunnel = nil
+	}
+	e.client.Url = ""
+}
+
+func sleepContext(ctx context.Context, d time.Duration) {
+	select {
+	case <-ctx.Done():
+	case <-time.After(d):
+	}
+}
+
+func formatPhase(remoteStatus types.RemoteStatus) string {
+	phase := string(remoteStatus.Phase)
+	if phase == "" {
+		phase = "unknown"
+	}
+	if remoteStatus.Progress > 0 {
+		phase += fmt.Sprintf(" (%d%%)", remoteStatus.Progress)
+	}
+	return phase
+}
+
+func printStatusHistory(remoteStatus types.RemoteStatus) {
+	if len(remoteStatus.Events) == 0 {
+		return
+	}
+	fmt.Println()
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "TIME\tPHASE\tMESSAGE")
+	for _, event := range remoteStatus.Events {
+		fmt.Fprintf(w, "%s\t%s\t%s\n", event.Time.Local().Format("15:04:05"), formatPhase(types.RemoteStatus{Phase: event.Phase, Progress: event.Progress}), event.Message)
+	}
+	w.Flush()
+}
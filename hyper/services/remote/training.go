@@ -0,0 +1,32 @@
+package remote
+
+import (
+	"github.com/gohypergiant/hyperdrive/hyper/client/manifest"
+	"github.com/gohypergiant/hyperdrive/hyper/types"
+)
+
+// EC2TrainingStatusProvider reads the status of a training from the status endpoint of the
+// study's instance, which reads it from the jobs of the workspace the instance syncs
+type EC2TrainingStatusProvider struct {
+	ComputeRemoteService
+	StudyName string
+
+	endpoint *statusEndpoint
+}
+
+func (p *EC2TrainingStatusProvider) GetTrainingStatus() (types.RemoteStatus, error) {
+	if p.endpoint == nil {
+		_, ip, err := p.getInstance()
+		if err != nil {
+			return types.RemoteStatus{}, err
+		}
+		p.endpoint = newStatusEndpoint(ip, manifest.GetProjectName(p.ManifestPath), p.RemoteConfiguration.JupyterAPIKey)
+	}
+	return p.endpoint.getTraining(p.StudyName)
+}
+
+func (p *EC2TrainingStatusProvider) Close() {
+	if p.endpoint != nil {
+		p.endpoint.close()
+	}
+}
@@ -0,0 +1,94 @@
+package status
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/hex"
+	"math/big"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+// STATUS_TOKEN_ENV holds the bearer token of the endpoint, so it isn't visible in the process list
+const STATUS_TOKEN_ENV = "HYPER_STATUS_TOKEN"
+
+// DeriveToken derives the bearer token of a remote's status endpoints from its Jupyter API key.
+// The token doesn't reveal the key, so it can be given to dashboards that only read the status.
+func DeriveToken(apiKey string) string {
+	if apiKey == "" {
+		return ""
+	}
+	mac := hmac.New(sha256.New, []byte(apiKey))
+	mac.Write([]byte("hyper remoteStatus"))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// GetFingerprint returns the SHA-256 fingerprint of a DER encoded certificate, in hex
+func GetFingerprint(der []byte) string {
+	sum := sha256.Sum256(der)
+	return hex.EncodeToString(sum[:])
+}
+
+// requireToken rejects the requests that don't carry the token, as an `Authorization: Bearer`
+// header or, for browsers' EventSource which can't set headers, an `access_token` parameter
+func requireToken(token string, handler http.HandlerFunc) http.HandlerFunc {
+	if token == "" {
+		return handler
+	}
+	return func(w http.ResponseWriter, r *http.Request) {
+		given := r.URL.Query().Get("access_token")
+		if header := r.Header.Get("Authorization"); strings.HasPrefix(header, "Bearer ") {
+			given = strings.TrimPrefix(header, "Bearer ")
+		}
+		if subtle.ConstantTimeCompare([]byte(given), []byte(token)) != 1 {
+			w.Header().Set("Content-Type", "application/json")
+			w.Header().Set("WWW-Authenticate", `Bearer realm="hyper remoteStatus"`)
+			w.Write(routeError("Unauthorized", w, http.StatusUnauthorized))
+			return
+		}
+		handler(w, r)
+	}
+}
+
+// generateCertificate returns a self-signed certificate for the endpoint, and writes its
+// fingerprint to fingerprintFile so clients can pin it
+func generateCertificate(fingerprintFile string) (tls.Certificate, string, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return tls.Certificate{}, "", err
+	}
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return tls.Certificate{}, "", err
+	}
+	hostname, _ := os.Hostname()
+	template := &x509.Certificate{
+		SerialNumber: serial,
+		Subject:      pkix.Name{CommonName: "hyper remoteStatus " + hostname},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().AddDate(1, 0, 0),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		DNSNames:     []string{"localhost"},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		return tls.Certificate{}, "", err
+	}
+	fingerprint := GetFingerprint(der)
+	if fingerprintFile != "" {
+		if err := os.WriteFile(fingerprintFile, []byte(fingerprint+"\n"), 0644); err != nil {
+			return tls.Certificate{}, "", err
+		}
+	}
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}, fingerprint, nil
+}
@@ -0,0 +1,142 @@
+package status
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/gohypergiant/hyperdrive/hyper/types"
+)
+
+// DEFAULT_PORT is the port the status endpoint listens on, unless overridden
+const DEFAULT_PORT = 3001
+
+// ErrStreamNotSupported is returned when following an endpoint that doesn't stream the status,
+// such as one of an older release
+var ErrStreamNotSupported = errors.New("the status endpoint doesn't stream the status")
+
+// Client queries the status endpoint at Url, e.g. https://localhost:3001, with the bearer
+// Token if it isn't empty. With a Fingerprint, the endpoint's certificate must have that
+// fingerprint, which pins the self-signed certificate it serves over TLS.
+type Client struct {
+	Url         string
+	Token       string
+	Fingerprint string
+}
+
+// GetStatus queries the current status. A status that was never set is returned empty.
+func (c Client) GetStatus() (types.RemoteStatus, error) {
+	return c.get("/status")
+}
+
+// GetTrainingStatus queries the status of the training of the study
+func (c Client) GetTrainingStatus(studyName string) (types.RemoteStatus, error) {
+	return c.get("/training?study=" + url.QueryEscape(studyName))
+}
+
+func (c Client) get(path string) (types.RemoteStatus, error) {
+	var remoteStatus types.RemoteStatus
+	request, err := c.newRequest(context.Background(), path)
+	if err != nil {
+		return remoteStatus, err
+	}
+	response, err := c.getHttpClient(5 * time.Second).Do(request)
+	if err != nil {
+		return remoteStatus, err
+	}
+	defer response.Body.Close()
+	if response.StatusCode == http.StatusNoContent {
+		return remoteStatus, nil
+	}
+	if response.StatusCode != http.StatusOK {
+		return remoteStatus, fmt.Errorf("the status endpoint responded with %s", response.Status)
+	}
+	err = json.NewDecoder(response.Body).Decode(&remoteStatus)
+	return remoteStatus, err
+}
+
+// FollowStatus streams the status, calling update with the current status and then with every
+// update, until it returns true, the context is done or the stream is closed
+func (c Client) FollowStatus(ctx context.Context, update func(types.RemoteStatus) bool) error {
+	request, err := c.newRequest(ctx, "/status/stream")
+	if err != nil {
+		return err
+	}
+	request.Header.Set("Accept", "text/event-stream")
+	// streams have no timeout, they stay open until the context is done
+	response, err := c.getHttpClient(0).Do(request)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+	if response.StatusCode == http.StatusUnauthorized {
+		return fmt.Errorf("the status endpoint responded with %s", response.Status)
+	}
+	if response.StatusCode != http.StatusOK || !strings.HasPrefix(response.Header.Get("Content-Type"), "text/event-stream") {
+		return ErrStreamNotSupported
+	}
+
+	scanner := bufio.NewScanner(response.Body)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	data := []string{}
+	for scanner.Scan() {
+		line := scanner.Text()
+		if strings.HasPrefix(line, "data:") {
+			data = append(data, strings.TrimPrefix(strings.TrimPrefix(line, "data:"), " "))
+			continue
+		}
+		if line != "" || len(data) == 0 {
+			continue
+		}
+		var remoteStatus types.RemoteStatus
+		err := json.Unmarshal([]byte(strings.Join(data, "\n")), &remoteStatus)
+		data = data[:0]
+		if err != nil {
+			return err
+		}
+		if update(remoteStatus) {
+			return nil
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+	return io.ErrUnexpectedEOF
+}
+
+func (c Client) newRequest(ctx context.Context, path string) (*http.Request, error) {
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, c.Url+path, nil)
+	if err != nil {
+		return nil, err
+	}
+	if c.Token != "" {
+		request.Header.Set("Authorization", "Bearer "+c.Token)
+	}
+	return request, nil
+}
+
+func (c Client) getHttpClient(timeout time.Duration) *http.Client {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	if c.Fingerprint != "" {
+		transport.TLSClientConfig = &tls.Config{
+			// the certificate is self-signed, so it is checked against the fingerprint instead
+			InsecureSkipVerify: true,
+			VerifyPeerCertificate: func(rawCerts [][]byte, _ [][]*x509.Certificate) error {
+				if len(rawCerts) == 0 || GetFingerprint(rawCerts[0]) != c.Fingerprint {
+					return errors.New("the certificate of the status endpoint doesn't match its fingerprint")
+				}
+				return nil
+			},
+		}
+	}
+	return &http.Client{Timeout: timeout, Transport: transport}
+}
@@ -1,12 +1,16 @@
 package status
 
 import (
+	"crypto/tls"
 	"fmt"
 	"log"
 	"net"
 	"net/http"
 	"os"
 	"strings"
+
+	"github.com/gohypergiant/hyperdrive/hyper/client/cli"
+	"github.com/gohypergiant/hyperdrive/hyper/types"
 )
 
 var (
@@ -16,59 +20,134 @@ var (
 
 /**
   A public function that updates the status file upon `hyper remoteStatus update "<message>"`
-  The `<message>` is supplied through `args[0]`, trimmed of parentheses. 
+  The `<message>` is supplied through `args[0]`, trimmed of parentheses. The phase is kept from
+  the previous update when it is empty, and a negative progress is left out. Entering a new
+  phase is notified to the sinks of the notificationsFile, or of the config without one.
 */
-func UpdateStatus(args []string, statusFilePath string) {
-  updateMessage :=  strings.Trim(args[0], "\"")
-  if(updateMessage == "") {
-    fmt.Println("[remoteStatus] No message provided, --help for more.")
+func UpdateStatus(args []string, statusFilePath string, phase string, progress int, notificationsFile string) {
+  updateMessage := ""
+  if len(args) > 0 {
+    updateMessage = strings.Trim(args[0], "\"")
+  }
+  if(updateMessage == "" && phase == "") {
+    fmt.Println("[remoteStatus] No message or phase provided, --help for more.")
+    os.Exit(2)
+  }
+  if !isValidPhase(phase) {
+    fmt.Printf("[remoteStatus] Invalid phase %q, must be one of %v\n", phase, types.ValidRemoteStatusPhases)
     os.Exit(2)
   }
+  if progress > 100 {
+    fmt.Println("[remoteStatus] The progress is a percentage, from 0 to 100")
+    os.Exit(2)
+  }
+  if progress < 0 {
+    progress = 0
+  }
 
-  err := writeStatusFile(updateMessage, generateStatusFilePath(statusFilePath))
+  event := types.RemoteStatusEvent{Phase: types.RemoteStatusPhase(phase), Message: updateMessage, Progress: progress}
+  status, err := writeStatusFile(event, generateStatusFilePath(statusFilePath))
 
   if err != nil {
     fmt.Println("[remoteStatus] Could not update")
     panic(err)
   }
 
-  fmt.Println("[remoteStatus] updated")
+  fmt.Printf("[remoteStatus] updated (%s)\n", status.Phase)
+
+  if enteredPhase(status) {
+    notifyPhase(status, notificationsFile)
+  }
+}
+
+func isValidPhase(phase string) bool {
+  if phase == "" {
+    return true
+  }
+  for _, validPhase := range types.ValidRemoteStatusPhases {
+    if string(validPhase) == phase {
+      return true
+    }
+  }
+  return false
 }
 
 /**
   Public function that starts the http server upon `hyper remoteStatus` invokation
+  The token is read from $HYPER_STATUS_TOKEN when it isn't given.
 */
-func StartEndpoint(statusEndpointPort string, statusFilePath string) {
-  if(statusEndpointPort == "" || statusFilePath == "") {
+func StartEndpoint(options types.RemoteStatusEndpointOptions) {
+  if(options.Port == "" || options.StatusFilePath == "") {
     panic("[remoteStatus] Unable to start server, port & filepath not specified")
   }
-  port = statusEndpointPort
-  filePath = generateStatusFilePath(statusFilePath)
-  
-  startHttpServer()
+  port = options.Port
+  filePath = generateStatusFilePath(options.StatusFilePath)
+  workspacePath = options.WorkspacePath
+  if options.Token == "" {
+    options.Token = os.Getenv(STATUS_TOKEN_ENV)
+  }
+
+  startHttpServer(options)
 }
 
 /**
   Starts the http server for status discovery.
  */
-func startHttpServer() {
+func startHttpServer(options types.RemoteStatusEndpointOptions) {
+  address := net.JoinHostPort(options.BindAddress, port)
 
   // ensure the desired port is available
-  if(!portAvailable()) {
+  if(!portAvailable(address)) {
     fmt.Println("[remoteStatus] Port "+port+" already in use")
     os.Exit(2);
   }
 
-  http.HandleFunc("/status", statusPage)
-  http.HandleFunc("/", statusPage)
+  if err := watchStatusFile(filePath); err != nil {
+    fmt.Println("[remoteStatus] Could not watch the statusFile, /status/stream is unavailable: ", err)
+  }
+
+  // the endpoint doesn't need docker, the containers are left out where it isn't available
+  if client, err := cli.OpenDockerClient(); err == nil {
+    dockerClient = client
+    defer dockerClient.Close()
+  }
+
+  http.HandleFunc("/status", requireToken(options.Token, statusPage))
+  http.HandleFunc("/status/stream", requireToken(options.Token, statusStream))
+  http.HandleFunc("/training", requireToken(options.Token, trainingPage))
+  http.HandleFunc("/metrics", requireToken(options.Token, metricsPage))
+  // load balancers can't carry the token, and the checks reveal nothing but the readiness
+  http.HandleFunc("/healthz", healthPage)
+  http.HandleFunc("/readyz", readyPage)
+  http.HandleFunc("/", requireToken(options.Token, statusPage))
+  if options.Token == "" {
+    fmt.Println("[remoteStatus] Warning: no token set, anyone who can reach the endpoint can read the status")
+  }
 
-  fmt.Println("[remoteStatus] Endpoint available at http://localhost:"+port+"")
-  log.Fatal(http.ListenAndServe(":"+port, nil))
+  host := options.BindAddress
+  if host == "" {
+    host = "localhost"
+  }
+  if !options.TLS {
+    fmt.Println("[remoteStatus] Endpoint available at http://"+net.JoinHostPort(host, port)+"")
+    log.Fatal(http.ListenAndServe(address, nil))
+  }
+
+  certificate, fingerprint, err := generateCertificate(options.FingerprintFile)
+  if err != nil {
+    fmt.Println("[remoteStatus] Could not generate a TLS certificate")
+    panic(err)
+  }
+  server := &http.Server{Addr: address, TLSConfig: &tls.Config{Certificates: []tls.Certificate{certificate}}}
+  fmt.Println("[remoteStatus] Endpoint available at https://"+net.JoinHostPort(host, port)+"")
+  fmt.Println("[remoteStatus] TLS certificate fingerprint (SHA-256): "+fingerprint)
+  log.Fatal(server.ListenAndServeTLS("", ""))
 }
 
 
 /**
   Supports route: `/status`
+  Responds with the current state and its history of events.
 */
 func statusPage(w http.ResponseWriter, r *http.Request){
   jsonMap, jsonBytes, err :=  readStatusFile(filePath)
@@ -79,12 +158,13 @@ func statusPage(w http.ResponseWriter, r *http.Request){
     fmt.Println("[remoteStatus] Could not retrieve statusFile: ", err)
   }
   
-  if (jsonMap.Message == "" && err == nil) {
+  hasStatus := jsonMap.Message != "" || len(jsonMap.Events) > 0
+  if (!hasStatus && err == nil) {
     w.Write(routeError("No status set", w, http.StatusNoContent))
     fmt.Println("[remoteStatus] No status set")
   }
   
-  if (jsonMap.Message != "" && err == nil){
+  if (hasStatus && err == nil){
     w.WriteHeader(http.StatusOK)
     w.Write(jsonBytes)
   }
@@ -110,8 +190,8 @@ func routeError(message string, w http.ResponseWriter, statusCode int)  []byte {
 /**
   Utility function to determine if a port is available, or already in-use.
 */
-func portAvailable() bool{
-  connection, err := net.Listen("tcp", ":"+port)
+func portAvailable(address string) bool{
+  connection, err := net.Listen("tcp", address)
 
   if err != nil {
     return false
@@ -0,0 +1,115 @@
+package status
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"time"
+
+	"github.com/gohypergiant/hyperdrive/hyper/client/jupyter"
+	"github.com/gohypergiant/hyperdrive/hyper/types"
+)
+
+// idleCheckInterval is how often the notebook server is checked for activity
+const idleCheckInterval = time.Minute
+
+// WatchIdle watches the activity of the notebook server, and shuts the instance down once it has
+// been idle for the idle timeout. Busy kernels are active, whatever their last activity. The
+// server can't always be reached, e.g. while its container restarts, which doesn't count as idle.
+func WatchIdle(options types.IdleShutdownOptions) {
+	if options.Timeout <= 0 {
+		fmt.Println("[remoteStatus] The idle timeout must be positive")
+		os.Exit(2)
+	}
+	if !isValidIdleAction(options.Action) {
+		fmt.Printf("[remoteStatus] Invalid idle action %q, must be one of %v\n", options.Action, types.ValidIdleActions)
+		os.Exit(2)
+	}
+	fmt.Printf("[remoteStatus] Shutting down after %s without notebook activity\n", options.Timeout)
+
+	lastActivity := time.Now()
+	interval := idleCheckInterval
+	if options.Timeout < interval {
+		interval = options.Timeout
+	}
+	for {
+		time.Sleep(interval)
+		notebookStatus, err := jupyter.GetStatus(options.JupyterUrl, options.JupyterToken)
+		if err != nil {
+			fmt.Println("[remoteStatus] Could not read the notebook activity: ", err)
+			lastActivity = time.Now()
+			continue
+		}
+		if notebookStatus.LastActivity.After(lastActivity) {
+			lastActivity = notebookStatus.LastActivity
+		}
+		if time.Since(lastActivity) < options.Timeout {
+			continue
+		}
+		busy, err := hasBusyKernel(options.JupyterUrl, options.JupyterToken, notebookStatus)
+		if err != nil {
+			fmt.Println("[remoteStatus] Could not read the notebook kernels: ", err)
+			lastActivity = time.Now()
+			continue
+		}
+		if busy {
+			lastActivity = time.Now()
+			continue
+		}
+		shutDownIdle(options)
+		return
+	}
+}
+
+// hasBusyKernel reports whether a kernel of the notebook server is busy, e.g. running a cell that
+// prints nothing. Reading the kernels counts as activity of the server, so they are only read once
+// it looks idle.
+func hasBusyKernel(url string, token string, notebookStatus types.JupyterStatus) (bool, error) {
+	if notebookStatus.Kernels == 0 {
+		return false, nil
+	}
+	kernels, err := jupyter.GetKernels(url, token)
+	if err != nil {
+		return false, err
+	}
+	for _, kernel := range kernels {
+		if kernel.ExecutionState == "busy" {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// shutDownIdle syncs the workspace, reports the final status of the instance and shuts it down.
+// EC2 stops or terminates instances that shut down as they were started to.
+func shutDownIdle(options types.IdleShutdownOptions) {
+	idleFor := fmt.Sprintf("no notebook activity for %s", options.Timeout)
+	if options.SyncScript != "" {
+		UpdateStatus([]string{idleFor + ", syncing the workspace"}, options.StatusFilePath, "", -1, options.NotificationsFile)
+		output, err := exec.Command(options.SyncScript).CombinedOutput()
+		fmt.Print(string(output))
+		if err != nil {
+			fmt.Println("[remoteStatus] Could not sync the workspace: ", err)
+			idleFor += ", the workspace could not be synced"
+		}
+	}
+
+	if options.Action == types.IdleTerminate {
+		UpdateStatus([]string{idleFor + ", terminating the instance"}, options.StatusFilePath, string(types.PhaseTerminated), -1, options.NotificationsFile)
+	} else {
+		UpdateStatus([]string{idleFor + ", stopping the instance"}, options.StatusFilePath, string(types.PhasePaused), -1, options.NotificationsFile)
+	}
+	if output, err := exec.Command("shutdown", "-h", "now").CombinedOutput(); err != nil {
+		fmt.Printf("[remoteStatus] Could not shut down the instance: %v\n%s", err, output)
+		os.Exit(1)
+	}
+}
+
+func isValidIdleAction(action types.IdleAction) bool {
+	for _, validAction := range types.ValidIdleActions {
+		if validAction == action {
+			return true
+		}
+	}
+	return false
+}
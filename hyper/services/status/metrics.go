@@ -0,0 +1,179 @@
+package status
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gohypergiant/hyperdrive/hyper/client/cli"
+	"github.com/gohypergiant/hyperdrive/hyper/types"
+)
+
+// workspacePath is the workspace synced on the instance, whose sync stats are reported
+var workspacePath string
+
+// dockerClient reads the health of the containers, shared by every scrape. It is nil where
+// docker isn't available.
+var dockerClient *cli.DockerClient
+
+// metricsPage serves the status, the workspace syncs and the health of the containers in the
+// Prometheus text format
+func metricsPage(w http.ResponseWriter, r *http.Request) {
+	remoteStatus, _, err := readStatusFile(filePath)
+	if err != nil {
+		w.Write(routeError("Internal server error", w, http.StatusInternalServerError))
+		fmt.Println("[remoteStatus] Could not retrieve statusFile: ", err)
+		return
+	}
+
+	metrics := &metricsWriter{}
+	metrics.describe("hyper_remote_phase", "gauge", "The phase of the remote server, 1 for the current phase")
+	for _, phase := range types.ValidRemoteStatusPhases {
+		metrics.sample("hyper_remote_phase", []string{"phase", string(phase)}, boolValue(remoteStatus.Phase == phase))
+	}
+	if remoteStatus.Phase != "" {
+		metrics.describe("hyper_remote_phase_seconds", "gauge", "Time the remote server has been in its current phase")
+		metrics.sample("hyper_remote_phase_seconds", nil, time.Since(getPhaseStart(remoteStatus)).Seconds())
+		metrics.describe("hyper_remote_phase_progress", "gauge", "Progress of the current phase, as a percentage")
+		metrics.sample("hyper_remote_phase_progress", nil, float64(remoteStatus.Progress))
+	}
+
+	if stats, err := readSyncStats(); err == nil {
+		metrics.describe("hyper_workspace_syncs_total", "counter", "Workspace syncs since the watch started")
+		metrics.sample("hyper_workspace_syncs_total", nil, float64(stats.Syncs))
+		metrics.describe("hyper_workspace_sync_errors_total", "counter", "Workspace syncs that failed to sync some files")
+		metrics.sample("hyper_workspace_sync_errors_total", nil, float64(stats.FailedSyncs))
+		metrics.describe("hyper_workspace_sync_files_total", "counter", "Files transferred by the workspace syncs")
+		metrics.sample("hyper_workspace_sync_files_total", nil, float64(stats.FilesTransferred))
+		metrics.describe("hyper_workspace_sync_failed_files_total", "counter", "Files the workspace syncs failed to transfer")
+		metrics.sample("hyper_workspace_sync_failed_files_total", nil, float64(stats.FilesFailed))
+		metrics.describe("hyper_workspace_sync_bytes_total", "counter", "Bytes transferred by the workspace syncs")
+		metrics.sample("hyper_workspace_sync_bytes_total", nil, float64(stats.BytesTransferred))
+		metrics.describe("hyper_workspace_last_sync_timestamp_seconds", "gauge", "Unix time of the last workspace sync")
+		metrics.sample("hyper_workspace_last_sync_timestamp_seconds", nil, float64(stats.LastSyncAt.Unix()))
+	}
+
+	if containers, err := getContainerHealth(); err == nil {
+		metrics.describe("hyper_container_running", "gauge", "Whether the container is running")
+		for _, container := range containers {
+			metrics.sample("hyper_container_running", []string{"name", container.Name}, boolValue(container.Running))
+		}
+		metrics.describe("hyper_container_healthy", "gauge", "Whether the container is running and not failing its health check")
+		for _, container := range containers {
+			metrics.sample("hyper_container_healthy", []string{"name", container.Name}, boolValue(isHealthy(container)))
+		}
+	}
+
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	w.WriteHeader(http.StatusOK)
+	w.Write(metrics.Bytes())
+}
+
+// healthPage answers liveness checks, it succeeds as long as the endpoint is serving
+func healthPage(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	jsonBytes, _ := createJsonMessage("ok")
+	w.Write(jsonBytes)
+}
+
+// readyPage answers readiness checks, it succeeds once the remote server is ready and while none
+// of its containers are stopped or unhealthy
+func readyPage(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	remoteStatus, _, err := readStatusFile(filePath)
+	if err != nil {
+		w.Write(routeError("Internal server error", w, http.StatusInternalServerError))
+		fmt.Println("[remoteStatus] Could not retrieve statusFile: ", err)
+		return
+	}
+	if remoteStatus.Phase != types.PhaseReady {
+		phase := remoteStatus.Phase
+		if phase == "" {
+			phase = "unknown"
+		}
+		w.Write(routeError(fmt.Sprintf("Not ready, the phase is %s", phase), w, http.StatusServiceUnavailable))
+		return
+	}
+	if containers, err := getContainerHealth(); err == nil {
+		for _, container := range containers {
+			if !isHealthy(container) {
+				w.Write(routeError(fmt.Sprintf("Not ready, the container %s is unhealthy", container.Name), w, http.StatusServiceUnavailable))
+				return
+			}
+		}
+	}
+	w.WriteHeader(http.StatusOK)
+	jsonBytes, _ := createJsonMessage("ready")
+	w.Write(jsonBytes)
+}
+
+// getPhaseStart returns when the remote server entered its current phase: the first of the
+// latest events in that phase
+func getPhaseStart(remoteStatus types.RemoteStatus) time.Time {
+	start := remoteStatus.UpdatedAt
+	for i := len(remoteStatus.Events) - 1; i >= 0 && remoteStatus.Events[i].Phase == remoteStatus.Phase; i-- {
+		start = remoteStatus.Events[i].Time
+	}
+	return start
+}
+
+func readSyncStats() (types.WorkspaceSyncStats, error) {
+	var stats types.WorkspaceSyncStats
+	if workspacePath == "" {
+		return stats, os.ErrNotExist
+	}
+	content, err := os.ReadFile(filepath.Join(workspacePath, types.SYNC_STATS_FILE_NAME))
+	if err != nil {
+		return stats, err
+	}
+	err = json.Unmarshal(content, &stats)
+	return stats, err
+}
+
+func getContainerHealth() ([]types.ContainerHealth, error) {
+	if dockerClient == nil {
+		return nil, errors.New("docker is not available")
+	}
+	return dockerClient.GetContainerHealth()
+}
+
+func isHealthy(container types.ContainerHealth) bool {
+	return container.Running && container.Health != "unhealthy"
+}
+
+func boolValue(value bool) float64 {
+	if value {
+		return 1
+	}
+	return 0
+}
+
+// metricsWriter writes metrics in the Prometheus text format
+type metricsWriter struct {
+	bytes.Buffer
+}
+
+func (m *metricsWriter) describe(name string, metricType string, help string) {
+	fmt.Fprintf(m, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, metricType)
+}
+
+// sample writes a sample of a metric, with labels given as name, value pairs
+func (m *metricsWriter) sample(name string, labels []string, value float64) {
+	m.WriteString(name)
+	if len(labels) > 0 {
+		pairs := []string{}
+		for i := 0; i+1 < len(labels); i += 2 {
+			pairs = append(pairs, fmt.Sprintf("%s=%q", labels[i], labels[i+1]))
+		}
+		m.WriteString("{" + strings.Join(pairs, ",") + "}")
+	}
+	m.WriteString(" " + strconv.FormatFloat(value, 'f', -1, 64) + "\n")
+}
@@ -0,0 +1,60 @@
+package status
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/gohypergiant/hyperdrive/hyper/client/notify"
+	"github.com/gohypergiant/hyperdrive/hyper/services/config"
+	"github.com/gohypergiant/hyperdrive/hyper/types"
+)
+
+// STATUS_NOTIFY_RETRIES is how many times a phase notification is resent. Status updates are
+// made by the scripts that provision and shut down the instance, which can't wait on sinks that
+// are down.
+const STATUS_NOTIFY_RETRIES = 1
+
+// enteredPhase reports whether the last update of the status changed its phase
+func enteredPhase(status types.RemoteStatus) bool {
+	count := len(status.Events)
+	if count == 0 || status.Phase == "" {
+		return false
+	}
+	return count == 1 || status.Events[count-2].Phase != status.Phase
+}
+
+// notifyPhase notifies the sinks that the remote server entered its current phase
+func notifyPhase(status types.RemoteStatus, notificationsFile string) {
+	notifications, err := getNotificationsConfiguration(notificationsFile)
+	if err != nil {
+		fmt.Println("[remoteStatus] Could not read the notification sinks: ", err)
+		return
+	}
+	notify.NotifyWithRetries(notifications.Sinks, types.Notification{
+		Event:   types.NotificationEvent(status.Phase),
+		Source:  notifications.Source,
+		Message: status.Message,
+		Time:    status.UpdatedAt,
+	}, STATUS_NOTIFY_RETRIES)
+}
+
+// getNotificationsConfiguration reads the sinks written to the instance when it was started, or
+// takes them from the config without a notifications file. Notifications are then about the host.
+func getNotificationsConfiguration(notificationsFile string) (types.NotificationsConfiguration, error) {
+	var notifications types.NotificationsConfiguration
+	if notificationsFile == "" {
+		notifications.Sinks = config.GetNotificationSinks()
+		notifications.Source, _ = os.Hostname()
+		return notifications, nil
+	}
+	content, err := os.ReadFile(notificationsFile)
+	if os.IsNotExist(err) {
+		return notifications, nil
+	}
+	if err != nil {
+		return notifications, err
+	}
+	err = json.Unmarshal(content, &notifications)
+	return notifications, err
+}
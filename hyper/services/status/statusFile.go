@@ -5,8 +5,11 @@ import (
 	"fmt"
 	"io/ioutil"
 	"os"
+	"path/filepath"
+	"time"
 
 	"github.com/gohypergiant/hyperdrive/hyper/types"
+	"github.com/rogpeppe/go-internal/lockedfile"
 )
 
 func readStatusFile(filePath string) (types.RemoteStatus, []byte, error) {
@@ -28,23 +31,58 @@ func readStatusFile(filePath string) (types.RemoteStatus, []byte, error) {
   return jsonMap, jsonBytes, nil;
 }
 
-func writeStatusFile(status string, filepath string) error {
-  jsonString, jsonErr := createJsonMessage(status)
-
-  if jsonErr != nil {
-    return jsonErr
+/**
+  Applies an update to the status file: the update becomes the current state and is appended to
+  its events. A phase that isn't given is kept from the current state. Updates made at the same
+  time are applied one after the other, under a lock next to the file, and the file is replaced
+  atomically, so the endpoint never reads a partial update.
+*/
+func writeStatusFile(event types.RemoteStatusEvent, statusFilePath string) (types.RemoteStatus, error) {
+  unlock, err := lockedfile.MutexAt(statusFilePath + ".lock").Lock()
+  if err != nil {
+    return types.RemoteStatus{}, err
   }
+  defer unlock()
 
-  err := ioutil.WriteFile(filepath, jsonString, os.ModePerm) 
+  status, _, err := readStatusFile(statusFilePath)
   if err != nil {
-    return err
+    return status, err
   }
 
-  return nil;
-}
-
+  if event.Time.IsZero() {
+    event.Time = time.Now().UTC()
+  }
+  if event.Phase == "" {
+    event.Phase = status.Phase
+  }
+  status.Message = event.Message
+  status.Phase = event.Phase
+  status.Progress = event.Progress
+  status.UpdatedAt = event.Time
+  status.Events = append(status.Events, event)
 
+  jsonBytes, err := json.Marshal(status)
+  if err != nil {
+    return status, err
+  }
 
+  tmp, err := os.CreateTemp(filepath.Dir(statusFilePath), filepath.Base(statusFilePath)+".*.tmp")
+  if err != nil {
+    return status, err
+  }
+  defer os.Remove(tmp.Name())
+  _, err = tmp.Write(jsonBytes)
+  if closeErr := tmp.Close(); err == nil {
+    err = closeErr
+  }
+  if err == nil {
+    err = os.Chmod(tmp.Name(), 0644)
+  }
+  if err != nil {
+    return status, err
+  }
+  return status, os.Rename(tmp.Name(), statusFilePath)
+}
 
 func generateStatusFilePath(path string) string {
   workingdir, err := os.Getwd()
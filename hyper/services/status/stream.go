@@ -0,0 +1,150 @@
+package status
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/gohypergiant/hyperdrive/hyper/types"
+)
+
+// streamKeepAlive is how often an idle stream is sent a comment, so proxies and ssh tunnels
+// don't close it
+const streamKeepAlive = 15 * time.Second
+
+// statusBroadcaster sends the status to every stream whenever the status file changes. Each
+// stream only holds the latest status, so a slow client skips to it instead of blocking others.
+type statusBroadcaster struct {
+	mu          sync.Mutex
+	subscribers map[chan types.RemoteStatus]bool
+}
+
+var broadcaster = &statusBroadcaster{subscribers: map[chan types.RemoteStatus]bool{}}
+
+func (b *statusBroadcaster) subscribe() chan types.RemoteStatus {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	updates := make(chan types.RemoteStatus, 1)
+	b.subscribers[updates] = true
+	return updates
+}
+
+func (b *statusBroadcaster) unsubscribe(updates chan types.RemoteStatus) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	delete(b.subscribers, updates)
+}
+
+func (b *statusBroadcaster) broadcast(status types.RemoteStatus) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for updates := range b.subscribers {
+		select {
+		case <-updates:
+		default:
+		}
+		updates <- status
+	}
+}
+
+// watchStatusFile broadcasts the status whenever the status file is written. Its directory is
+// watched, as updates replace the file.
+func watchStatusFile(statusFilePath string) error {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return err
+	}
+	if err := watcher.Add(filepath.Dir(statusFilePath)); err != nil {
+		watcher.Close()
+		return err
+	}
+	go func() {
+		defer watcher.Close()
+		var last types.RemoteStatus
+		for {
+			select {
+			case event, ok := <-watcher.Events:
+				if !ok {
+					return
+				}
+				if filepath.Clean(event.Name) != filepath.Clean(statusFilePath) || event.Op&(fsnotify.Create|fsnotify.Write) == 0 {
+					continue
+				}
+				status, _, err := readStatusFile(statusFilePath)
+				if err != nil {
+					fmt.Println("[remoteStatus] Could not retrieve statusFile: ", err)
+					continue
+				}
+				if status.UpdatedAt.Equal(last.UpdatedAt) && len(status.Events) == len(last.Events) {
+					continue
+				}
+				last = status
+				broadcaster.broadcast(status)
+			case err, ok := <-watcher.Errors:
+				if !ok {
+					return
+				}
+				fmt.Println("[remoteStatus] Watch error: ", err)
+			}
+		}
+	}()
+	return nil
+}
+
+// statusStream supports route: `/status/stream`
+// It streams the status as server-sent events: the current status first if one is set, then
+// every update as it is made. Each event holds the whole status, with the number of events as
+// its id.
+func statusStream(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		w.Write(routeError("Streaming unsupported", w, http.StatusInternalServerError))
+		return
+	}
+	updates := broadcaster.subscribe()
+	defer broadcaster.unsubscribe(updates)
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.WriteHeader(http.StatusOK)
+
+	status, _, err := readStatusFile(filePath)
+	if err == nil && (status.Message != "" || len(status.Events) > 0) {
+		if err := writeStatusEvent(w, status); err != nil {
+			return
+		}
+	}
+	flusher.Flush()
+
+	keepAlive := time.NewTicker(streamKeepAlive)
+	defer keepAlive.Stop()
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case status := <-updates:
+			if err := writeStatusEvent(w, status); err != nil {
+				return
+			}
+		case <-keepAlive.C:
+			if _, err := fmt.Fprint(w, ": keep-alive\n\n"); err != nil {
+				return
+			}
+		}
+		flusher.Flush()
+	}
+}
+
+func writeStatusEvent(w http.ResponseWriter, status types.RemoteStatus) error {
+	jsonBytes, err := json.Marshal(status)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(w, "id: %d\nevent: status\ndata: %s\n\n", len(status.Events), jsonBytes)
+	return err
+}
@@ -0,0 +1,131 @@
+package status
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/gohypergiant/hyperdrive/hyper/client/firefly"
+	"github.com/gohypergiant/hyperdrive/hyper/types"
+)
+
+// JOBS_DIR is where training jobs are uploaded, in a directory per study
+const JOBS_DIR = "_jobs"
+
+// The executor writes STARTED to the job directory while it trains, and COMPLETED once it is done.
+// Training containers write FAILED instead when the training fails.
+const startedMarker = "STARTED"
+const completedMarker = "COMPLETED"
+const failedMarker = "FAILED"
+
+// LocalTrainingStatusProvider reads the status of a training from the marker files of its job
+// directory on disk
+type LocalTrainingStatusProvider struct {
+	JobsPath string
+}
+
+func (p LocalTrainingStatusProvider) GetTrainingStatus() (types.RemoteStatus, error) {
+	started, err := getLocalModTime(filepath.Join(p.JobsPath, startedMarker))
+	if err != nil {
+		return types.RemoteStatus{}, err
+	}
+	completed, err := getLocalModTime(filepath.Join(p.JobsPath, completedMarker))
+	if err != nil {
+		return types.RemoteStatus{}, err
+	}
+	failed, err := getLocalModTime(filepath.Join(p.JobsPath, failedMarker))
+	if err != nil {
+		return types.RemoteStatus{}, err
+	}
+	return getTrainingStatus(started, completed, failed), nil
+}
+
+func (p LocalTrainingStatusProvider) Close() {}
+
+// FireflyTrainingStatusProvider reads the status of a training from the marker files of its job
+// directory, through the contents API of the notebook server
+type FireflyTrainingStatusProvider struct {
+	Configuration types.FireflyComputeRemoteConfiguration
+	NotebookName  string
+	JobsPath      string
+}
+
+func (p FireflyTrainingStatusProvider) GetTrainingStatus() (types.RemoteStatus, error) {
+	started, _, err := firefly.GetFileModTime(p.Configuration, p.NotebookName, path.Join(p.JobsPath, startedMarker))
+	if err != nil {
+		return types.RemoteStatus{}, err
+	}
+	completed, _, err := firefly.GetFileModTime(p.Configuration, p.NotebookName, path.Join(p.JobsPath, completedMarker))
+	if err != nil {
+		return types.RemoteStatus{}, err
+	}
+	failed, _, err := firefly.GetFileModTime(p.Configuration, p.NotebookName, path.Join(p.JobsPath, failedMarker))
+	if err != nil {
+		return types.RemoteStatus{}, err
+	}
+	return getTrainingStatus(started, completed, failed), nil
+}
+
+func (p FireflyTrainingStatusProvider) Close() {}
+
+// getTrainingStatus builds the status of a training from when its marker files were written,
+// zero for those that don't exist. Only one marker is left in the job directory at a time.
+func getTrainingStatus(started time.Time, completed time.Time, failed time.Time) types.RemoteStatus {
+	switch {
+	case !started.IsZero():
+		event := types.RemoteStatusEvent{Time: started.UTC(), Phase: types.PhaseTraining, Message: "training started"}
+		return types.RemoteStatus{Message: event.Message, Phase: event.Phase, UpdatedAt: event.Time, Events: []types.RemoteStatusEvent{event}}
+	case !completed.IsZero():
+		event := types.RemoteStatusEvent{Time: completed.UTC(), Phase: types.PhaseTrainingCompleted, Message: "training completed"}
+		return types.RemoteStatus{Message: event.Message, Phase: event.Phase, UpdatedAt: event.Time, Events: []types.RemoteStatusEvent{event}}
+	case !failed.IsZero():
+		event := types.RemoteStatusEvent{Time: failed.UTC(), Phase: types.PhaseTrainingFailed, Message: "training failed"}
+		return types.RemoteStatus{Message: event.Message, Phase: event.Phase, UpdatedAt: event.Time, Events: []types.RemoteStatusEvent{event}}
+	}
+	return types.RemoteStatus{Message: "waiting for the training to start", Phase: types.PhaseTrainingPending}
+}
+
+func getLocalModTime(path string) (time.Time, error) {
+	info, err := os.Stat(path)
+	if os.IsNotExist(err) {
+		return time.Time{}, nil
+	}
+	if err != nil {
+		return time.Time{}, err
+	}
+	return info.ModTime(), nil
+}
+
+// trainingPage serves the status of the training of the study given with the `study` query
+// parameter, from the jobs of the workspace
+func trainingPage(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	study := r.URL.Query().Get("study")
+	if workspacePath == "" {
+		w.Write(routeError("No workspace set, start the endpoint with --workspace", w, http.StatusNotFound))
+		return
+	}
+	if study == "" || study == "." || study == ".." || strings.ContainsAny(study, "/\\") {
+		w.Write(routeError("Invalid study", w, http.StatusBadRequest))
+		return
+	}
+	provider := LocalTrainingStatusProvider{JobsPath: filepath.Join(workspacePath, JOBS_DIR, study)}
+	trainingStatus, err := provider.GetTrainingStatus()
+	if err != nil {
+		w.Write(routeError("Internal server error", w, http.StatusInternalServerError))
+		fmt.Println("[remoteStatus] Could not read the training status: ", err)
+		return
+	}
+	jsonBytes, err := json.Marshal(trainingStatus)
+	if err != nil {
+		w.Write(routeError("Internal server error", w, http.StatusInternalServerError))
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+	w.Write(jsonBytes)
+}
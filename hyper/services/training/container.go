@@ -0,0 +1,122 @@
+package training
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/mount"
+	"github.com/gohypergiant/hyperdrive/hyper/client/cli"
+	"github.com/gohypergiant/hyperdrive/hyper/services/notebook"
+	"github.com/gohypergiant/hyperdrive/hyper/types"
+)
+
+const containerJobsPath string = "/home/jovyan/_jobs"
+const executorNotebookPath string = "/tmp/repo/data/notebooks/executor-low-code.ipynb"
+const outputNotebookName string = "outs.ipynb"
+const containerCABundlePath string = "/etc/hyperdrive/ca-bundle.pem"
+
+// RunTrainingContainer trains a job that was uploaded to jobsPath in a short-lived container
+// started from the flavor's image, with only the job directory mounted. The container is removed
+// once the executor notebook finishes; the executed notebook is kept in the job directory and
+// archived with the run.
+func RunTrainingContainer(job types.TrainingJob, jobsPath string, options types.TrainingContainerOptions) {
+	hostJobPath, err := filepath.Abs(jobsPath)
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+	// the STARTED marker keeps the executor daemon of a running notebook server for this study
+	// from picking up the same job
+	setJobStatus(hostJobPath, "STARTED")
+
+	jobName := job.Metadata.StudyName
+	containerJobPath := path.Join(containerJobsPath, jobName)
+	dockerClient := cli.NewDockerClient()
+	imageOptions := notebook.GetNotebookImageOptions(options.Flavor)
+	containerName := fmt.Sprintf("%s-train-%s", strings.ToLower(jobName), job.Metadata.RunId)
+
+	env := options.Env
+	mounts := []mount.Mount{
+		{
+			Type:   mount.TypeBind,
+			Source: hostJobPath,
+			Target: containerJobPath,
+		},
+	}
+	if options.CABundle != "" {
+		caBundlePath, err := filepath.Abs(options.CABundle)
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+		mounts = append(mounts, mount.Mount{
+			Type:     mount.TypeBind,
+			Source:   caBundlePath,
+			Target:   containerCABundlePath,
+			ReadOnly: true,
+		})
+		env = append(env, fmt.Sprintf("AWS_CA_BUNDLE=%s", containerCABundlePath))
+	}
+
+	contConfig := &container.Config{
+		Image: imageOptions.Image,
+		Env:   env,
+		Cmd: []string{"papermill", executorNotebookPath, path.Join(containerJobPath, outputNotebookName),
+			"-p", "features", job.Metadata.FeaturesSource,
+			"-p", "target", job.Metadata.TargetSource,
+			"-p", "job_name", jobName,
+			"-p", "study_yaml", path.Join(containerJobPath, "_study.yaml")},
+	}
+	hostConfig := &container.HostConfig{
+		Mounts: mounts,
+		Resources: container.Resources{
+			NanoCPUs: int64(options.CPUs * 1e9),
+			Memory:   options.Memory,
+		},
+	}
+
+	fmt.Printf("Running training in container %s (%s)\n", containerName, imageOptions.Image)
+	pullImage := options.PullImage || !dockerClient.HasImage(imageOptions.Image)
+	exitCode, err := dockerClient.RunContainer(imageOptions.Image, containerName, contConfig, hostConfig, pullImage)
+	if err != nil || exitCode != 0 {
+		setJobStatus(hostJobPath, "FAILED")
+	} else {
+		setJobStatus(hostJobPath, "COMPLETED")
+	}
+
+	outputNotebookPath := path.Join(hostJobPath, outputNotebookName)
+	if _, statErr := os.Stat(outputNotebookPath); statErr == nil {
+		if archiveErr := ArchiveRunArtifact(job.Metadata.StudyName, job.Metadata.RunId, outputNotebookPath); archiveErr != nil {
+			fmt.Println("Could not archive the output notebook: ", archiveErr)
+		}
+		fmt.Printf("Executed notebook saved to %s\n", path.Join(jobsPath, outputNotebookName))
+	}
+	if err == cli.ErrInterrupted {
+		fmt.Println("Training interrupted")
+		os.Exit(1)
+	}
+	if err != nil {
+		fmt.Println("Error running the training container: ", err)
+		os.Exit(1)
+	}
+	if exitCode != 0 {
+		fmt.Printf("Training failed (exit code %d), see %s for the cell that failed\n", exitCode, path.Join(jobsPath, outputNotebookName))
+		os.Exit(1)
+	}
+}
+
+// setJobStatus leaves exactly one of the STARTED/COMPLETED/FAILED markers in the job directory
+func setJobStatus(jobPath string, status string) {
+	for _, marker := range []string{"STARTED", "COMPLETED", "FAILED"} {
+		_ = os.Remove(path.Join(jobPath, marker))
+	}
+	err := os.WriteFile(path.Join(jobPath, status), []byte{}, 0644)
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+}
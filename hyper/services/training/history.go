@@ -0,0 +1,256 @@
+package training
+
+import (
+	"archive/zip"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/gohypergiant/hyperdrive/hyper/types"
+)
+
+const runsDir string = "_runs"
+const runFileName string = "_run.json"
+const latestRunFileName string = "LATEST"
+
+func GetRunsPath(studyName string) string {
+	return path.Join(runsDir, studyName)
+}
+func GetRunPath(studyName string, runId string) string {
+	return path.Join(GetRunsPath(studyName), runId)
+}
+
+// RecordSubmittedRun archives a newly submitted training job under its run id, together with the
+// resolved manifest it was submitted with
+func RecordSubmittedRun(job types.TrainingJob, remoteName string) {
+	if remoteName == "" {
+		remoteName = "local"
+	}
+	run := types.TrainingRun{
+		TrainingJobMetadata: job.Metadata,
+		Remote:              remoteName,
+		Status:              types.TrainingRunSubmitted,
+		Trials:              []types.TrainingTrial{},
+	}
+	runPath := GetRunPath(run.StudyName, run.RunId)
+	err := os.MkdirAll(runPath, os.ModePerm)
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+	err = ioutil.WriteFile(path.Join(runPath, "_study.yaml"), job.Manifest, 0644)
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+	writeRun(run)
+	err = ioutil.WriteFile(path.Join(GetRunsPath(run.StudyName), latestRunFileName), []byte(run.RunId), 0644)
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+	fmt.Printf("Recorded training run %s\n", run.RunId)
+}
+
+// CompleteLatestRun marks the most recently submitted run of the study as completed at the given
+// time, archives the hyperpack with it and records the metrics of every trial in the hyperpack.
+// Without a completion time, the run completed when its hyperpack was last modified.
+func CompleteLatestRun(studyName string, hyperpackPath string, completedAt time.Time) {
+	latestRunId, err := ioutil.ReadFile(path.Join(GetRunsPath(studyName), latestRunFileName))
+	if err != nil {
+		fmt.Println("No submitted training run found, the hyperpack will not be added to the run history")
+		return
+	}
+	run, err := GetRun(studyName, string(latestRunId))
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	if run.Status == types.TrainingRunCompleted {
+		fmt.Printf("Training run %s has already been archived\n", run.RunId)
+		return
+	}
+
+	trials, bestTrial, err := readTrials(hyperpackPath)
+	if err != nil {
+		fmt.Println("Could not read trials from hyperpack: ", err)
+	}
+	err = copyFile(hyperpackPath, path.Join(GetRunPath(studyName, run.RunId), path.Base(hyperpackPath)))
+	if err != nil {
+		fmt.Println("Could not archive hyperpack: ", err)
+	}
+
+	run.Status = types.TrainingRunCompleted
+	if completedAt.IsZero() {
+		if info, err := os.Stat(hyperpackPath); err == nil {
+			completedAt = info.ModTime()
+		}
+	}
+	run.CompletedAt = completedAt.UTC()
+	run.Trials = trials
+	run.BestTrial = bestTrial
+	writeRun(run)
+	fmt.Printf("Archived training run %s (%d trials)\n", run.RunId, len(trials))
+}
+
+// ArchiveRunArtifact copies a file produced by a run (e.g. the executed notebook) into its archive
+func ArchiveRunArtifact(studyName string, runId string, artifactPath string) error {
+	return copyFile(artifactPath, path.Join(GetRunPath(studyName, runId), path.Base(artifactPath)))
+}
+
+// GetRuns returns every archived run of the study, oldest first
+func GetRuns(studyName string) []types.TrainingRun {
+	runs := []types.TrainingRun{}
+	entries, err := os.ReadDir(GetRunsPath(studyName))
+	if err != nil {
+		return runs
+	}
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+		run, err := readRun(studyName, entry.Name())
+		if err != nil {
+			fmt.Printf("Skipping run %s: %v\n", entry.Name(), err)
+			continue
+		}
+		runs = append(runs, run)
+	}
+	sort.Slice(runs, func(i, j int) bool {
+		return runs[i].SubmittedAt.Before(runs[j].SubmittedAt)
+	})
+	return runs
+}
+
+// GetRun returns the run with the given id. Any unique prefix of a run id is accepted,
+// as is "latest" for the most recently submitted run.
+func GetRun(studyName string, runId string) (types.TrainingRun, error) {
+	runs := GetRuns(studyName)
+	if runId == "latest" && len(runs) > 0 {
+		return runs[len(runs)-1], nil
+	}
+	var matches []types.TrainingRun
+	for _, run := range runs {
+		if run.RunId == runId {
+			return run, nil
+		}
+		if strings.HasPrefix(run.RunId, runId) {
+			matches = append(matches, run)
+		}
+	}
+	if len(matches) == 1 {
+		return matches[0], nil
+	}
+	if len(matches) > 1 {
+		return types.TrainingRun{}, fmt.Errorf("run id %q is ambiguous", runId)
+	}
+	return types.TrainingRun{}, fmt.Errorf("no run %q found for study %s", runId, studyName)
+}
+
+func readRun(studyName string, runId string) (types.TrainingRun, error) {
+	var run types.TrainingRun
+	runBytes, err := ioutil.ReadFile(path.Join(GetRunPath(studyName, runId), runFileName))
+	if err != nil {
+		return run, err
+	}
+	err = json.Unmarshal(runBytes, &run)
+	return run, err
+}
+
+func writeRun(run types.TrainingRun) {
+	runBytes, err := json.MarshalIndent(run, "", "  ")
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+	err = ioutil.WriteFile(path.Join(GetRunPath(run.StudyName, run.RunId), runFileName), runBytes, 0644)
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+}
+
+// readTrials reads every _trial.json in the hyperpack, along with the best trial from _study.json
+func readTrials(hyperpackPath string) ([]types.TrainingTrial, string, error) {
+	trials := []types.TrainingTrial{}
+	reader, err := zip.OpenReader(hyperpackPath)
+	if err != nil {
+		return trials, "", err
+	}
+	defer reader.Close()
+
+	bestTrial := ""
+	for _, file := range reader.File {
+		switch path.Base(file.Name) {
+		case "_trial.json":
+			trial := types.TrainingTrial{Name: path.Base(path.Dir(file.Name))}
+			if err := readZipJson(file, &trial); err != nil {
+				return trials, "", err
+			}
+			trials = append(trials, trial)
+		case "_study.json":
+			var study struct {
+				BestTrial string `json:"best_trial"`
+			}
+			if err := readZipJson(file, &study); err != nil {
+				return trials, "", err
+			}
+			bestTrial = study.BestTrial
+		}
+	}
+	sort.Slice(trials, func(i, j int) bool {
+		return trials[i].Name < trials[j].Name
+	})
+	return trials, bestTrial, nil
+}
+
+func readZipJson(file *zip.File, v interface{}) error {
+	f, err := file.Open()
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	content, err := io.ReadAll(f)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(content, v)
+}
+
+func copyFile(srcPath string, dstPath string) error {
+	in, err := os.Open(srcPath)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	out, err := os.Create(dstPath)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(out, in)
+	closeErr := out.Close()
+	if err != nil {
+		return err
+	}
+	return closeErr
+}
+
+// getBestTrial returns the run's best trial, falling back to the first trial if none was recorded
+func getBestTrial(run types.TrainingRun) (types.TrainingTrial, error) {
+	for _, trial := range run.Trials {
+		if trial.Name == run.BestTrial {
+			return trial, nil
+		}
+	}
+	if len(run.Trials) > 0 {
+		return run.Trials[0], nil
+	}
+	return types.TrainingTrial{}, errors.New("run has no trials")
+}
@@ -0,0 +1,213 @@
+package training
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/docker/go-units"
+	"github.com/gohypergiant/hyperdrive/hyper/types"
+	"github.com/google/uuid"
+	homedir "github.com/mitchellh/go-homedir"
+	"github.com/rogpeppe/go-internal/lockedfile"
+)
+
+const queueDirName string = ".hyperdrive_queue"
+const queueFileName string = "queue.json"
+const queueLogsDir string = "logs"
+
+// GetQueuePath returns the directory holding the queue state and job logs of this host
+func GetQueuePath() string {
+	home, err := homedir.Dir()
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+	return path.Join(home, queueDirName)
+}
+
+// SubmitJob adds a job to the end of the local training queue
+func SubmitJob(job types.QueuedTrainingJob) types.QueuedTrainingJob {
+	job.Id = strings.Split(uuid.NewString(), "-")[0]
+	job.Status = types.QueuedJobQueued
+	job.SubmittedAt = time.Now().UTC()
+	job.LogPath = path.Join(GetQueuePath(), queueLogsDir, fmt.Sprintf("%s.log", job.Id))
+	if job.Overrides == nil {
+		job.Overrides = []string{}
+	}
+	err := updateQueue(func(queue *types.TrainingQueue) error {
+		queue.Jobs = append(queue.Jobs, job)
+		return nil
+	})
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+	return job
+}
+
+// CancelJob cancels a queued job, or asks the worker to stop a running one
+func CancelJob(jobId string) {
+	err := updateQueue(func(queue *types.TrainingQueue) error {
+		for i, job := range queue.Jobs {
+			if job.Id != jobId {
+				continue
+			}
+			if job.Status != types.QueuedJobQueued && job.Status != types.QueuedJobRunning {
+				return fmt.Errorf("job %s has already %s", jobId, job.Status)
+			}
+			queue.Jobs[i].Status = types.QueuedJobCancelled
+			queue.Jobs[i].FinishedAt = time.Now().UTC()
+			return nil
+		}
+		return fmt.Errorf("no job %s in the queue", jobId)
+	})
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+	fmt.Printf("Cancelled job %s\n", jobId)
+}
+
+// ClearFinishedJobs removes completed, failed and cancelled jobs from the queue
+func ClearFinishedJobs() {
+	err := updateQueue(func(queue *types.TrainingQueue) error {
+		jobs := []types.QueuedTrainingJob{}
+		for _, job := range queue.Jobs {
+			if job.Status == types.QueuedJobQueued || job.Status == types.QueuedJobRunning {
+				jobs = append(jobs, job)
+			}
+		}
+		queue.Jobs = jobs
+		return nil
+	})
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+}
+
+// PrintQueue prints every job in the local training queue
+func PrintQueue() {
+	queue, err := readQueue()
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+	if queue.WorkerPid != 0 && isProcessRunning(queue.WorkerPid) {
+		fmt.Printf("Worker running (pid %d)\n\n", queue.WorkerPid)
+	} else {
+		fmt.Printf("No worker running, start one with `hyper train worker`\n\n")
+	}
+	if len(queue.Jobs) == 0 {
+		fmt.Println("The training queue is empty")
+		return
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "JOB ID\tSTUDY\tSTATUS\tCPUS\tMEMORY\tSUBMITTED\tDURATION\tPATH")
+	for _, job := range queue.Jobs {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\n",
+			job.Id,
+			job.StudyName,
+			formatJobStatus(job),
+			formatCPUs(job.CPUs),
+			formatMemory(job.Memory),
+			job.SubmittedAt.Local().Format(time.RFC822),
+			formatDuration(getJobDuration(job)),
+			job.StudyPath)
+	}
+	w.Flush()
+}
+
+func formatJobStatus(job types.QueuedTrainingJob) string {
+	if job.Status == types.QueuedJobFailed && job.Error != "" {
+		return fmt.Sprintf("%s (%s)", job.Status, job.Error)
+	}
+	return string(job.Status)
+}
+
+func formatCPUs(cpus float64) string {
+	if cpus == 0 {
+		return "-"
+	}
+	return fmt.Sprintf("%g", cpus)
+}
+
+func formatMemory(memory int64) string {
+	if memory == 0 {
+		return "-"
+	}
+	return units.BytesSize(float64(memory))
+}
+
+func getJobDuration(job types.QueuedTrainingJob) time.Duration {
+	if job.StartedAt.IsZero() {
+		return 0
+	}
+	if job.FinishedAt.IsZero() {
+		return time.Since(job.StartedAt)
+	}
+	return job.FinishedAt.Sub(job.StartedAt)
+}
+
+func getQueueFilePath() string {
+	return path.Join(GetQueuePath(), queueFileName)
+}
+
+func readQueue() (types.TrainingQueue, error) {
+	queue := types.TrainingQueue{Jobs: []types.QueuedTrainingJob{}}
+	content, err := lockedfile.Read(getQueueFilePath())
+	if errors.Is(err, os.ErrNotExist) {
+		return queue, nil
+	}
+	if err != nil {
+		return queue, err
+	}
+	if len(content) == 0 {
+		return queue, nil
+	}
+	err = json.Unmarshal(content, &queue)
+	return queue, err
+}
+
+// updateQueue applies update to the queue state while holding the queue file lock, so the
+// worker and the CLI can safely modify the queue at the same time
+func updateQueue(update func(queue *types.TrainingQueue) error) error {
+	err := os.MkdirAll(path.Join(GetQueuePath(), queueLogsDir), os.ModePerm)
+	if err != nil {
+		return err
+	}
+	file, err := lockedfile.Edit(getQueueFilePath())
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	content, err := io.ReadAll(file)
+	if err != nil {
+		return err
+	}
+	queue := types.TrainingQueue{Jobs: []types.QueuedTrainingJob{}}
+	if len(content) > 0 {
+		if err := json.Unmarshal(content, &queue); err != nil {
+			return err
+		}
+	}
+	if err := update(&queue); err != nil {
+		return err
+	}
+	content, err = json.MarshalIndent(queue, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := file.Truncate(0); err != nil {
+		return err
+	}
+	_, err = file.WriteAt(content, 0)
+	return err
+}
@@ -0,0 +1,211 @@
+package training
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/gohypergiant/hyperdrive/hyper/types"
+	"gopkg.in/yaml.v2"
+)
+
+// PrintHistory prints every archived run of the study along with the metrics of its best trial
+func PrintHistory(studyName string) {
+	runs := GetRuns(studyName)
+	if len(runs) == 0 {
+		fmt.Printf("No training runs recorded for study %s\n", studyName)
+		return
+	}
+
+	metricNames := getMetricNames(runs)
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(w, "RUN ID\tSUBMITTED\tREMOTE\tSTATUS\tDURATION\tBEST TRIAL\t%s\n", strings.ToUpper(strings.Join(metricNames, "\t")))
+	for _, run := range runs {
+		bestTrial, _ := getBestTrial(run)
+		metrics := make([]string, len(metricNames))
+		for i, name := range metricNames {
+			metrics[i] = formatMetric(bestTrial.Metrics, name)
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\t%s\n",
+			run.RunId,
+			run.SubmittedAt.Local().Format(time.RFC822),
+			run.Remote,
+			run.Status,
+			formatDuration(run.Duration()),
+			bestTrial.Name,
+			strings.Join(metrics, "\t"))
+	}
+	w.Flush()
+}
+
+// CompareRuns prints two runs of the study side by side: their outcome, best trial metrics,
+// overrides, data checksums and the differences between their resolved manifests
+func CompareRuns(studyName string, runIdA string, runIdB string) {
+	runA, err := GetRun(studyName, runIdA)
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+	runB, err := GetRun(studyName, runIdB)
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+	bestTrialA, _ := getBestTrial(runA)
+	bestTrialB, _ := getBestTrial(runB)
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(w, "\t%s\t%s\t\n", runA.RunId, runB.RunId)
+	fmt.Fprintf(w, "Submitted\t%s\t%s\t\n", runA.SubmittedAt.Local().Format(time.RFC822), runB.SubmittedAt.Local().Format(time.RFC822))
+	fmt.Fprintf(w, "Remote\t%s\t%s\t\n", runA.Remote, runB.Remote)
+	fmt.Fprintf(w, "Status\t%s\t%s\t\n", runA.Status, runB.Status)
+	fmt.Fprintf(w, "Duration\t%s\t%s\t\n", formatDuration(runA.Duration()), formatDuration(runB.Duration()))
+	fmt.Fprintf(w, "Trials\t%d\t%d\t\n", len(runA.Trials), len(runB.Trials))
+	fmt.Fprintf(w, "Best trial\t%s\t%s\t\n", bestTrialA.Name, bestTrialB.Name)
+
+	fmt.Fprintln(w, "\t\t\t")
+	fmt.Fprintln(w, "Metrics (best trial)\t\t\t")
+	for _, name := range getMetricNames([]types.TrainingRun{runA, runB}) {
+		delta := ""
+		valueA, okA := bestTrialA.Metrics[name]
+		valueB, okB := bestTrialB.Metrics[name]
+		if okA && okB {
+			delta = fmt.Sprintf("%+.4g", valueB-valueA)
+		}
+		fmt.Fprintf(w, "  %s\t%s\t%s\t%s\n", name, formatMetric(bestTrialA.Metrics, name), formatMetric(bestTrialB.Metrics, name), delta)
+	}
+
+	fmt.Fprintln(w, "\t\t\t")
+	fmt.Fprintln(w, "Data\t\t\t")
+	for _, name := range []string{"features", "target"} {
+		checksumA, checksumB := runA.DataChecksums[name], runB.DataChecksums[name]
+		changed := "unchanged"
+		if checksumA != checksumB {
+			changed = "changed"
+		}
+		fmt.Fprintf(w, "  %s\t%s\t%s\t%s\n", name, shortChecksum(checksumA), shortChecksum(checksumB), changed)
+	}
+
+	fmt.Fprintln(w, "\t\t\t")
+	fmt.Fprintf(w, "Overrides\t%s\t%s\t\n", formatOverrides(runA.Overrides), formatOverrides(runB.Overrides))
+	w.Flush()
+
+	fmt.Println()
+	fmt.Println("Manifest changes:")
+	manifestA := flattenRunManifest(runA)
+	manifestB := flattenRunManifest(runB)
+	keys := map[string]bool{}
+	for key := range manifestA {
+		keys[key] = true
+	}
+	for key := range manifestB {
+		keys[key] = true
+	}
+	changedKeys := []string{}
+	for key := range keys {
+		if manifestA[key] != manifestB[key] {
+			changedKeys = append(changedKeys, key)
+		}
+	}
+	sort.Strings(changedKeys)
+	if len(changedKeys) == 0 {
+		fmt.Println("  none")
+	}
+	for _, key := range changedKeys {
+		fmt.Printf("  %s: %s -> %s\n", key, formatManifestValue(manifestA, key), formatManifestValue(manifestB, key))
+	}
+}
+
+func getMetricNames(runs []types.TrainingRun) []string {
+	names := map[string]bool{}
+	for _, run := range runs {
+		bestTrial, _ := getBestTrial(run)
+		for name := range bestTrial.Metrics {
+			names[name] = true
+		}
+	}
+	metricNames := []string{}
+	for name := range names {
+		metricNames = append(metricNames, name)
+	}
+	sort.Strings(metricNames)
+	return metricNames
+}
+
+func formatMetric(metrics map[string]float64, name string) string {
+	value, ok := metrics[name]
+	if !ok {
+		return "-"
+	}
+	return fmt.Sprintf("%.4g", value)
+}
+
+func formatDuration(duration time.Duration) string {
+	if duration == 0 {
+		return "-"
+	}
+	return duration.Round(time.Second).String()
+}
+
+func formatOverrides(overrides []string) string {
+	if len(overrides) == 0 {
+		return "-"
+	}
+	return strings.Join(overrides, " ")
+}
+
+func formatManifestValue(manifest map[string]string, key string) string {
+	value, ok := manifest[key]
+	if !ok {
+		return "(unset)"
+	}
+	return value
+}
+
+func shortChecksum(checksum string) string {
+	if checksum == "" {
+		return "-"
+	}
+	if len(checksum) > 19 {
+		return checksum[:19]
+	}
+	return checksum
+}
+
+// flattenRunManifest reads the run's archived manifest into a map of dotted key paths to values
+func flattenRunManifest(run types.TrainingRun) map[string]string {
+	flattened := map[string]string{}
+	manifestBytes, err := ioutil.ReadFile(path.Join(GetRunPath(run.StudyName, run.RunId), "_study.yaml"))
+	if err != nil {
+		return flattened
+	}
+	var document yaml.MapSlice
+	if err := yaml.Unmarshal(manifestBytes, &document); err != nil {
+		return flattened
+	}
+	flattenDocument(document, "", flattened)
+	return flattened
+}
+
+func flattenDocument(document yaml.MapSlice, prefix string, flattened map[string]string) {
+	for _, item := range document {
+		key := fmt.Sprint(item.Key)
+		if prefix != "" {
+			key = prefix + "." + key
+		}
+		if child, ok := item.Value.(yaml.MapSlice); ok {
+			flattenDocument(child, key, flattened)
+			continue
+		}
+		valueBytes, err := yaml.Marshal(item.Value)
+		if err != nil {
+			continue
+		}
+		flattened[key] = strings.TrimSpace(strings.ReplaceAll(string(valueBytes), "\n", " "))
+	}
+}
@@ -0,0 +1,109 @@
+package training
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/gohypergiant/hyperdrive/hyper/client/manifest"
+	"github.com/gohypergiant/hyperdrive/hyper/client/notify"
+	"github.com/gohypergiant/hyperdrive/hyper/services/config"
+	"github.com/gohypergiant/hyperdrive/hyper/services/notebook"
+	"github.com/gohypergiant/hyperdrive/hyper/services/remote"
+	"github.com/gohypergiant/hyperdrive/hyper/services/status"
+	"github.com/gohypergiant/hyperdrive/hyper/types"
+)
+
+// TrainingStatusProvider returns the provider of the status of the study's training on the
+// compute remote, or of a local training without one
+func TrainingStatusProvider(remoteName string, manifestPath string) types.ITrainingStatusProvider {
+	if remoteName == "" {
+		return status.LocalTrainingStatusProvider{
+			JobsPath: notebook.LocalNotebookService{ManifestPath: manifestPath}.GetJobsPath(),
+		}
+	}
+	remoteConfiguration := config.GetComputeRemote(remoteName)
+	if remoteConfiguration.Type == types.EC2 {
+		return &remote.EC2TrainingStatusProvider{
+			ComputeRemoteService: remote.ComputeRemoteService{RemoteConfiguration: remoteConfiguration, ManifestPath: manifestPath},
+			StudyName:            manifest.GetName(manifestPath),
+		}
+	}
+	return status.FireflyTrainingStatusProvider{
+		Configuration: remoteConfiguration.FireflyConfiguration,
+		NotebookName:  notebook.GetNotebookName(manifestPath),
+		JobsPath:      notebook.RemoteNotebookService{ManifestPath: manifestPath}.GetStudyRoot(),
+	}
+}
+
+// WaitForTrainingToComplete polls the status of the study's training until it completes, and
+// notifies the sinks of the config once it has. The status can't always be read, e.g. while the
+// backend restarts, so errors are reported and polling goes on until the timeout, in seconds.
+// The status of the completed training is returned.
+func WaitForTrainingToComplete(provider types.ITrainingStatusProvider, studyName string, timeout int) types.RemoteStatus {
+	defer provider.Close()
+
+	fmt.Print("Waiting for training to complete")
+	fmt.Println()
+	for i := 0; i <= timeout; i++ {
+		if i%3 == 0 || i == timeout {
+			trainingStatus, err := provider.GetTrainingStatus()
+			if err != nil {
+				fmt.Printf("\nCould not read the training status: %v\nWaiting.", err)
+			} else if trainingStatus.Phase == types.PhaseTrainingCompleted {
+				fmt.Println()
+				fmt.Println("Training completed")
+				notify.Notify(config.GetNotificationSinks(), types.Notification{
+					Event:   types.NotifyTrainingCompleted,
+					Source:  studyName,
+					Message: fmt.Sprintf("The hyperpackage can be fetched as %s.hyperpack.zip", studyName),
+				})
+				return trainingStatus
+			} else if trainingStatus.Phase == types.PhaseTrainingFailed {
+				fmt.Println()
+				fmt.Println("Training failed")
+				notify.Notify(config.GetNotificationSinks(), types.Notification{
+					Event:   types.NotifyTrainingFailed,
+					Source:  studyName,
+					Message: "No hyperpackage was produced",
+				})
+				os.Exit(1)
+			} else {
+				fmt.Printf("\nTraining status: %s.\nWaiting.", trainingStatus.Phase)
+			}
+		} else {
+			fmt.Print(".")
+		}
+		time.Sleep(1 * time.Second)
+	}
+	fmt.Println()
+	fmt.Println("Timed out waiting for study to complete")
+	os.Exit(1)
+	return types.RemoteStatus{}
+}
+
+// PrintTrainingStatus prints the status of the study's training, as JSON in the schema of the
+// status endpoint if asJson is set
+func PrintTrainingStatus(provider types.ITrainingStatusProvider, asJson bool) {
+	defer provider.Close()
+	trainingStatus, err := provider.GetTrainingStatus()
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+	if asJson {
+		jsonBytes, err := json.MarshalIndent(trainingStatus, "", "  ")
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+		fmt.Println(string(jsonBytes))
+		return
+	}
+	fmt.Printf("Phase:    %s\n", trainingStatus.Phase)
+	fmt.Printf("Message:  %s\n", trainingStatus.Message)
+	if !trainingStatus.UpdatedAt.IsZero() {
+		fmt.Printf("Updated:  %s (%s ago)\n", trainingStatus.UpdatedAt.Local().Format(time.RFC1123), time.Since(trainingStatus.UpdatedAt).Round(time.Second))
+	}
+}
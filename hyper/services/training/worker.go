@@ -0,0 +1,279 @@
+package training
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"os/signal"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/gohypergiant/hyperdrive/hyper/types"
+)
+
+const workerPollInterval = 5 * time.Second
+
+type jobResult struct {
+	jobId string
+	err   error
+}
+
+type runningJob struct {
+	job    types.QueuedTrainingJob
+	cancel context.CancelFunc
+}
+
+// RunWorker runs the jobs of the local training queue, at most options.Concurrency at a time and
+// within the CPU and memory budget. Jobs are started in submission order; a job that doesn't fit
+// in the remaining budget holds back the jobs behind it so large jobs are not starved.
+// Unless options.Follow is set, the worker exits once the queue is drained.
+func RunWorker(options types.TrainingWorkerOptions) {
+	err := registerWorker()
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+	fmt.Printf("Training worker started (concurrency %d, cpus %s, memory %s)\n",
+		options.Concurrency, formatCPUs(options.CPUs), formatMemory(options.Memory))
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	results := make(chan jobResult)
+	running := map[string]runningJob{}
+	ticker := time.NewTicker(workerPollInterval)
+	defer ticker.Stop()
+
+	for {
+		pending := 0
+		err := updateQueue(func(queue *types.TrainingQueue) error {
+			pending = scheduleJobs(queue, running, options, results)
+			return nil
+		})
+		if err != nil {
+			fmt.Println("Could not update the training queue: ", err)
+		}
+		if !options.Follow && pending == 0 && len(running) == 0 {
+			break
+		}
+
+		select {
+		case result := <-results:
+			finishJob(result, running)
+		case <-ticker.C:
+		case <-signals:
+			fmt.Println("Stopping training worker, running jobs will be requeued")
+			for _, r := range running {
+				r.cancel()
+			}
+			for len(running) > 0 {
+				result := <-results
+				delete(running, result.jobId)
+			}
+			unregisterWorker(true)
+			os.Exit(1)
+		}
+	}
+	unregisterWorker(false)
+	fmt.Println("Training queue drained")
+}
+
+// scheduleJobs cancels running jobs that were cancelled from the CLI and starts queued jobs that
+// fit in the worker budget. It returns the number of jobs still waiting to be run.
+func scheduleJobs(queue *types.TrainingQueue, running map[string]runningJob, options types.TrainingWorkerOptions, results chan jobResult) int {
+	usedCPUs, usedMemory := 0.0, int64(0)
+	runningStudies := map[string]bool{}
+	for _, job := range queue.Jobs {
+		r, ok := running[job.Id]
+		if !ok {
+			continue
+		}
+		if job.Status == types.QueuedJobCancelled {
+			fmt.Printf("Stopping cancelled job %s (%s)\n", job.Id, job.StudyName)
+			r.cancel()
+			continue
+		}
+		usedCPUs += job.CPUs
+		usedMemory += job.Memory
+		runningStudies[job.StudyName] = true
+	}
+
+	pending := 0
+	blocked := false
+	for i, job := range queue.Jobs {
+		if job.Status != types.QueuedJobQueued {
+			continue
+		}
+		if (options.CPUs > 0 && job.CPUs > options.CPUs) || (options.Memory > 0 && job.Memory > options.Memory) {
+			queue.Jobs[i].Status = types.QueuedJobFailed
+			queue.Jobs[i].Error = "job requests more resources than the worker budget"
+			queue.Jobs[i].FinishedAt = time.Now().UTC()
+			continue
+		}
+		pending++
+		// a second job for the same study would share its _jobs directory
+		if blocked || runningStudies[job.StudyName] {
+			continue
+		}
+		if len(running) >= options.Concurrency ||
+			(options.CPUs > 0 && usedCPUs+job.CPUs > options.CPUs) ||
+			(options.Memory > 0 && usedMemory+job.Memory > options.Memory) {
+			blocked = true
+			continue
+		}
+
+		job.Status = types.QueuedJobRunning
+		job.StartedAt = time.Now().UTC()
+		job.Error = ""
+		queue.Jobs[i] = job
+		ctx, cancel := context.WithCancel(context.Background())
+		running[job.Id] = runningJob{job: job, cancel: cancel}
+		usedCPUs += job.CPUs
+		usedMemory += job.Memory
+		runningStudies[job.StudyName] = true
+		pending--
+		fmt.Printf("Starting job %s (%s), logging to %s\n", job.Id, job.StudyName, job.LogPath)
+		go func(job types.QueuedTrainingJob) {
+			results <- jobResult{jobId: job.Id, err: runJob(ctx, job)}
+		}(job)
+	}
+	return pending
+}
+
+func finishJob(result jobResult, running map[string]runningJob) {
+	r := running[result.jobId]
+	delete(running, result.jobId)
+	r.cancel()
+	err := updateQueue(func(queue *types.TrainingQueue) error {
+		for i, job := range queue.Jobs {
+			if job.Id != result.jobId {
+				continue
+			}
+			if job.Status == types.QueuedJobCancelled {
+				return nil
+			}
+			queue.Jobs[i].FinishedAt = time.Now().UTC()
+			if result.err != nil {
+				queue.Jobs[i].Status = types.QueuedJobFailed
+				queue.Jobs[i].Error = result.err.Error()
+				fmt.Printf("Job %s (%s) failed: %v\n", job.Id, job.StudyName, result.err)
+			} else {
+				queue.Jobs[i].Status = types.QueuedJobCompleted
+				fmt.Printf("Job %s (%s) completed\n", job.Id, job.StudyName)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		fmt.Println("Could not update the training queue: ", err)
+	}
+}
+
+// runJob runs a queued job from its study directory with the same commands a user would: the job
+// is trained in its own container, limited to the job's resources, and its hyperpack fetched
+func runJob(ctx context.Context, job types.QueuedTrainingJob) error {
+	logFile, err := os.OpenFile(job.LogPath, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	defer logFile.Close()
+	hyper, err := os.Executable()
+	if err != nil {
+		return err
+	}
+	run := func(args ...string) error {
+		args = append(args, "--manifestPath", job.ManifestPath)
+		fmt.Fprintf(logFile, "$ hyper %s\n", strings.Join(args, " "))
+		command := exec.Command(hyper, args...)
+		command.Dir = job.StudyPath
+		command.Stdout = logFile
+		command.Stderr = logFile
+		if err := command.Start(); err != nil {
+			return err
+		}
+		// interrupt rather than kill, so hyper train gets to remove its training container
+		done := make(chan struct{})
+		go func() {
+			select {
+			case <-ctx.Done():
+				_ = command.Process.Signal(os.Interrupt)
+			case <-done:
+			}
+		}()
+		err := command.Wait()
+		close(done)
+		if err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			return fmt.Errorf("hyper %s: %v", args[0], err)
+		}
+		return nil
+	}
+
+	trainArgs := []string{"train", "--image", job.Flavor}
+	if job.CPUs > 0 {
+		trainArgs = append(trainArgs, "--cpus", strconv.FormatFloat(job.CPUs, 'f', -1, 64))
+	}
+	if job.Memory > 0 {
+		trainArgs = append(trainArgs, "--memory", strconv.FormatInt(job.Memory, 10))
+	}
+	for _, override := range job.Overrides {
+		trainArgs = append(trainArgs, "--set", override)
+	}
+	if job.StageRemoteData {
+		trainArgs = append(trainArgs, "--stageData")
+	}
+	if job.WorkspaceRemote != "" {
+		trainArgs = append(trainArgs, "--workspaceRemote", job.WorkspaceRemote)
+	}
+	if err := run(trainArgs...); err != nil {
+		return err
+	}
+	return run("train", "fetch")
+}
+
+// registerWorker records this process as the queue's worker. Jobs left running by a worker that
+// is no longer alive are put back in the queue.
+func registerWorker() error {
+	return updateQueue(func(queue *types.TrainingQueue) error {
+		if queue.WorkerPid != 0 && queue.WorkerPid != os.Getpid() && isProcessRunning(queue.WorkerPid) {
+			return fmt.Errorf("a training worker is already running (pid %d)", queue.WorkerPid)
+		}
+		queue.WorkerPid = os.Getpid()
+		requeueRunningJobs(queue)
+		return nil
+	})
+}
+
+func unregisterWorker(requeue bool) {
+	err := updateQueue(func(queue *types.TrainingQueue) error {
+		queue.WorkerPid = 0
+		if requeue {
+			requeueRunningJobs(queue)
+		}
+		return nil
+	})
+	if err != nil {
+		fmt.Println("Could not update the training queue: ", err)
+	}
+}
+
+func requeueRunningJobs(queue *types.TrainingQueue) {
+	for i, job := range queue.Jobs {
+		if job.Status == types.QueuedJobRunning {
+			queue.Jobs[i].Status = types.QueuedJobQueued
+			queue.Jobs[i].StartedAt = time.Time{}
+		}
+	}
+}
+
+func isProcessRunning(pid int) bool {
+	process, err := os.FindProcess(pid)
+	if err != nil {
+		return false
+	}
+	return process.Signal(syscall.Signal(0)) == nil
+}
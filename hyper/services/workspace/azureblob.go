@@ -0,0 +1,74 @@
+package workspace
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/gohypergiant/hyperdrive/hyper/client/azure"
+	"github.com/gohypergiant/hyperdrive/hyper/types"
+)
+
+// AzureBlobWorkspaceBackend keeps workspaces in an Azure Blob Storage container. Blobs are
+// uploaded with their MD5, which is used as their ETag.
+type AzureBlobWorkspaceBackend struct {
+	AzureBlobConfiguration types.AzureBlobWorkspacePersistenceRemoteConfiguration
+}
+
+func (b AzureBlobWorkspaceBackend) GetUrl(key string) string {
+	return fmt.Sprintf("azureblob://%s/%s/%s", b.AzureBlobConfiguration.AccountName, b.AzureBlobConfiguration.ContainerName, key)
+}
+
+func (b AzureBlobWorkspaceBackend) List(prefix string) ([]types.ObjectInfo, error) {
+	return azure.ListObjects(b.AzureBlobConfiguration, prefix)
+}
+
+func (b AzureBlobWorkspaceBackend) Stat(key string) (types.ObjectInfo, error) {
+	return azure.GetObjectInfo(b.AzureBlobConfiguration, key)
+}
+
+func (b AzureBlobWorkspaceBackend) Upload(filename string, key string) (types.ObjectInfo, error) {
+	return azure.UploadFile(b.AzureBlobConfiguration, filename, key, nil)
+}
+
+func (b AzureBlobWorkspaceBackend) UploadWithMetadata(filename string, key string, metadata map[string]string) (types.ObjectInfo, error) {
+	return azure.UploadFile(b.AzureBlobConfiguration, filename, key, metadata)
+}
+
+func (b AzureBlobWorkspaceBackend) Download(key string, filename string) error {
+	return azure.DownloadFile(b.AzureBlobConfiguration, key, filename)
+}
+
+func (b AzureBlobWorkspaceBackend) Delete(key string) error {
+	return azure.DeleteObject(b.AzureBlobConfiguration, key)
+}
+
+func (b AzureBlobWorkspaceBackend) Copy(srcKey string, versionId string, dstKey string) (types.ObjectInfo, error) {
+	return azure.CopyObject(b.AzureBlobConfiguration, srcKey, versionId, dstKey)
+}
+
+func (b AzureBlobWorkspaceBackend) ReadObject(key string) ([]byte, error) {
+	return azure.GetObjectContent(b.AzureBlobConfiguration, key)
+}
+
+func (b AzureBlobWorkspaceBackend) WriteObject(key string, content []byte) error {
+	return azure.PutObjectContent(b.AzureBlobConfiguration, key, content)
+}
+
+// IsVersioned is always false. Blob versioning is a setting of the storage account that a
+// container's credentials can't read, so snapshots always keep copies of the blobs.
+func (b AzureBlobWorkspaceBackend) IsVersioned() (bool, error) {
+	return false, nil
+}
+
+func (b AzureBlobWorkspaceBackend) ListCurrentVersions(prefix string) ([]types.ObjectInfo, error) {
+	return nil, errors.New("azureblob workspace remotes don't list blob versions")
+}
+
+// SameContent compares a local file with a blob by its MD5
+func (b AzureBlobWorkspaceBackend) SameContent(filename string, object types.ObjectInfo) (bool, error) {
+	if same, err := sameSize(filename, object); !same || err != nil {
+		return false, err
+	}
+	etag, err := computeETag(filename, "")
+	return etag == object.ETag, err
+}
@@ -0,0 +1,333 @@
+package workspace
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/gohypergiant/hyperdrive/hyper/client/encryption"
+	"github.com/gohypergiant/hyperdrive/hyper/types"
+)
+
+// ENCRYPTION_PARAMS_KEY holds the salt that passphrases are derived into keys with, at the root
+// of the workspace remote so every machine derives the same key from the same passphrase
+const ENCRYPTION_PARAMS_KEY string = ".hyperdrive-encryption.json"
+
+// PLAINTEXT_HASH_METADATA is the object metadata that holds the SHA-256 of the file an encrypted
+// object was encrypted from, so the file can be compared without downloading the object
+const PLAINTEXT_HASH_METADATA string = "hyperdrive_plaintext_sha256"
+
+type encryptionParams struct {
+	KDF   string `json:"kdf"`
+	Salt  []byte `json:"salt"`
+	N     int    `json:"n"`
+	R     int    `json:"r"`
+	P     int    `json:"p"`
+	KeyId string `json:"key_id"`
+}
+
+// EncryptedWorkspaceBackend encrypts files before they are uploaded to another backend, and
+// decrypts them when they are downloaded. Objects that aren't encrypted, such as those
+// uploaded before encryption was enabled, are downloaded as they are. Object sizes and ETags
+// are those of the encrypted objects.
+type EncryptedWorkspaceBackend struct {
+	Backend types.IWorkspaceBackend
+	Key     encryption.Key
+}
+
+// NewEncryptedWorkspaceBackend loads the key of the encryption configuration. A passphrase is
+// derived into a key with the salt kept on the remote, which is created on first use.
+func NewEncryptedWorkspaceBackend(backend types.IWorkspaceBackend, encryptionConfig types.WorkspaceEncryptionConfiguration) (EncryptedWorkspaceBackend, error) {
+	if encryptionConfig.KeyFile != "" {
+		key, err := encryption.LoadKeyFile(encryptionConfig.KeyFile)
+		return EncryptedWorkspaceBackend{Backend: backend, Key: key}, err
+	}
+	key, err := deriveWorkspaceKey(backend, encryptionConfig.Passphrase)
+	return EncryptedWorkspaceBackend{Backend: backend, Key: key}, err
+}
+
+func deriveWorkspaceKey(backend types.IWorkspaceBackend, passphrase string) (encryption.Key, error) {
+	info, err := backend.Stat(ENCRYPTION_PARAMS_KEY)
+	if err != nil {
+		return encryption.Key{}, err
+	}
+	if info.Exists {
+		content, err := backend.ReadObject(ENCRYPTION_PARAMS_KEY)
+		if err != nil {
+			return encryption.Key{}, err
+		}
+		var params encryptionParams
+		if err := json.Unmarshal(content, &params); err != nil {
+			return encryption.Key{}, fmt.Errorf("invalid %s, %v", backend.GetUrl(ENCRYPTION_PARAMS_KEY), err)
+		}
+		if params.KDF != "scrypt" {
+			return encryption.Key{}, fmt.Errorf("unsupported key derivation %q in %s", params.KDF, backend.GetUrl(ENCRYPTION_PARAMS_KEY))
+		}
+		key, err := encryption.DeriveKey(passphrase, params.Salt, params.N, params.R, params.P)
+		if err != nil {
+			return encryption.Key{}, err
+		}
+		if key.Id() != params.KeyId {
+			return encryption.Key{}, errors.New("wrong passphrase for the workspace remote")
+		}
+		return key, nil
+	}
+
+	params := encryptionParams{KDF: "scrypt", Salt: make([]byte, 16), N: encryption.SCRYPT_N, R: encryption.SCRYPT_R, P: encryption.SCRYPT_P}
+	if _, err := rand.Read(params.Salt); err != nil {
+		return encryption.Key{}, err
+	}
+	key, err := encryption.DeriveKey(passphrase, params.Salt, params.N, params.R, params.P)
+	if err != nil {
+		return encryption.Key{}, err
+	}
+	params.KeyId = key.Id()
+	content, err := json.MarshalIndent(params, "", "  ")
+	if err != nil {
+		return encryption.Key{}, err
+	}
+	if err := backend.WriteObject(ENCRYPTION_PARAMS_KEY, content); err != nil {
+		return encryption.Key{}, err
+	}
+	return key, nil
+}
+
+func (b EncryptedWorkspaceBackend) GetUrl(key string) string {
+	return b.Backend.GetUrl(key)
+}
+
+func (b EncryptedWorkspaceBackend) List(prefix string) ([]types.ObjectInfo, error) {
+	return b.Backend.List(prefix)
+}
+
+func (b EncryptedWorkspaceBackend) Stat(key string) (types.ObjectInfo, error) {
+	return b.Backend.Stat(key)
+}
+
+// Upload encrypts the file before uploading it. Backends that store metadata keep the hash of
+// the file with the object.
+func (b EncryptedWorkspaceBackend) Upload(filename string, key string) (types.ObjectInfo, error) {
+	tmp, err := createTempFile("")
+	if err != nil {
+		return types.ObjectInfo{}, err
+	}
+	defer os.Remove(tmp)
+	if err := b.Key.EncryptFile(filename, tmp); err != nil {
+		return types.ObjectInfo{}, fmt.Errorf("failed to encrypt %s, %v", filename, err)
+	}
+	metadataBackend, ok := b.Backend.(types.IWorkspaceMetadataBackend)
+	if !ok {
+		return b.Backend.Upload(tmp, key)
+	}
+	hash, err := getFileHash(filename)
+	if err != nil {
+		return types.ObjectInfo{}, err
+	}
+	return metadataBackend.UploadWithMetadata(tmp, key, map[string]string{PLAINTEXT_HASH_METADATA: hash})
+}
+
+// Download downloads an object next to the file and decrypts it into place, so a file is never
+// left encrypted or half written. The file gets the modification time of the object.
+func (b EncryptedWorkspaceBackend) Download(key string, filename string) error {
+	if err := os.MkdirAll(filepath.Dir(filename), os.ModePerm); err != nil {
+		return err
+	}
+	tmp, err := createTempFile(filepath.Dir(filename))
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp)
+	if err := b.Backend.Download(key, tmp); err != nil {
+		return err
+	}
+	return b.decryptInto(tmp, filename)
+}
+
+// decryptInto decrypts a file into place, or renames it into place if it isn't encrypted. The
+// file keeps the permissions of the file it replaces, temporary files being private.
+func (b EncryptedWorkspaceBackend) decryptInto(src string, dst string) error {
+	mode := os.FileMode(0644)
+	if stat, err := os.Stat(dst); err == nil {
+		mode = stat.Mode().Perm()
+	}
+	encrypted, err := encryption.IsEncryptedFile(src)
+	if err != nil {
+		return err
+	}
+	if !encrypted {
+		if err := os.Chmod(src, mode); err != nil {
+			return err
+		}
+		return os.Rename(src, dst)
+	}
+	stat, err := os.Stat(src)
+	if err != nil {
+		return err
+	}
+	plain, err := createTempFile(filepath.Dir(dst))
+	if err != nil {
+		return err
+	}
+	err = b.Key.DecryptFile(src, plain)
+	if err == nil {
+		err = os.Chmod(plain, mode)
+	}
+	if err == nil {
+		err = os.Chtimes(plain, stat.ModTime(), stat.ModTime())
+	}
+	if err == nil {
+		err = os.Rename(plain, dst)
+	}
+	if err != nil {
+		os.Remove(plain)
+		return fmt.Errorf("failed to decrypt %s, %v", dst, err)
+	}
+	return nil
+}
+
+func (b EncryptedWorkspaceBackend) Delete(key string) error {
+	return b.Backend.Delete(key)
+}
+
+func (b EncryptedWorkspaceBackend) Copy(srcKey string, versionId string, dstKey string) (types.ObjectInfo, error) {
+	return b.Backend.Copy(srcKey, versionId, dstKey)
+}
+
+func (b EncryptedWorkspaceBackend) ReadObject(key string) ([]byte, error) {
+	content, err := b.Backend.ReadObject(key)
+	if err != nil || !encryption.HasHeader(content) {
+		return content, err
+	}
+	content, err = b.Key.DecryptBytes(content)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt %s, %v", b.GetUrl(key), err)
+	}
+	return content, nil
+}
+
+func (b EncryptedWorkspaceBackend) WriteObject(key string, content []byte) error {
+	encrypted, err := b.Key.EncryptBytes(content)
+	if err != nil {
+		return err
+	}
+	return b.Backend.WriteObject(key, encrypted)
+}
+
+func (b EncryptedWorkspaceBackend) IsVersioned() (bool, error) {
+	return b.Backend.IsVersioned()
+}
+
+func (b EncryptedWorkspaceBackend) ListCurrentVersions(prefix string) ([]types.ObjectInfo, error) {
+	return b.Backend.ListCurrentVersions(prefix)
+}
+
+// SameContent compares the local file with the hash it was encrypted from, kept in the metadata of
+// the object, as its ETag is of the encrypted content. Objects uploaded without the hash are
+// downloaded and decrypted to compare them, and objects of the file's size, which aren't
+// encrypted, are compared by the backend. Objects whose size matches neither the file's nor its
+// encrypted size differ.
+func (b EncryptedWorkspaceBackend) SameContent(filename string, object types.ObjectInfo) (bool, error) {
+	stat, err := os.Stat(filename)
+	if err != nil {
+		return false, err
+	}
+	if object.Size == stat.Size() {
+		return b.Backend.SameContent(filename, object)
+	}
+	if object.Size != encryption.EncryptedSize(stat.Size()) {
+		return false, nil
+	}
+	if _, ok := b.Backend.(types.IWorkspaceMetadataBackend); ok {
+		info, err := b.Backend.Stat(object.Key)
+		if err != nil {
+			return false, err
+		}
+		if expected := getMetadata(info.Metadata, PLAINTEXT_HASH_METADATA); expected != "" {
+			hash, err := getFileHash(filename)
+			return hash == expected, err
+		}
+	}
+	tmp, err := createTempFile("")
+	if err != nil {
+		return false, err
+	}
+	defer os.Remove(tmp)
+	if err := b.Download(object.Key, tmp); err != nil {
+		return false, err
+	}
+	return sameFileContent(filename, tmp)
+}
+
+// getFileHash returns the hex SHA-256 of a file
+func getFileHash(filename string) (string, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	hash := sha256.New()
+	if _, err := io.Copy(hash, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// getMetadata looks a name up in object metadata, which some stores return capitalized
+func getMetadata(metadata map[string]string, name string) string {
+	for key, value := range metadata {
+		if strings.EqualFold(key, name) {
+			return value
+		}
+	}
+	return ""
+}
+
+// createTempFile creates an empty temporary file in dir, or the default temporary directory
+// if dir is empty. Its name is left out of syncs.
+func createTempFile(dir string) (string, error) {
+	f, err := os.CreateTemp(dir, tmpFilePrefix)
+	if err != nil {
+		return "", err
+	}
+	return f.Name(), f.Close()
+}
+
+// Fetch downloads a single file of the remote workspace, decrypting it if needed
+func (s RemoteWorkspaceService) Fetch(studyName string, path string, filename string) error {
+	return s.Backend.Download(studyName+"/"+path, filename)
+}
+
+// Decrypt decrypts a file that was downloaded from the workspace remote by other means, e.g. a
+// hyperpack fetched with the AWS CLI
+func (s RemoteWorkspaceService) Decrypt(src string, dst string) {
+	encrypted, ok := s.Backend.(EncryptedWorkspaceBackend)
+	if !ok {
+		fmt.Println("The workspace remote has no encryption configured")
+		os.Exit(1)
+	}
+	if dst == "" {
+		dst = src
+	}
+	tmp, err := createTempFile(filepath.Dir(dst))
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+	defer os.Remove(tmp)
+	if err := encrypted.Key.DecryptFile(src, tmp); err != nil {
+		fmt.Printf("Could not decrypt %s: %v\n", src, err)
+		os.Exit(1)
+	}
+	if err := os.Rename(tmp, dst); err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+	fmt.Printf("Decrypted %s to %s\n", src, dst)
+}
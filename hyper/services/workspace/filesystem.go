@@ -0,0 +1,312 @@
+package workspace
+
+import (
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/gohypergiant/hyperdrive/hyper/client/transfer"
+	"github.com/gohypergiant/hyperdrive/hyper/types"
+)
+
+// tmpFilePrefix marks the files a transfer is still writing, whichever backend it goes through
+const tmpFilePrefix string = transfer.TMP_FILE_PREFIX
+
+// FilesystemWorkspaceBackend keeps workspaces in a directory, typically a mounted NFS export or
+// shared drive. Files are copied with their modification times, and an object's ETag is made
+// from its key, size and modification time.
+type FilesystemWorkspaceBackend struct {
+	Root string
+}
+
+// NewFilesystemWorkspaceBackend checks that the root directory exists. It is never created, so
+// an unmounted share is not mistaken for an empty one.
+func NewFilesystemWorkspaceBackend(root string) (FilesystemWorkspaceBackend, error) {
+	if root == "" {
+		return FilesystemWorkspaceBackend{}, errors.New("the filesystem workspace remote has no path")
+	}
+	absRoot, err := filepath.Abs(root)
+	if err != nil {
+		return FilesystemWorkspaceBackend{}, err
+	}
+	stat, err := os.Stat(absRoot)
+	if err != nil {
+		return FilesystemWorkspaceBackend{}, fmt.Errorf("cannot access the workspace remote at %s, %v", absRoot, err)
+	}
+	if !stat.IsDir() {
+		return FilesystemWorkspaceBackend{}, fmt.Errorf("the workspace remote at %s is not a directory", absRoot)
+	}
+	return FilesystemWorkspaceBackend{Root: absRoot}, nil
+}
+
+func (b FilesystemWorkspaceBackend) GetUrl(key string) string {
+	return filepath.Join(b.Root, filepath.FromSlash(key))
+}
+
+// getPath returns the path of an object, refusing keys that would point outside of the root
+func (b FilesystemWorkspaceBackend) getPath(key string) (string, error) {
+	cleaned := path.Clean("/" + key)
+	if cleaned == "/" || cleaned != "/"+strings.TrimSuffix(key, "/") {
+		return "", fmt.Errorf("invalid key %q", key)
+	}
+	return filepath.Join(b.Root, filepath.FromSlash(cleaned)), nil
+}
+
+func (b FilesystemWorkspaceBackend) List(prefix string) ([]types.ObjectInfo, error) {
+	objects := []types.ObjectInfo{}
+	dir := b.Root
+	if i := strings.LastIndex(prefix, "/"); i > 0 {
+		var err error
+		if dir, err = b.getPath(prefix[:i]); err != nil {
+			return objects, err
+		}
+	}
+	err := filepath.WalkDir(dir, func(p string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			if errors.Is(err, fs.ErrNotExist) && p == dir {
+				return filepath.SkipDir
+			}
+			return err
+		}
+		if !entry.Type().IsRegular() || strings.HasPrefix(entry.Name(), tmpFilePrefix) {
+			return nil
+		}
+		rel, err := filepath.Rel(b.Root, p)
+		if err != nil {
+			return err
+		}
+		key := filepath.ToSlash(rel)
+		if !strings.HasPrefix(key, prefix) {
+			return nil
+		}
+		info, err := entry.Info()
+		if err != nil {
+			return err
+		}
+		objects = append(objects, getFileObjectInfo(key, info))
+		return nil
+	})
+	if err != nil {
+		return objects, fmt.Errorf("failed to list %s, %v", b.GetUrl(prefix), err)
+	}
+	return objects, nil
+}
+
+func (b FilesystemWorkspaceBackend) Stat(key string) (types.ObjectInfo, error) {
+	p, err := b.getPath(key)
+	if err != nil {
+		return types.ObjectInfo{}, err
+	}
+	info, err := os.Stat(p)
+	if os.IsNotExist(err) {
+		return types.ObjectInfo{Key: key}, nil
+	}
+	if err != nil {
+		return types.ObjectInfo{}, fmt.Errorf("cannot access %s, %v", p, err)
+	}
+	return getFileObjectInfo(key, info), nil
+}
+
+func getFileObjectInfo(key string, info fs.FileInfo) types.ObjectInfo {
+	return types.ObjectInfo{
+		Key:          key,
+		Exists:       true,
+		Size:         info.Size(),
+		LastModified: info.ModTime(),
+		ETag:         getFileETag(key, info),
+	}
+}
+
+// getFileETag identifies a version of a file from its key, size and modification time. The key
+// is part of it because files written at the same time can have the same modification time.
+func getFileETag(key string, info fs.FileInfo) string {
+	hash := fnv.New64a()
+	fmt.Fprintf(hash, "%s\x00%d\x00%d", key, info.Size(), info.ModTime().UnixNano())
+	return hex.EncodeToString(hash.Sum(nil))
+}
+
+func (b FilesystemWorkspaceBackend) Upload(filename string, key string) (types.ObjectInfo, error) {
+	p, err := b.getPath(key)
+	if err != nil {
+		return types.ObjectInfo{}, err
+	}
+	if err := copyFileAtomic(filename, p); err != nil {
+		return types.ObjectInfo{}, fmt.Errorf("failed to upload %s, %v", filename, err)
+	}
+	return b.Stat(key)
+}
+
+func (b FilesystemWorkspaceBackend) Download(key string, filename string) error {
+	p, err := b.getPath(key)
+	if err != nil {
+		return err
+	}
+	if err := copyFileAtomic(p, filename); err != nil {
+		return fmt.Errorf("failed to download %s, %v", p, err)
+	}
+	return nil
+}
+
+// Delete removes an object, along with the directories it leaves empty
+func (b FilesystemWorkspaceBackend) Delete(key string) error {
+	p, err := b.getPath(key)
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(p); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to delete %s, %v", p, err)
+	}
+	for dir := filepath.Dir(p); dir != b.Root && strings.HasPrefix(dir, b.Root); dir = filepath.Dir(dir) {
+		if os.Remove(dir) != nil {
+			break
+		}
+	}
+	return nil
+}
+
+func (b FilesystemWorkspaceBackend) Copy(srcKey string, versionId string, dstKey string) (types.ObjectInfo, error) {
+	if versionId != "" {
+		return types.ObjectInfo{}, errors.New("filesystem workspace remotes don't keep object versions")
+	}
+	src, err := b.getPath(srcKey)
+	if err != nil {
+		return types.ObjectInfo{}, err
+	}
+	dst, err := b.getPath(dstKey)
+	if err != nil {
+		return types.ObjectInfo{}, err
+	}
+	if err := copyFileAtomic(src, dst); err != nil {
+		return types.ObjectInfo{}, fmt.Errorf("failed to copy %s to %s, %v", src, dst, err)
+	}
+	return b.Stat(dstKey)
+}
+
+func (b FilesystemWorkspaceBackend) ReadObject(key string) ([]byte, error) {
+	p, err := b.getPath(key)
+	if err != nil {
+		return nil, err
+	}
+	return os.ReadFile(p)
+}
+
+func (b FilesystemWorkspaceBackend) WriteObject(key string, content []byte) error {
+	p, err := b.getPath(key)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(p), os.ModePerm); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(p), tmpFilePrefix)
+	if err != nil {
+		return err
+	}
+	_, err = tmp.Write(content)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), p)
+}
+
+func (b FilesystemWorkspaceBackend) IsVersioned() (bool, error) {
+	return false, nil
+}
+
+func (b FilesystemWorkspaceBackend) ListCurrentVersions(prefix string) ([]types.ObjectInfo, error) {
+	return nil, errors.New("filesystem workspace remotes don't keep object versions")
+}
+
+// SameContent compares a local file with an object byte by byte
+func (b FilesystemWorkspaceBackend) SameContent(filename string, object types.ObjectInfo) (bool, error) {
+	p, err := b.getPath(object.Key)
+	if err != nil {
+		return false, err
+	}
+	return sameFileContent(filename, p)
+}
+
+// sameFileContent compares two files byte by byte
+func sameFileContent(a string, b string) (bool, error) {
+	fileA, err := os.Open(a)
+	if err != nil {
+		return false, err
+	}
+	defer fileA.Close()
+	fileB, err := os.Open(b)
+	if err != nil {
+		return false, err
+	}
+	defer fileB.Close()
+
+	bufA, bufB := make([]byte, 64*1024), make([]byte, 64*1024)
+	for {
+		n, errA := io.ReadFull(fileA, bufA)
+		m, errB := io.ReadFull(fileB, bufB)
+		if n != m || !bytes.Equal(bufA[:n], bufB[:m]) {
+			return false, nil
+		}
+		doneA := errors.Is(errA, io.EOF) || errors.Is(errA, io.ErrUnexpectedEOF)
+		doneB := errors.Is(errB, io.EOF) || errors.Is(errB, io.ErrUnexpectedEOF)
+		if doneA || doneB {
+			return doneA && doneB, nil
+		}
+		if errA != nil {
+			return false, errA
+		}
+		if errB != nil {
+			return false, errB
+		}
+	}
+}
+
+// copyFileAtomic copies a file with its modification time, creating any missing parent
+// directories. The copy is written to a temporary file that is renamed into place.
+func copyFileAtomic(src string, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	stat, err := in.Stat()
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(dst), os.ModePerm); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(dst), tmpFilePrefix)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(tmp, transfer.Reader(in))
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Chmod(tmp.Name(), stat.Mode().Perm())
+	}
+	if err == nil {
+		err = os.Chtimes(tmp.Name(), time.Now(), stat.ModTime())
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), dst)
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+	}
+	return err
+}
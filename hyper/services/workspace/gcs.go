@@ -0,0 +1,71 @@
+package workspace
+
+import (
+	"fmt"
+
+	"github.com/gohypergiant/hyperdrive/hyper/client/gcp"
+	"github.com/gohypergiant/hyperdrive/hyper/types"
+)
+
+// GCSWorkspaceBackend keeps workspaces in a Google Cloud Storage bucket. An object's ETag is
+// the hex MD5 of its content, as for objects uploaded to S3 in a single part.
+type GCSWorkspaceBackend struct {
+	GCSConfiguration types.GCSWorkspacePersistenceRemoteConfiguration
+}
+
+func (b GCSWorkspaceBackend) GetUrl(key string) string {
+	return fmt.Sprintf("gs://%s/%s", b.GCSConfiguration.BucketName, key)
+}
+
+func (b GCSWorkspaceBackend) List(prefix string) ([]types.ObjectInfo, error) {
+	return gcp.ListObjects(b.GCSConfiguration, prefix)
+}
+
+func (b GCSWorkspaceBackend) Stat(key string) (types.ObjectInfo, error) {
+	return gcp.GetObjectInfo(b.GCSConfiguration, key)
+}
+
+func (b GCSWorkspaceBackend) Upload(filename string, key string) (types.ObjectInfo, error) {
+	return gcp.UploadFile(b.GCSConfiguration, filename, key, nil)
+}
+
+func (b GCSWorkspaceBackend) UploadWithMetadata(filename string, key string, metadata map[string]string) (types.ObjectInfo, error) {
+	return gcp.UploadFile(b.GCSConfiguration, filename, key, metadata)
+}
+
+func (b GCSWorkspaceBackend) Download(key string, filename string) error {
+	return gcp.DownloadFile(b.GCSConfiguration, key, filename)
+}
+
+func (b GCSWorkspaceBackend) Delete(key string) error {
+	return gcp.DeleteObject(b.GCSConfiguration, key)
+}
+
+func (b GCSWorkspaceBackend) Copy(srcKey string, versionId string, dstKey string) (types.ObjectInfo, error) {
+	return gcp.CopyObject(b.GCSConfiguration, srcKey, versionId, dstKey)
+}
+
+func (b GCSWorkspaceBackend) ReadObject(key string) ([]byte, error) {
+	return gcp.GetObjectContent(b.GCSConfiguration, key)
+}
+
+func (b GCSWorkspaceBackend) WriteObject(key string, content []byte) error {
+	return gcp.PutObjectContent(b.GCSConfiguration, key, content)
+}
+
+func (b GCSWorkspaceBackend) IsVersioned() (bool, error) {
+	return gcp.IsVersioningEnabled(b.GCSConfiguration)
+}
+
+func (b GCSWorkspaceBackend) ListCurrentVersions(prefix string) ([]types.ObjectInfo, error) {
+	return gcp.ListCurrentObjectVersions(b.GCSConfiguration, prefix)
+}
+
+// SameContent compares a local file with an object by its MD5
+func (b GCSWorkspaceBackend) SameContent(filename string, object types.ObjectInfo) (bool, error) {
+	if same, err := sameSize(filename, object); !same || err != nil {
+		return false, err
+	}
+	etag, err := computeETag(filename, "")
+	return etag == object.ETag, err
+}
@@ -0,0 +1,39 @@
+package workspace
+
+import (
+	"fmt"
+	"os"
+	"text/tabwriter"
+
+	"github.com/gohypergiant/hyperdrive/hyper/types"
+)
+
+// Init creates the storage of the workspace remote if it doesn't exist, and configures it with
+// the settings. Settings that are already as configured are left alone, so it can be run again.
+// The encryption of the remote isn't set up, as the salt of a passphrase is kept in the storage
+// being created.
+func Init(remoteName string, syncOptions types.WorkspaceSyncOptions, settings types.WorkspaceInitSettings) {
+	syncOptions = resolveSyncOptions(remoteName, syncOptions)
+	backend := newWorkspaceBackend(syncOptions)
+	provisioner, ok := backend.(types.IWorkspaceProvisioner)
+	if !ok {
+		fmt.Println("hyper workspace init is only supported by s3 workspace remotes")
+		os.Exit(1)
+	}
+	steps, err := provisioner.Provision(syncOptions.StudyName, settings)
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "SETTING\tSTATE\t")
+	for _, step := range steps {
+		change := ""
+		if step.Changed {
+			change = "(updated)"
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\n", step.Setting, step.State, change)
+	}
+	w.Flush()
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+	fmt.Printf("%s is ready\n", backend.GetUrl(""))
+}
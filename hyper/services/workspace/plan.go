@@ -0,0 +1,600 @@
+package workspace
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/docker/go-units"
+	"github.com/gohypergiant/hyperdrive/hyper/client/encryption"
+	"github.com/gohypergiant/hyperdrive/hyper/client/ignore"
+	"github.com/gohypergiant/hyperdrive/hyper/client/transfer"
+	"github.com/gohypergiant/hyperdrive/hyper/types"
+)
+
+type syncAction string
+
+const (
+	actionNone         syncAction = ""
+	actionUpload       syncAction = "upload"
+	actionDownload     syncAction = "download"
+	actionDeleteRemote syncAction = "delete remote"
+	actionDeleteLocal  syncAction = "delete local"
+	actionRecord       syncAction = "record"
+	actionForget       syncAction = "forget"
+	actionConflict     syncAction = "conflict"
+	actionKeepBoth     syncAction = "keep both"
+)
+
+type localFile struct {
+	Exists  bool
+	Size    int64
+	ModTime time.Time
+}
+
+// syncItem is one file of the workspace as it is locally, on the remote, and as it was when
+// it was last synced
+type syncItem struct {
+	Path   string
+	Local  localFile
+	Remote types.ObjectInfo
+	Base   *syncedFile
+	Action syncAction
+	Reason string
+}
+
+func (i syncItem) localChanged() bool {
+	if i.Base == nil {
+		return i.Local.Exists
+	}
+	return !i.Local.Exists || i.Local.Size != i.Base.Size || !i.Local.ModTime.Equal(i.Base.ModTime)
+}
+
+func (i syncItem) remoteChanged() bool {
+	if i.Base == nil {
+		return i.Remote.Exists
+	}
+	return !i.Remote.Exists || i.Remote.ETag != i.Base.ETag
+}
+
+// workspaceSyncer plans and applies syncs of a local workspace with its remote. Changes are
+// detected against the sync state: a file changed on one side only is copied over, a file
+// changed on both sides is a conflict resolved with the conflict policy.
+type workspaceSyncer struct {
+	service   RemoteWorkspaceService
+	localPath string
+	studyName string
+	policy    types.ConflictPolicy
+	dryRun    bool
+
+	mu       sync.Mutex
+	state    *syncState
+	stateMu  sync.Mutex
+	summary  transferSummary
+	ignoreMu sync.RWMutex
+	ignore   *ignore.Matcher
+}
+
+func newWorkspaceSyncer(s RemoteWorkspaceService, localPath string, studyName string, settings types.WorkspaceSyncSettings) *workspaceSyncer {
+	if settings.ConflictPolicy == "" {
+		settings.ConflictPolicy = types.ConflictKeepBoth
+	}
+	w := &workspaceSyncer{
+		service:   s,
+		localPath: localPath,
+		studyName: studyName,
+		policy:    settings.ConflictPolicy,
+		dryRun:    settings.DryRun,
+		state:     readSyncState(localPath, s.GetUrl(studyName)),
+	}
+	if err := w.reloadIgnore(); err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+	return w
+}
+
+// reloadIgnore reads the workspace's .hyperignore and .dockerignore
+func (w *workspaceSyncer) reloadIgnore() error {
+	matcher, err := ignore.Load(w.localPath)
+	if err != nil {
+		return fmt.Errorf("could not read the ignore files of %s, %v", w.localPath, err)
+	}
+	w.ignoreMu.Lock()
+	w.ignore = matcher
+	w.ignoreMu.Unlock()
+	return nil
+}
+
+// isIgnored reports whether a path is left out of the sync. Ignored files are neither pushed,
+// pulled nor deleted on either side.
+func (w *workspaceSyncer) isIgnored(rel string, isDir bool) bool {
+	w.ignoreMu.RLock()
+	defer w.ignoreMu.RUnlock()
+	return isSyncIgnored(rel) || w.ignore.Ignored(rel, isDir)
+}
+
+func (w *workspaceSyncer) getKey(rel string) string {
+	return w.studyName + "/" + rel
+}
+
+func (w *workspaceSyncer) getLocalPath(rel string) string {
+	return filepath.Join(w.localPath, filepath.FromSlash(rel))
+}
+
+func isSyncIgnored(rel string) bool {
+	if rel == SNAPSHOTS_DIR || strings.HasPrefix(rel, SNAPSHOTS_DIR+"/") {
+		return true
+	}
+	base := path.Base(rel)
+	if strings.HasPrefix(base, tmpFilePrefix) {
+		return true
+	}
+	return base == LOCKFILE_NAME || base == SYNC_STATE_FILE_NAME || base == SYNC_STATE_FILE_NAME+".tmp" ||
+		base == types.SYNC_STATS_FILE_NAME || base == types.SYNC_STATS_FILE_NAME+".tmp"
+}
+
+// planAll plans the sync of every file that exists locally, on the remote or in the sync state.
+// Files for which skip returns true are left out.
+func (w *workspaceSyncer) planAll(skip func(rel string) bool) ([]syncItem, error) {
+	items := map[string]*syncItem{}
+	get := func(rel string) *syncItem {
+		if _, ok := items[rel]; !ok {
+			items[rel] = &syncItem{Path: rel, Remote: types.ObjectInfo{Key: w.getKey(rel)}}
+		}
+		return items[rel]
+	}
+
+	err := filepath.WalkDir(w.localPath, func(p string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(w.localPath, p)
+		if err != nil {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+		if entry.IsDir() && rel != "." && w.isIgnored(rel, true) {
+			return filepath.SkipDir
+		}
+		if !entry.Type().IsRegular() || w.isIgnored(rel, false) {
+			return nil
+		}
+		info, err := entry.Info()
+		if err != nil {
+			return err
+		}
+		get(rel).Local = localFile{Exists: true, Size: info.Size(), ModTime: info.ModTime()}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	prefix := w.studyName + "/"
+	objects, err := w.service.Backend.List(prefix)
+	if err != nil {
+		return nil, err
+	}
+	for _, object := range objects {
+		rel := strings.TrimPrefix(object.Key, prefix)
+		if rel == "" || strings.HasSuffix(rel, "/") || w.isIgnored(rel, false) {
+			continue
+		}
+		get(rel).Remote = object
+	}
+
+	for rel := range w.state.Files {
+		if !w.isIgnored(rel, false) {
+			get(rel)
+		}
+	}
+
+	planned := []syncItem{}
+	for rel, item := range items {
+		if skip != nil && skip(rel) {
+			continue
+		}
+		if base, ok := w.state.Files[rel]; ok {
+			item.Base = &base
+		}
+		w.planItem(item)
+		planned = append(planned, *item)
+	}
+	sort.Slice(planned, func(i, j int) bool {
+		return planned[i].Path < planned[j].Path
+	})
+	return planned, nil
+}
+
+// planPaths plans the sync of the given files only, looking each of them up on the remote
+func (w *workspaceSyncer) planPaths(rels []string) ([]syncItem, error) {
+	planned := []syncItem{}
+	for _, rel := range rels {
+		if w.isIgnored(rel, false) {
+			continue
+		}
+		item := syncItem{Path: rel}
+		if stat, err := os.Stat(w.getLocalPath(rel)); err == nil {
+			if !stat.Mode().IsRegular() {
+				continue
+			}
+			item.Local = localFile{Exists: true, Size: stat.Size(), ModTime: stat.ModTime()}
+		}
+		remote, err := w.service.Backend.Stat(w.getKey(rel))
+		if err != nil {
+			return planned, err
+		}
+		item.Remote = remote
+		if base, ok := w.state.Files[rel]; ok {
+			item.Base = &base
+		}
+		w.planItem(&item)
+		planned = append(planned, item)
+	}
+	return planned, nil
+}
+
+// planItem decides what a sync does with a file by comparing both sides with the sync state
+func (w *workspaceSyncer) planItem(item *syncItem) {
+	localChanged, remoteChanged := item.localChanged(), item.remoteChanged()
+	switch {
+	case !localChanged && !remoteChanged:
+		item.Action = actionNone
+	case localChanged && !remoteChanged:
+		if item.Local.Exists {
+			item.Action = actionUpload
+		} else {
+			item.Action = actionDeleteRemote
+		}
+	case !localChanged && remoteChanged:
+		if item.Remote.Exists {
+			item.Action = actionDownload
+		} else {
+			item.Action = actionDeleteLocal
+		}
+	case !item.Local.Exists && !item.Remote.Exists:
+		item.Action = actionForget
+	case item.Local.Exists && item.Remote.Exists && w.matchesRemote(item):
+		// both sides made the same change, e.g. the first sync of an already copied workspace
+		item.Action = actionRecord
+	default:
+		item.Action = actionConflict
+		switch {
+		case !item.Local.Exists:
+			item.Reason = "deleted locally, modified on the remote"
+		case !item.Remote.Exists:
+			item.Reason = "modified locally, deleted on the remote"
+		case item.Base == nil:
+			item.Reason = "created on both sides"
+		default:
+			item.Reason = "modified on both sides"
+		}
+	}
+}
+
+// matchesRemote reports whether the local file has the same content as the remote object
+func (w *workspaceSyncer) matchesRemote(item *syncItem) bool {
+	same, err := w.service.Backend.SameContent(w.getLocalPath(item.Path), item.Remote)
+	return err == nil && same
+}
+
+// resolveConflicts turns conflicts into actions according to the conflict policy. With the
+// abort policy any conflict is returned as an error, before anything is changed.
+func (w *workspaceSyncer) resolveConflicts(items []syncItem) ([]syncItem, error) {
+	conflicts := []string{}
+	for i, item := range items {
+		if item.Action != actionConflict {
+			continue
+		}
+		switch w.policy {
+		case types.ConflictPreferLocal:
+			items[i].Action = actionUpload
+			if !item.Local.Exists {
+				items[i].Action = actionDeleteRemote
+			}
+		case types.ConflictPreferRemote:
+			items[i].Action = actionDownload
+			if !item.Remote.Exists {
+				items[i].Action = actionDeleteLocal
+			}
+		case types.ConflictKeepBoth:
+			// a deletion never wins over a modification, so nothing is lost
+			switch {
+			case !item.Local.Exists:
+				items[i].Action = actionDownload
+			case !item.Remote.Exists:
+				items[i].Action = actionUpload
+			default:
+				items[i].Action = actionKeepBoth
+			}
+		default:
+			conflicts = append(conflicts, fmt.Sprintf("  %s (%s)", item.Path, item.Reason))
+		}
+	}
+	if len(conflicts) > 0 {
+		return items, fmt.Errorf("sync aborted, %d conflicting files:\n%s", len(conflicts), strings.Join(conflicts, "\n"))
+	}
+	return items, nil
+}
+
+// transferSummary counts what syncs did, to be reported once they are done
+type transferSummary struct {
+	Transferred int
+	Bytes       int64
+	Skipped     int
+	Failed      int
+}
+
+func (t transferSummary) String() string {
+	return fmt.Sprintf("%d files transferred (%s), %d skipped, %d failed", t.Transferred, units.HumanSize(float64(t.Bytes)), t.Skipped, t.Failed)
+}
+
+// getSummary returns what the syncs of the syncer did so far, once the sync in progress is done
+func (w *workspaceSyncer) getSummary() transferSummary {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.summary
+}
+
+// printSummary prints what the syncs of the syncer did, unless they were dry runs
+func (w *workspaceSyncer) printSummary() {
+	if !w.dryRun {
+		fmt.Println(w.summary)
+	}
+}
+
+// apply carries out the planned actions, recording every synced file in the sync state. Up to
+// the number of parallel transfers are carried out at once, and failed ones are retried. In a
+// dry run the actions that transfer or delete files are only listed.
+func (w *workspaceSyncer) apply(items []syncItem) error {
+	if w.dryRun {
+		printDryRun(items)
+		return nil
+	}
+	var summary transferSummary
+	jobs := make(chan syncItem)
+	var wg sync.WaitGroup
+	for i := 0; i < transfer.GetSettings().Parallel; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for item := range jobs {
+				transferred, err := w.applyItem(item)
+				w.stateMu.Lock()
+				switch {
+				case err != nil:
+					summary.Failed++
+					fmt.Printf("Could not sync %s: %v\n", item.Path, err)
+				case item.Action == actionUpload || item.Action == actionDownload || item.Action == actionKeepBoth:
+					summary.Transferred++
+					summary.Bytes += transferred
+				case item.Action == actionNone || item.Action == actionRecord:
+					summary.Skipped++
+				}
+				w.stateMu.Unlock()
+			}
+		}()
+	}
+	for _, item := range items {
+		jobs <- item
+	}
+	close(jobs)
+	wg.Wait()
+
+	w.summary.Transferred += summary.Transferred
+	w.summary.Bytes += summary.Bytes
+	w.summary.Skipped += summary.Skipped
+	w.summary.Failed += summary.Failed
+	if err := w.state.write(w.localPath); err != nil {
+		return err
+	}
+	if summary.Failed > 0 {
+		return fmt.Errorf("%d files could not be synced", summary.Failed)
+	}
+	return nil
+}
+
+// applyItem carries out the action planned for a file, returning how many bytes it transferred.
+// Transfers and deletions on the remote are retried.
+func (w *workspaceSyncer) applyItem(item syncItem) (int64, error) {
+	localPath := w.getLocalPath(item.Path)
+	key := w.getKey(item.Path)
+	switch item.Action {
+	case actionUpload:
+		if err := w.upload(item.Path); err != nil {
+			return 0, err
+		}
+		fmt.Printf("Pushed %s\n", item.Path)
+		return item.Local.Size, nil
+	case actionDownload:
+		if err := w.download(item.Path); err != nil {
+			return 0, err
+		}
+		fmt.Printf("Pulled %s\n", item.Path)
+		return item.Remote.Size, nil
+	case actionDeleteRemote:
+		err := transfer.Retry("the deletion of "+item.Path, func() error {
+			return w.service.Backend.Delete(key)
+		})
+		if err != nil {
+			return 0, err
+		}
+		w.forget(item.Path)
+		fmt.Printf("Deleted %s from remote\n", item.Path)
+	case actionDeleteLocal:
+		if err := os.Remove(localPath); err != nil && !os.IsNotExist(err) {
+			return 0, err
+		}
+		w.forget(item.Path)
+		fmt.Printf("Deleted %s locally\n", item.Path)
+	case actionRecord:
+		w.record(item.Path, item.Local, item.Remote)
+	case actionForget:
+		w.forget(item.Path)
+	case actionKeepBoth:
+		if err := w.keepBoth(item.Path); err != nil {
+			return 0, err
+		}
+		return item.Local.Size + item.Remote.Size, nil
+	}
+	return 0, nil
+}
+
+func (w *workspaceSyncer) upload(rel string) error {
+	localPath := w.getLocalPath(rel)
+	stat, err := os.Stat(localPath)
+	if err != nil {
+		return err
+	}
+	var remote types.ObjectInfo
+	err = transfer.Retry("the upload of "+rel, func() error {
+		remote, err = w.service.Backend.Upload(localPath, w.getKey(rel))
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	w.record(rel, localFile{Exists: true, Size: stat.Size(), ModTime: stat.ModTime()}, remote)
+	return nil
+}
+
+func (w *workspaceSyncer) download(rel string) error {
+	localPath := w.getLocalPath(rel)
+	key := w.getKey(rel)
+	var remote types.ObjectInfo
+	err := transfer.Retry("the download of "+rel, func() error {
+		var err error
+		remote, err = w.service.Backend.Stat(key)
+		if err != nil {
+			return err
+		}
+		return w.service.Backend.Download(key, localPath)
+	})
+	if err != nil {
+		return err
+	}
+	if _, ok := w.service.Backend.(EncryptedWorkspaceBackend); !ok {
+		if encrypted, _ := encryption.IsEncryptedFile(localPath); encrypted {
+			fmt.Printf("Warning: %s is encrypted, set the encryption key or passphrase of the workspace remote to decrypt it\n", rel)
+		}
+	}
+	stat, err := os.Stat(localPath)
+	if err != nil {
+		return err
+	}
+	w.record(rel, localFile{Exists: true, Size: stat.Size(), ModTime: stat.ModTime()}, remote)
+	return nil
+}
+
+// keepBoth moves the local version of a conflicting file aside under a conflict name, pulls the
+// remote version in its place and pushes the local version under its new name
+func (w *workspaceSyncer) keepBoth(rel string) error {
+	conflictRel := getConflictName(rel)
+	if err := os.Rename(w.getLocalPath(rel), w.getLocalPath(conflictRel)); err != nil {
+		return err
+	}
+	if err := w.download(rel); err != nil {
+		return err
+	}
+	if err := w.upload(conflictRel); err != nil {
+		return err
+	}
+	fmt.Printf("Conflict on %s, kept the local version as %s\n", rel, conflictRel)
+	return nil
+}
+
+func (w *workspaceSyncer) record(rel string, local localFile, remote types.ObjectInfo) {
+	w.stateMu.Lock()
+	defer w.stateMu.Unlock()
+	w.state.Files[rel] = syncedFile{Size: local.Size, ModTime: local.ModTime, ETag: remote.ETag}
+}
+
+func (w *workspaceSyncer) forget(rel string) {
+	w.stateMu.Lock()
+	defer w.stateMu.Unlock()
+	delete(w.state.Files, rel)
+}
+
+// getConflictName returns the name a conflicting local file is kept under, e.g.
+// analysis.conflict-laptop-20221004-101500.ipynb
+func getConflictName(rel string) string {
+	host, err := os.Hostname()
+	if err != nil || host == "" {
+		host = "local"
+	}
+	ext := path.Ext(rel)
+	return fmt.Sprintf("%s.conflict-%s-%s%s", strings.TrimSuffix(rel, ext), host, time.Now().Format("20060102-150405"), ext)
+}
+
+// syncAll syncs the whole workspace, leaving out the files for which skip returns true
+func (w *workspaceSyncer) syncAll(skip func(rel string) bool) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	items, err := w.planAll(skip)
+	if err != nil {
+		return err
+	}
+	items, err = w.resolveConflicts(items)
+	if err != nil {
+		return err
+	}
+	return w.apply(items)
+}
+
+// syncPaths syncs the given files only
+func (w *workspaceSyncer) syncPaths(rels []string) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	items, err := w.planPaths(rels)
+	if err != nil {
+		return err
+	}
+	items, err = w.resolveConflicts(items)
+	if err != nil {
+		return err
+	}
+	return w.apply(items)
+}
+
+// syncedPathsUnder returns the files below a directory that were synced before
+func (w *workspaceSyncer) syncedPathsUnder(dir string) []string {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	rels := []string{}
+	for rel := range w.state.Files {
+		if strings.HasPrefix(rel, dir+"/") {
+			rels = append(rels, rel)
+		}
+	}
+	return rels
+}
+
+// pullAll brings the workspace up to date with the remote: remote changes are pulled, and local
+// changes are overwritten with the remote version. Local files that were never synced are kept.
+func (w *workspaceSyncer) pullAll() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	items, err := w.planAll(nil)
+	if err != nil {
+		return err
+	}
+	for i, item := range items {
+		switch {
+		case item.Action == actionNone || item.Action == actionForget || item.Action == actionRecord:
+		case item.Remote.Exists:
+			items[i].Action = actionDownload
+		case item.Base != nil:
+			items[i].Action = actionDeleteLocal
+		default:
+			items[i].Action = actionNone
+		}
+	}
+	return w.apply(items)
+}
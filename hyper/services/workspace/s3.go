@@ -1,105 +1,251 @@
 package workspace
 
 import (
+	"crypto/md5"
+	"encoding/hex"
+	"errors"
 	"fmt"
+	"io"
 	"os"
-	"time"
+	"strconv"
+	"strings"
 
 	"github.com/gohypergiant/hyperdrive/hyper/client/aws"
-	"github.com/gohypergiant/hyperdrive/hyper/services/notebook"
+	"github.com/gohypergiant/hyperdrive/hyper/client/transfer"
 	"github.com/gohypergiant/hyperdrive/hyper/types"
-	"github.com/rogpeppe/go-internal/lockedfile"
 )
 
-const LOCKFILE_NAME string = "hyperdrive-workspace.lock"
-
-type S3WorkspaceService struct {
-	ManifestPath    string
+// S3WorkspaceBackend keeps workspaces in an S3 bucket, or a bucket of an S3-compatible store
+type S3WorkspaceBackend struct {
 	S3Configuration types.S3WorkspacePersistenceRemoteConfiguration
 }
 
-func (s S3WorkspaceService) Pull(localPath string, studyName string) {
+func (b S3WorkspaceBackend) GetUrl(key string) string {
+	return fmt.Sprintf("s3://%s/%s", b.S3Configuration.BucketName, key)
+}
 
-	studyName, localPath, err := s.determinePathAndName(localPath, studyName)
-	if err != nil {
-		fmt.Println(err)
-		return
+func (b S3WorkspaceBackend) List(prefix string) ([]types.ObjectInfo, error) {
+	return aws.ListObjects(b.S3Configuration, prefix)
+}
+
+func (b S3WorkspaceBackend) Stat(key string) (types.ObjectInfo, error) {
+	return aws.GetObjectInfo(b.S3Configuration, key)
+}
+
+func (b S3WorkspaceBackend) Upload(filename string, key string) (types.ObjectInfo, error) {
+	return aws.UploadFile(b.S3Configuration, filename, key, nil)
+}
+
+func (b S3WorkspaceBackend) UploadWithMetadata(filename string, key string, metadata map[string]string) (types.ObjectInfo, error) {
+	return aws.UploadFile(b.S3Configuration, filename, key, metadata)
+}
+
+func (b S3WorkspaceBackend) Download(key string, filename string) error {
+	return aws.DownloadFile(b.S3Configuration, key, filename)
+}
+
+func (b S3WorkspaceBackend) Delete(key string) error {
+	return aws.DeleteObject(b.S3Configuration, key)
+}
+
+func (b S3WorkspaceBackend) Copy(srcKey string, versionId string, dstKey string) (types.ObjectInfo, error) {
+	return aws.CopyObject(b.S3Configuration, srcKey, versionId, dstKey)
+}
+
+func (b S3WorkspaceBackend) ReadObject(key string) ([]byte, error) {
+	return aws.GetObjectContent(b.S3Configuration, key)
+}
+
+func (b S3WorkspaceBackend) WriteObject(key string, content []byte) error {
+	return aws.PutObjectContent(b.S3Configuration, key, content)
+}
+
+func (b S3WorkspaceBackend) IsVersioned() (bool, error) {
+	return aws.IsVersioningEnabled(b.S3Configuration)
+}
+
+func (b S3WorkspaceBackend) ListCurrentVersions(prefix string) ([]types.ObjectInfo, error) {
+	return aws.ListCurrentObjectVersions(b.S3Configuration, prefix)
+}
+
+// SameContent compares a local file with an object by computing the object's ETag for the file
+func (b S3WorkspaceBackend) SameContent(filename string, object types.ObjectInfo) (bool, error) {
+	if same, err := sameSize(filename, object); !same || err != nil {
+		return false, err
 	}
-	s.pull(localPath, studyName)
+	etag, err := computeETag(filename, object.ETag)
+	return etag == object.ETag, err
 }
 
-func (s S3WorkspaceService) determinePathAndName(localPath string, studyName string) (string, string, error) {
-	if studyName == "" {
-		studyName = notebook.GetNotebookName(s.ManifestPath)
+func (b S3WorkspaceBackend) ReceiveObjectEvents(queueUrl string, waitSeconds int64) ([]types.ObjectEvent, error) {
+	return aws.ReceiveObjectEvents(b.S3Configuration, queueUrl, waitSeconds)
+}
+
+// Provision creates the workspace bucket if it doesn't exist, blocks public access to it, turns
+// on default encryption and, if requested, versioning, and adds the lifecycle rules. Settings an
+// S3-compatible store doesn't implement are reported and skipped.
+func (b S3WorkspaceBackend) Provision(studyName string, settings types.WorkspaceInitSettings) ([]types.WorkspaceInitStep, error) {
+	s3Config := b.S3Configuration
+	provisions := []func() (types.WorkspaceInitStep, error){
+		func() (types.WorkspaceInitStep, error) {
+			return provision("bucket", func() (string, bool, error) {
+				exists, err := aws.BucketExists(s3Config)
+				return "exists", exists, err
+			}, func() (string, error) {
+				return "created", aws.CreateBucket(s3Config)
+			})
+		},
+		func() (types.WorkspaceInitStep, error) {
+			return provision("public access", func() (string, bool, error) {
+				blocked, err := aws.IsPublicAccessBlocked(s3Config)
+				return "blocked", blocked, err
+			}, func() (string, error) {
+				return "blocked", aws.BlockPublicAccess(s3Config)
+			})
+		},
+		func() (types.WorkspaceInitStep, error) {
+			return provision("default encryption", func() (string, bool, error) {
+				algorithm, err := aws.GetDefaultEncryption(s3Config)
+				return algorithm, algorithm != "", err
+			}, func() (string, error) {
+				return aws.EnableDefaultEncryption(s3Config)
+			})
+		},
+		func() (types.WorkspaceInitStep, error) {
+			return provision("versioning", func() (string, bool, error) {
+				enabled, err := aws.IsVersioningEnabled(s3Config)
+				if !enabled {
+					return "disabled", !settings.Versioning, err
+				}
+				return "enabled", true, err
+			}, func() (string, error) {
+				return "enabled", aws.EnableVersioning(s3Config)
+			})
+		},
+	}
+	if rules, description := getLifecycleRules(studyName, settings); len(rules) > 0 {
+		// the rules are compared with the existing ones as they are updated
+		provisions = append(provisions, func() (types.WorkspaceInitStep, error) {
+			return provision("lifecycle", func() (string, bool, error) {
+				changed, err := aws.UpdateLifecycleRules(s3Config, rules)
+				return description, len(changed) == 0, err
+			}, func() (string, error) {
+				return description, nil
+			})
+		})
 	}
-	if localPath == "" {
-		cwd, err := os.Getwd()
+	steps := []types.WorkspaceInitStep{}
+	for _, provisionSetting := range provisions {
+		step, err := provisionSetting()
+		steps = append(steps, step)
 		if err != nil {
-			fmt.Println(err)
-			return "", "", err
+			return steps, err
 		}
-		localPath = cwd
 	}
-	return studyName, localPath, nil
+	return steps, nil
 }
-func (s S3WorkspaceService) Sync(localPath string, watch bool, studyName string) {
 
-	studyName, localPath, err := s.determinePathAndName(localPath, studyName)
-	if err != nil {
-		fmt.Println(err)
-		return
+// getLifecycleRules returns the lifecycle rules of the settings, and their description
+func getLifecycleRules(studyName string, settings types.WorkspaceInitSettings) ([]types.BucketLifecycleRule, string) {
+	rules := []types.BucketLifecycleRule{}
+	descriptions := []string{}
+	if settings.ExpireJobsAfterDays > 0 {
+		jobsPrefix := studyName + "/_jobs/"
+		rules = append(rules, types.BucketLifecycleRule{
+			Id:                              "hyperdrive-expire-jobs-" + studyName,
+			Prefix:                          jobsPrefix,
+			ExpirationDays:                  settings.ExpireJobsAfterDays,
+			NoncurrentVersionExpirationDays: settings.ExpireJobsAfterDays,
+		})
+		descriptions = append(descriptions, fmt.Sprintf("expire %s after %d days", jobsPrefix, settings.ExpireJobsAfterDays))
 	}
-	if watch {
-		s.watchSync(localPath, studyName)
-
-	} else {
-		s.syncOnce(localPath, studyName)
+	if settings.AbortIncompleteUploadsAfterDays > 0 {
+		rules = append(rules, types.BucketLifecycleRule{
+			Id:                        "hyperdrive-abort-incomplete-uploads",
+			AbortIncompleteUploadDays: settings.AbortIncompleteUploadsAfterDays,
+		})
+		descriptions = append(descriptions, fmt.Sprintf("abort incomplete uploads after %d days", settings.AbortIncompleteUploadsAfterDays))
 	}
+	return rules, strings.Join(descriptions, ", ")
 }
-func (s S3WorkspaceService) pull(localPath string, studyName string) {
-	remotePath := s.GetS3Url(studyName)
-	fmt.Println(remotePath)
 
-	fmt.Println("Pulling from remote")
-	aws.SyncDirectory(s.S3Configuration, remotePath, localPath)
-}
-func (s S3WorkspaceService) syncOnce(localPath string, studyName string) {
-	remotePath := s.GetS3Url(studyName)
-	fmt.Println(remotePath)
-
-	lockfile, err := lockedfile.Create(LOCKFILE_NAME)
-	if err != nil {
-		fmt.Println("could not aquire lock to sync")
-		return
+// provision brings one setting of the bucket to the wanted state. current returns the state of
+// the setting and whether it is as wanted, update changes it and returns its new state.
+func provision(setting string, current func() (string, bool, error), update func() (string, error)) (types.WorkspaceInitStep, error) {
+	step := types.WorkspaceInitStep{Setting: setting}
+	state, ok, err := current()
+	if err == nil && !ok {
+		step.Changed = true
+		state, err = update()
 	}
-	fmt.Println("syncing local to remote")
-	aws.SyncDirectory(s.S3Configuration, localPath, remotePath)
-	fmt.Println("syncing remote to local")
-	aws.SyncDirectory(s.S3Configuration, remotePath, localPath)
-	lockfile.Close()
-	os.Remove(LOCKFILE_NAME)
-}
-func (s S3WorkspaceService) watchSync(localPath string, studyName string) {
-	s.syncOnce(localPath, studyName)
-	for range time.Tick(time.Second * 10) {
-		s.syncOnce(localPath, studyName)
+	step.State = state
+	if errors.Is(err, aws.ErrNotSupported) {
+		return types.WorkspaceInitStep{Setting: setting, State: "not supported by the store"}, nil
+	}
+	if err != nil {
+		step.State = "failed"
+		step.Changed = false
 	}
+	return step, err
 }
 
-func (s S3WorkspaceService) GetS3Url(studyName string) string {
-
-	return fmt.Sprintf("s3://%s/%s", s.S3Configuration.BucketName, studyName)
+// sameSize reports whether a local file has the size of an object, which rules out most
+// changes without hashing the file
+func sameSize(filename string, object types.ObjectInfo) (bool, error) {
+	stat, err := os.Stat(filename)
+	if err != nil {
+		return false, err
+	}
+	return stat.Size() == object.Size, nil
 }
 
-func (s S3WorkspaceService) Pack(studyName string, packFile string) {
-	var packPath string = packFile
-	if packFile == "" {
-		packPath = studyName + "/_jobs/" + studyName + "/" + studyName + ".hyperpack.zip"
+// computeETag computes the S3 ETag of a local file. Objects uploaded in parts have the ETag
+// md5(md5(part 1) + ... + md5(part n))-n, which is computed with the part size of the configured
+// chunk size or of the SDK's default, or failing that the smallest whole MiB part size that
+// gives n parts.
+func computeETag(filename string, remoteETag string) (string, error) {
+	parts := 0
+	if i := strings.LastIndex(remoteETag, "-"); i >= 0 {
+		parts, _ = strconv.Atoi(remoteETag[i+1:])
+	}
+	f, err := os.Open(filename)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	if parts == 0 {
+		hash := md5.New()
+		if _, err := io.Copy(hash, f); err != nil {
+			return "", err
+		}
+		return hex.EncodeToString(hash.Sum(nil)), nil
 	}
 
-	err := aws.DownloadObject(s.S3Configuration, studyName+".hyperpack.zip", packPath)
-
+	stat, err := f.Stat()
 	if err != nil {
-		fmt.Println("Error pulling from S3: ", err)
+		return "", err
+	}
+	const mib = 1024 * 1024
+	partSize := ((stat.Size()/int64(parts))/mib + 1) * mib
+	for _, candidate := range []int64{aws.GetPartSize(stat.Size(), transfer.GetSettings().MultipartChunkSize), 5 * mib} {
+		if (stat.Size()+candidate-1)/candidate == int64(parts) {
+			partSize = candidate
+			break
+		}
+	}
+	sums := md5.New()
+	for {
+		hash := md5.New()
+		n, err := io.CopyN(hash, f, partSize)
+		if n > 0 {
+			sums.Write(hash.Sum(nil))
+		}
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return "", err
+		}
 	}
+	return fmt.Sprintf("%s-%d", hex.EncodeToString(sums.Sum(nil)), parts), nil
 }
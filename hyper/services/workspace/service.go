@@ -0,0 +1,136 @@
+package workspace
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/gohypergiant/hyperdrive/hyper/client/transfer"
+	"github.com/gohypergiant/hyperdrive/hyper/services/notebook"
+	"github.com/gohypergiant/hyperdrive/hyper/types"
+	"github.com/rogpeppe/go-internal/lockedfile"
+)
+
+const LOCKFILE_NAME string = "hyperdrive-workspace.lock"
+
+// RemoteWorkspaceService syncs workspaces with a workspace remote. The remote's files are
+// accessed through the backend of its type.
+type RemoteWorkspaceService struct {
+	ManifestPath string
+	Backend      types.IWorkspaceBackend
+}
+
+func (s RemoteWorkspaceService) Pull(localPath string, studyName string, dryRun bool) {
+
+	studyName, localPath, err := s.determinePathAndName(localPath, studyName)
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	s.pull(localPath, studyName, dryRun)
+}
+
+func (s RemoteWorkspaceService) determinePathAndName(localPath string, studyName string) (string, string, error) {
+	if studyName == "" {
+		studyName = notebook.GetNotebookName(s.ManifestPath)
+	}
+	if localPath == "" {
+		cwd, err := os.Getwd()
+		if err != nil {
+			fmt.Println(err)
+			return "", "", err
+		}
+		localPath = cwd
+	}
+	return studyName, localPath, nil
+}
+func (s RemoteWorkspaceService) Sync(localPath string, studyName string, settings types.WorkspaceSyncSettings) {
+
+	studyName, localPath, err := s.determinePathAndName(localPath, studyName)
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	syncer := newWorkspaceSyncer(s, localPath, studyName, settings)
+	if settings.Watch {
+		s.watchSync(syncer, settings)
+	} else if err := s.syncOnce(syncer); err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+}
+func (s RemoteWorkspaceService) pull(localPath string, studyName string, dryRun bool) {
+	remotePath := s.GetUrl(studyName)
+	fmt.Println(remotePath)
+
+	fmt.Println("Pulling from remote")
+	syncer := newWorkspaceSyncer(s, localPath, studyName, types.WorkspaceSyncSettings{DryRun: dryRun})
+	err := withWorkspaceLock(syncer.pullAll)
+	syncer.printSummary()
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+}
+
+// syncOnce syncs local and remote changes in both directions while holding the workspace lock
+func (s RemoteWorkspaceService) syncOnce(syncer *workspaceSyncer) error {
+	fmt.Printf("syncing %s with %s\n", syncer.localPath, s.GetUrl(syncer.studyName))
+	err := withWorkspaceLock(func() error {
+		return syncer.syncAll(nil)
+	})
+	syncer.printSummary()
+	return err
+}
+
+// Status prints the changes the next sync would make, and the conflicts it would have to resolve
+func (s RemoteWorkspaceService) Status(localPath string, studyName string) {
+	studyName, localPath, err := s.determinePathAndName(localPath, studyName)
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	syncer := newWorkspaceSyncer(s, localPath, studyName, types.WorkspaceSyncSettings{ConflictPolicy: types.ConflictAbort})
+	items, err := syncer.planAll(nil)
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+	printSyncStatus(localPath, s.GetUrl(studyName), items)
+}
+
+func withWorkspaceLock(f func() error) error {
+	lockfile, err := lockedfile.Create(LOCKFILE_NAME)
+	if err != nil {
+		return fmt.Errorf("could not aquire lock to sync")
+	}
+	defer func() {
+		lockfile.Close()
+		os.Remove(LOCKFILE_NAME)
+	}()
+	return f()
+}
+
+// GetUrl returns the location of the study's workspace on the remote
+func (s RemoteWorkspaceService) GetUrl(studyName string) string {
+	return s.Backend.GetUrl(studyName)
+}
+
+func (s RemoteWorkspaceService) Pack(studyName string, packFile string) {
+	var packPath string = packFile
+	if packFile == "" {
+		packPath = studyName + "/_jobs/" + studyName + "/" + studyName + ".hyperpack.zip"
+	}
+
+	savePath := studyName + ".hyperpack.zip"
+	err := transfer.Retry("the download of "+packPath, func() error {
+		return s.Backend.Download(packPath, savePath)
+	})
+
+	if err != nil {
+		fmt.Println("Error pulling from remote: ", err)
+		os.Exit(1)
+	}
+	if stat, err := os.Stat(savePath); err == nil {
+		fmt.Println(transferSummary{Transferred: 1, Bytes: stat.Size()})
+	}
+}
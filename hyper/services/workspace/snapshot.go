@@ -0,0 +1,284 @@
+package workspace
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/docker/go-units"
+	"github.com/gohypergiant/hyperdrive/hyper/types"
+	"github.com/google/uuid"
+)
+
+// SNAPSHOTS_DIR holds the snapshots of a workspace on its remote, next to the workspace files.
+// It is reserved and never synced.
+const SNAPSHOTS_DIR string = ".snapshots"
+
+func getSnapshotsPrefix(studyName string) string {
+	return studyName + "/" + SNAPSHOTS_DIR + "/"
+}
+
+func getSnapshotKey(studyName string, snapshotId string) string {
+	return getSnapshotsPrefix(studyName) + snapshotId + ".json"
+}
+
+// getBlobKey returns the key of the copy of an object kept for snapshots of an unversioned
+// bucket. Copies are addressed by ETag, so an unchanged file is only ever copied once.
+func getBlobKey(studyName string, etag string) string {
+	return getSnapshotsPrefix(studyName) + "objects/" + etag
+}
+
+// Snapshot records every file of the remote workspace as it is now. On a bucket with versioning
+// enabled the snapshot refers to the current object versions, otherwise the objects are copied
+// under the snapshots directory.
+func (s RemoteWorkspaceService) Snapshot(studyName string, message string) {
+	studyName, _, err := s.determinePathAndName(".", studyName)
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+	versioned, err := s.Backend.IsVersioned()
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+
+	prefix := studyName + "/"
+	var objects []types.ObjectInfo
+	if versioned {
+		objects, err = s.Backend.ListCurrentVersions(prefix)
+	} else {
+		objects, err = s.Backend.List(prefix)
+	}
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+
+	blobs := map[string]bool{}
+	if !versioned {
+		existing, err := s.Backend.List(getBlobKey(studyName, ""))
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+		for _, blob := range existing {
+			blobs[blob.Key] = true
+		}
+	}
+
+	createdAt := time.Now().UTC()
+	snapshot := types.WorkspaceSnapshot{
+		Id:        fmt.Sprintf("%s-%s", createdAt.Format("20060102-150405"), uuid.NewString()[:8]),
+		CreatedAt: createdAt,
+		Message:   message,
+		Files:     []types.WorkspaceSnapshotFile{},
+	}
+	var size int64
+	for _, object := range objects {
+		rel := strings.TrimPrefix(object.Key, prefix)
+		if rel == "" || strings.HasSuffix(rel, "/") || isSyncIgnored(rel) {
+			continue
+		}
+		file := types.WorkspaceSnapshotFile{Path: rel, Size: object.Size, ETag: object.ETag, VersionId: object.VersionId}
+		if !versioned {
+			file.Blob = getBlobKey(studyName, object.ETag)
+			if !blobs[file.Blob] {
+				if _, err := s.Backend.Copy(object.Key, "", file.Blob); err != nil {
+					fmt.Println(err)
+					os.Exit(1)
+				}
+				blobs[file.Blob] = true
+			}
+		}
+		snapshot.Files = append(snapshot.Files, file)
+		size += object.Size
+	}
+
+	content, err := json.MarshalIndent(snapshot, "", "  ")
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+	err = s.Backend.WriteObject(getSnapshotKey(studyName, snapshot.Id), content)
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+	fmt.Printf("Created snapshot %s of %s (%d files, %s)\n", snapshot.Id, s.GetUrl(studyName), len(snapshot.Files), units.HumanSize(float64(size)))
+}
+
+// Snapshots lists the snapshots of the remote workspace, oldest first
+func (s RemoteWorkspaceService) Snapshots(studyName string) {
+	studyName, _, err := s.determinePathAndName(".", studyName)
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+	snapshots, err := s.getSnapshots(studyName)
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+	if len(snapshots) == 0 {
+		fmt.Printf("No snapshots of %s\n", s.GetUrl(studyName))
+		return
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "SNAPSHOT\tCREATED\tFILES\tSIZE\tMESSAGE")
+	for _, snapshot := range snapshots {
+		var size int64
+		for _, file := range snapshot.Files {
+			size += file.Size
+		}
+		fmt.Fprintf(w, "%s\t%s\t%d\t%s\t%s\n", snapshot.Id, snapshot.CreatedAt.Local().Format("2006-01-02 15:04:05"), len(snapshot.Files), units.HumanSize(float64(size)), snapshot.Message)
+	}
+	w.Flush()
+}
+
+// Restore brings files back from a snapshot, both on the remote and locally. With no paths the
+// whole snapshot is restored. Files created since the snapshot are left as they are.
+func (s RemoteWorkspaceService) Restore(localPath string, studyName string, snapshotId string, paths []string) {
+	studyName, localPath, err := s.determinePathAndName(localPath, studyName)
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+	snapshot, err := s.getSnapshot(studyName, snapshotId)
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+	files := []types.WorkspaceSnapshotFile{}
+	for _, file := range snapshot.Files {
+		if matchesRestorePaths(file.Path, paths) {
+			files = append(files, file)
+		}
+	}
+	if len(files) == 0 {
+		fmt.Printf("Snapshot %s has no files matching %v\n", snapshot.Id, paths)
+		os.Exit(1)
+	}
+
+	syncer := newWorkspaceSyncer(s, localPath, studyName, types.WorkspaceSyncSettings{})
+	err = withWorkspaceLock(func() error {
+		syncer.mu.Lock()
+		defer syncer.mu.Unlock()
+		failed := 0
+		for _, file := range files {
+			if err := syncer.restore(file); err != nil {
+				failed++
+				fmt.Printf("Could not restore %s: %v\n", file.Path, err)
+				continue
+			}
+			fmt.Printf("Restored %s\n", file.Path)
+		}
+		if err := syncer.state.write(syncer.localPath); err != nil {
+			return err
+		}
+		if failed > 0 {
+			return fmt.Errorf("%d files could not be restored", failed)
+		}
+		return nil
+	})
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+	fmt.Printf("Restored %d files from snapshot %s\n", len(files), snapshot.Id)
+}
+
+// restore copies a snapshotted file back over the current object, unless it is unchanged, and
+// pulls it into the local workspace
+func (w *workspaceSyncer) restore(file types.WorkspaceSnapshotFile) error {
+	key := w.getKey(file.Path)
+	current, err := w.service.Backend.Stat(key)
+	if err != nil {
+		return err
+	}
+	if !current.Exists || current.ETag != file.ETag {
+		srcKey := file.Blob
+		if file.VersionId != "" {
+			srcKey = key
+		}
+		if _, err := w.service.Backend.Copy(srcKey, file.VersionId, key); err != nil {
+			return err
+		}
+	}
+	return w.download(file.Path)
+}
+
+// matchesRestorePaths reports whether a file is one of the paths to restore, or is under one of them
+func matchesRestorePaths(rel string, paths []string) bool {
+	if len(paths) == 0 {
+		return true
+	}
+	for _, p := range paths {
+		p = strings.Trim(strings.TrimPrefix(p, "./"), "/")
+		if p == "" || rel == p || strings.HasPrefix(rel, p+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+func (s RemoteWorkspaceService) getSnapshots(studyName string) ([]types.WorkspaceSnapshot, error) {
+	prefix := getSnapshotsPrefix(studyName)
+	objects, err := s.Backend.List(prefix)
+	if err != nil {
+		return nil, err
+	}
+	snapshots := []types.WorkspaceSnapshot{}
+	for _, object := range objects {
+		name := strings.TrimPrefix(object.Key, prefix)
+		if strings.Contains(name, "/") || !strings.HasSuffix(name, ".json") {
+			continue
+		}
+		content, err := s.Backend.ReadObject(object.Key)
+		if err != nil {
+			return nil, err
+		}
+		var snapshot types.WorkspaceSnapshot
+		if err := json.Unmarshal(content, &snapshot); err != nil {
+			fmt.Printf("Skipping snapshot %s: %v\n", name, err)
+			continue
+		}
+		snapshots = append(snapshots, snapshot)
+	}
+	sort.Slice(snapshots, func(i, j int) bool {
+		return snapshots[i].CreatedAt.Before(snapshots[j].CreatedAt)
+	})
+	return snapshots, nil
+}
+
+// getSnapshot returns the snapshot with the given id. Any unique prefix of a snapshot id is
+// accepted, as is "latest" for the most recent snapshot.
+func (s RemoteWorkspaceService) getSnapshot(studyName string, snapshotId string) (types.WorkspaceSnapshot, error) {
+	snapshots, err := s.getSnapshots(studyName)
+	if err != nil {
+		return types.WorkspaceSnapshot{}, err
+	}
+	if snapshotId == "latest" && len(snapshots) > 0 {
+		return snapshots[len(snapshots)-1], nil
+	}
+	var matches []types.WorkspaceSnapshot
+	for _, snapshot := range snapshots {
+		if snapshot.Id == snapshotId {
+			return snapshot, nil
+		}
+		if strings.HasPrefix(snapshot.Id, snapshotId) {
+			matches = append(matches, snapshot)
+		}
+	}
+	if len(matches) == 1 {
+		return matches[0], nil
+	}
+	if len(matches) > 1 {
+		return types.WorkspaceSnapshot{}, fmt.Errorf("snapshot id %q is ambiguous", snapshotId)
+	}
+	return types.WorkspaceSnapshot{}, fmt.Errorf("no snapshot %q found for %s", snapshotId, s.GetUrl(studyName))
+}
@@ -0,0 +1,69 @@
+package workspace
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/gohypergiant/hyperdrive/hyper/types"
+)
+
+// SYNC_STATE_FILE_NAME is the sync state database kept at the root of every synced workspace.
+// It is specific to the machine it is on and is never synced itself.
+const SYNC_STATE_FILE_NAME string = ".hyperdrive-sync.json"
+
+// syncState records every file as it was when it was last synced, on both sides, so a sync can
+// tell which side changed a file since
+type syncState struct {
+	Remote string                `json:"remote"`
+	Files  map[string]syncedFile `json:"files"`
+}
+
+type syncedFile struct {
+	Size    int64     `json:"size"`
+	ModTime time.Time `json:"mod_time"`
+	ETag    string    `json:"etag"`
+}
+
+// readSyncState reads the workspace's sync state. State recorded against a different remote
+// is discarded, as is an unreadable state file, so every file is compared from scratch.
+func readSyncState(localPath string, remote string) *syncState {
+	state := &syncState{Remote: remote, Files: map[string]syncedFile{}}
+	content, err := os.ReadFile(filepath.Join(localPath, SYNC_STATE_FILE_NAME))
+	if err != nil {
+		return state
+	}
+	var recorded syncState
+	if err := json.Unmarshal(content, &recorded); err != nil || recorded.Remote != remote || recorded.Files == nil {
+		return state
+	}
+	return &recorded
+}
+
+func (s *syncState) write(localPath string) error {
+	content, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return err
+	}
+	statePath := filepath.Join(localPath, SYNC_STATE_FILE_NAME)
+	tmpPath := statePath + ".tmp"
+	if err := os.WriteFile(tmpPath, content, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmpPath, statePath)
+}
+
+// writeSyncStats replaces the sync stats of the workspace, so they are never read half written
+func writeSyncStats(localPath string, stats types.WorkspaceSyncStats) error {
+	content, err := json.Marshal(stats)
+	if err != nil {
+		return err
+	}
+	statsPath := filepath.Join(localPath, types.SYNC_STATS_FILE_NAME)
+	tmpPath := statsPath + ".tmp"
+	if err := os.WriteFile(tmpPath, content, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmpPath, statsPath)
+}
@@ -0,0 +1,91 @@
+package workspace
+
+import (
+	"fmt"
+	"os"
+	"text/tabwriter"
+
+	"github.com/docker/go-units"
+)
+
+func printSyncStatus(localPath string, remote string, items []syncItem) {
+	fmt.Printf("Workspace %s <-> %s\n", localPath, remote)
+
+	push, pull, conflicts := []syncItem{}, []syncItem{}, []syncItem{}
+	for _, item := range items {
+		switch item.Action {
+		case actionUpload, actionDeleteRemote:
+			push = append(push, item)
+		case actionDownload, actionDeleteLocal:
+			pull = append(pull, item)
+		case actionConflict:
+			conflicts = append(conflicts, item)
+		}
+	}
+	if len(push)+len(pull)+len(conflicts) == 0 {
+		fmt.Println("\nEverything up to date")
+		return
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	if len(push) > 0 {
+		fmt.Fprintln(w, "\nChanges to push:")
+		for _, item := range push {
+			fmt.Fprintf(w, "  %s\t%s\n", describeChange(item.Base != nil, item.Local.Exists), item.Path)
+		}
+	}
+	if len(pull) > 0 {
+		fmt.Fprintln(w, "\nChanges to pull:")
+		for _, item := range pull {
+			fmt.Fprintf(w, "  %s\t%s\n", describeChange(item.Base != nil, item.Remote.Exists), item.Path)
+		}
+	}
+	if len(conflicts) > 0 {
+		fmt.Fprintln(w, "\nConflicts:")
+		for _, item := range conflicts {
+			fmt.Fprintf(w, "  %s\t%s\n", item.Path, item.Reason)
+		}
+	}
+	w.Flush()
+}
+
+func describeChange(synced bool, exists bool) string {
+	switch {
+	case !exists:
+		return "deleted:"
+	case synced:
+		return "modified:"
+	default:
+		return "new:"
+	}
+}
+
+func printDryRun(items []syncItem) {
+	changes := 0
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	for _, item := range items {
+		var description string
+		switch item.Action {
+		case actionUpload:
+			description = fmt.Sprintf("push (%s)", units.HumanSize(float64(item.Local.Size)))
+		case actionDownload:
+			description = fmt.Sprintf("pull (%s)", units.HumanSize(float64(item.Remote.Size)))
+		case actionDeleteRemote:
+			description = "delete from remote"
+		case actionDeleteLocal:
+			description = "delete locally"
+		case actionKeepBoth:
+			description = "conflict, keep both"
+		default:
+			continue
+		}
+		changes++
+		fmt.Fprintf(w, "  %s\t%s\n", description, item.Path)
+	}
+	w.Flush()
+	if changes == 0 {
+		fmt.Println("Dry run: nothing to transfer")
+		return
+	}
+	fmt.Printf("Dry run: %d changes, nothing was transferred\n", changes)
+}
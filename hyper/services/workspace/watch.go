@@ -0,0 +1,280 @@
+package workspace
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/gohypergiant/hyperdrive/hyper/client/ignore"
+	"github.com/gohypergiant/hyperdrive/hyper/types"
+)
+
+const DefaultWatchDebounce = 2 * time.Second
+const DefaultWatchPullInterval = 30 * time.Second
+
+// eventQueueWaitSeconds is how long a single receive from the event queue waits for events
+const eventQueueWaitSeconds int64 = 20
+
+// workspaceWatcher pushes local changes file by file as fsnotify reports them, and pulls remote
+// changes either on an interval or from the bucket's event notification queue
+type workspaceWatcher struct {
+	service  RemoteWorkspaceService
+	syncer   *workspaceSyncer
+	settings types.WorkspaceSyncSettings
+	watcher  *fsnotify.Watcher
+
+	mu          sync.Mutex
+	pending     map[string]*time.Timer
+	directories map[string]bool
+
+	statsMu sync.Mutex
+	stats   types.WorkspaceSyncStats
+}
+
+func (s RemoteWorkspaceService) watchSync(syncer *workspaceSyncer, settings types.WorkspaceSyncSettings) {
+	if settings.Debounce <= 0 {
+		settings.Debounce = DefaultWatchDebounce
+	}
+	if settings.PullInterval <= 0 {
+		settings.PullInterval = DefaultWatchPullInterval
+	}
+	backend := s.Backend
+	if encrypted, ok := backend.(EncryptedWorkspaceBackend); ok {
+		backend = encrypted.Backend
+	}
+	eventSource, ok := backend.(types.IWorkspaceEventSource)
+	if settings.EventQueueUrl != "" && !ok {
+		fmt.Println("--eventQueueUrl is only supported by s3 workspace remotes")
+		os.Exit(1)
+	}
+	if err := s.syncOnce(syncer); err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+	defer watcher.Close()
+	w := &workspaceWatcher{
+		service:     s,
+		syncer:      syncer,
+		settings:    settings,
+		watcher:     watcher,
+		pending:     map[string]*time.Timer{},
+		directories: map[string]bool{},
+	}
+	w.writeStats()
+	w.watchDirectory(syncer.localPath, false)
+
+	if settings.EventQueueUrl != "" {
+		fmt.Printf("Watching %s, pulling remote changes from %s\n", syncer.localPath, settings.EventQueueUrl)
+		go w.pullFromEventQueue(eventSource)
+	} else {
+		fmt.Printf("Watching %s, pulling remote changes every %s\n", syncer.localPath, settings.PullInterval)
+		go w.pullOnInterval()
+	}
+
+	for {
+		select {
+		case event, ok := <-watcher.Events:
+			if !ok {
+				return
+			}
+			w.handleEvent(event)
+		case err, ok := <-watcher.Errors:
+			if !ok {
+				return
+			}
+			fmt.Println("Watch error: ", err)
+		}
+	}
+}
+
+// watchDirectory adds a watch for the directory and everything below it, since fsnotify
+// doesn't watch recursively. Files found in a directory created after the watch started are
+// scheduled for upload, as they may have been written before their directory was watched.
+func (w *workspaceWatcher) watchDirectory(root string, scheduleFiles bool) {
+	_ = filepath.WalkDir(root, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return nil
+		}
+		if rel, err := w.getRel(path); err == nil && rel != "." && w.syncer.isIgnored(rel, entry.IsDir()) {
+			if entry.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !entry.IsDir() {
+			if scheduleFiles {
+				w.schedule(path)
+			}
+			return nil
+		}
+		if err := w.watcher.Add(path); err != nil {
+			fmt.Printf("Could not watch %s: %v\n", path, err)
+			return nil
+		}
+		w.mu.Lock()
+		w.directories[path] = true
+		w.mu.Unlock()
+		return nil
+	})
+}
+
+func (w *workspaceWatcher) handleEvent(event fsnotify.Event) {
+	rel, err := w.getRel(event.Name)
+	if err != nil || event.Op == fsnotify.Chmod {
+		return
+	}
+	if rel == ignore.HYPERIGNORE_FILE_NAME || rel == ignore.DOCKERIGNORE_FILE_NAME {
+		if err := w.syncer.reloadIgnore(); err != nil {
+			fmt.Println(err)
+		}
+	}
+	if w.syncer.isIgnored(rel, false) {
+		return
+	}
+	if event.Op&fsnotify.Create == fsnotify.Create {
+		if stat, err := os.Stat(event.Name); err == nil && stat.IsDir() {
+			w.watchDirectory(event.Name, true)
+			return
+		}
+	}
+	w.schedule(event.Name)
+}
+
+func (w *workspaceWatcher) getRel(path string) (string, error) {
+	rel, err := filepath.Rel(w.syncer.localPath, path)
+	if err != nil {
+		return "", err
+	}
+	return filepath.ToSlash(rel), nil
+}
+
+// schedule (re)starts the debounce timer of a file, so a file is only pushed once it has been
+// left alone for the debounce period
+func (w *workspaceWatcher) schedule(path string) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if timer, ok := w.pending[path]; ok {
+		timer.Reset(w.settings.Debounce)
+		return
+	}
+	w.pending[path] = time.AfterFunc(w.settings.Debounce, func() {
+		w.mu.Lock()
+		delete(w.pending, path)
+		w.mu.Unlock()
+		w.push(path)
+	})
+}
+
+func (w *workspaceWatcher) isPending(rel string) bool {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	_, ok := w.pending[w.syncer.getLocalPath(rel)]
+	return ok
+}
+
+// push syncs a changed file, or every previously synced file below a removed directory
+func (w *workspaceWatcher) push(path string) {
+	rel, err := w.getRel(path)
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	rels := []string{rel}
+	w.mu.Lock()
+	wasDirectory := w.directories[path]
+	w.mu.Unlock()
+	if _, err := os.Stat(path); os.IsNotExist(err) && wasDirectory {
+		w.mu.Lock()
+		delete(w.directories, path)
+		w.mu.Unlock()
+		rels = w.syncer.syncedPathsUnder(rel)
+	}
+	err = withWorkspaceLock(func() error {
+		return w.syncer.syncPaths(rels)
+	})
+	if err != nil {
+		fmt.Println(err)
+	}
+	w.recordSync(err)
+}
+
+// recordSync counts a sync of the watch, and writes the stats of the watch to the workspace
+func (w *workspaceWatcher) recordSync(err error) {
+	w.statsMu.Lock()
+	w.stats.Syncs++
+	if err != nil {
+		w.stats.FailedSyncs++
+	}
+	w.statsMu.Unlock()
+	w.writeStats()
+}
+
+// writeStats writes the stats of the watch to the workspace, with the transfers of every sync so
+// far, the one made as the watch started included
+func (w *workspaceWatcher) writeStats() {
+	summary := w.syncer.getSummary()
+	w.statsMu.Lock()
+	defer w.statsMu.Unlock()
+	w.stats.FilesTransferred = int64(summary.Transferred)
+	w.stats.FilesFailed = int64(summary.Failed)
+	w.stats.BytesTransferred = summary.Bytes
+	w.stats.LastSyncAt = time.Now().UTC()
+	if err := writeSyncStats(w.syncer.localPath, w.stats); err != nil {
+		fmt.Println(err)
+	}
+}
+
+// pullOnInterval syncs the whole workspace on an interval, leaving out the files with local
+// changes that are still waiting to be pushed
+func (w *workspaceWatcher) pullOnInterval() {
+	for range time.Tick(w.settings.PullInterval) {
+		err := withWorkspaceLock(func() error {
+			return w.syncer.syncAll(w.isPending)
+		})
+		if err != nil {
+			fmt.Println(err)
+		}
+		w.recordSync(err)
+	}
+}
+
+// pullFromEventQueue syncs the files reported changed by the bucket's event notifications
+func (w *workspaceWatcher) pullFromEventQueue(eventSource types.IWorkspaceEventSource) {
+	prefix := w.syncer.studyName + "/"
+	for {
+		events, err := eventSource.ReceiveObjectEvents(w.settings.EventQueueUrl, eventQueueWaitSeconds)
+		if err != nil {
+			fmt.Println(err)
+			time.Sleep(w.settings.PullInterval)
+		}
+		rels := []string{}
+		for _, event := range events {
+			rel := strings.TrimPrefix(event.Key, prefix)
+			if !strings.HasPrefix(event.Key, prefix) || rel == "" || strings.HasSuffix(rel, "/") || w.isPending(rel) {
+				continue
+			}
+			rels = append(rels, rel)
+		}
+		if len(rels) == 0 {
+			continue
+		}
+		err = withWorkspaceLock(func() error {
+			return w.syncer.syncPaths(rels)
+		})
+		if err != nil {
+			fmt.Println(err)
+		}
+		w.recordSync(err)
+	}
+}
@@ -2,24 +2,63 @@ package workspace
 
 import (
 	"fmt"
+	"github.com/gohypergiant/hyperdrive/hyper/client/transfer"
 	config2 "github.com/gohypergiant/hyperdrive/hyper/services/config"
 	"github.com/gohypergiant/hyperdrive/hyper/types"
 	"os"
 )
 
-func WorkspaceService(remoteName string, manifestPath string, workspaceS3Configuration types.S3WorkspacePersistenceRemoteConfiguration) types.IWorkspaceService {
+func WorkspaceService(remoteName string, manifestPath string, syncOptions types.WorkspaceSyncOptions) types.IWorkspaceService {
+	syncOptions = resolveSyncOptions(remoteName, syncOptions)
 
-	workspaceRemoteType := types.S3
+	if syncOptions.Transfer != (types.WorkspaceTransferSettings{}) {
+		transfer.Configure(syncOptions.Transfer)
+	}
 
-	if (types.S3WorkspacePersistenceRemoteConfiguration{}) == workspaceS3Configuration {
-		workspaceS3Configuration = config2.GetWorkspacePersistenceRemote(remoteName).S3Configuration
+	backend := newWorkspaceBackend(syncOptions)
+	if syncOptions.Encryption.IsEnabled() {
+		encryptedBackend, err := NewEncryptedWorkspaceBackend(backend, syncOptions.Encryption)
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+		backend = encryptedBackend
 	}
+	return RemoteWorkspaceService{ManifestPath: manifestPath, Backend: backend}
+}
+
+// resolveSyncOptions fills in the options from the named workspace remote, unless the remote was
+// given with flags
+func resolveSyncOptions(remoteName string, syncOptions types.WorkspaceSyncOptions) types.WorkspaceSyncOptions {
+	if syncOptions.Type == "" && (types.S3WorkspacePersistenceRemoteConfiguration{}) == syncOptions.S3Config {
+		remoteConfig := config2.GetWorkspacePersistenceRemote(remoteName)
+		syncOptions.Type = remoteConfig.Type
+		syncOptions.S3Config = remoteConfig.S3Configuration
+		syncOptions.FilesystemConfig = remoteConfig.FilesystemConfiguration
+		syncOptions.GCSConfig = remoteConfig.GCSConfiguration
+		syncOptions.AzureBlobConfig = remoteConfig.AzureBlobConfiguration
+		if !syncOptions.Encryption.IsEnabled() {
+			syncOptions.Encryption = remoteConfig.Encryption
+		}
+	}
+	return syncOptions
+}
 
-	if workspaceRemoteType == types.S3 {
-		return S3WorkspaceService{
-			S3Configuration: workspaceS3Configuration,
-			ManifestPath:    manifestPath,
+func newWorkspaceBackend(syncOptions types.WorkspaceSyncOptions) types.IWorkspaceBackend {
+	switch syncOptions.Type {
+	case types.Filesystem:
+		filesystemBackend, err := NewFilesystemWorkspaceBackend(syncOptions.FilesystemConfig.Path)
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(1)
 		}
+		return filesystemBackend
+	case types.GCS:
+		return GCSWorkspaceBackend{GCSConfiguration: syncOptions.GCSConfig}
+	case types.AzureBlob:
+		return AzureBlobWorkspaceBackend{AzureBlobConfiguration: syncOptions.AzureBlobConfig}
+	case types.S3, "":
+		return S3WorkspaceBackend{S3Configuration: syncOptions.S3Config}
 	}
 	fmt.Println("invalid workspace remote specified")
 	os.Exit(1)
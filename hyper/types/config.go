@@ -4,11 +4,17 @@ type ComputeRemoteType string
 type WorkspacePersistenceRemoteType string
 
 const (
-	S3 WorkspacePersistenceRemoteType = "s3"
+	S3         WorkspacePersistenceRemoteType = "s3"
+	Filesystem WorkspacePersistenceRemoteType = "filesystem"
+	GCS        WorkspacePersistenceRemoteType = "gcs"
+	AzureBlob  WorkspacePersistenceRemoteType = "azureblob"
 )
 
 var ValidWorkspacePersistenceRemoteTypes = []WorkspacePersistenceRemoteType{
 	S3,
+	Filesystem,
+	GCS,
+	AzureBlob,
 }
 
 const (
@@ -28,8 +34,12 @@ type ComputeRemoteConfiguration struct {
 	JupyterAPIKey        string                            `mapstructure:"jupyter_api_key" json:"jupyter_api_key"`
 }
 type WorkspacePersistenceRemoteConfiguration struct {
-	Type            WorkspacePersistenceRemoteType            `mapstructure:"type" json:"type"`
-	S3Configuration S3WorkspacePersistenceRemoteConfiguration `mapstructure:"s3" json:"s3"`
+	Type                    WorkspacePersistenceRemoteType                    `mapstructure:"type" json:"type"`
+	S3Configuration         S3WorkspacePersistenceRemoteConfiguration         `mapstructure:"s3" json:"s3"`
+	FilesystemConfiguration FilesystemWorkspacePersistenceRemoteConfiguration `mapstructure:"filesystem" json:"filesystem"`
+	GCSConfiguration        GCSWorkspacePersistenceRemoteConfiguration        `mapstructure:"gcs" json:"gcs"`
+	AzureBlobConfiguration  AzureBlobWorkspacePersistenceRemoteConfiguration  `mapstructure:"azureblob" json:"azureblob"`
+	Encryption              WorkspaceEncryptionConfiguration                  `mapstructure:"encryption" json:"encryption"`
 }
 type FireflyComputeRemoteConfiguration struct {
 	Url      string `mapstructure:"url" json:"url"`
@@ -42,6 +52,9 @@ type EC2ComputeRemoteConfiguration struct {
 	Secret    string `mapstructure:"secret" json:"secret"`
 	Region    string `mapstructure:"region" json:"region"`
 	Token     string `mapstructure:"token" json:"token"`
+	// Spot and MaxPrice are the defaults for the instances started on the remote
+	Spot     bool   `mapstructure:"spot" json:"spot,omitempty"`
+	MaxPrice string `mapstructure:"max_price" json:"max_price,omitempty"`
 }
 type S3WorkspacePersistenceRemoteConfiguration struct {
 	Profile    string `mapstructure:"profile" json:"profile"`
@@ -50,11 +63,43 @@ type S3WorkspacePersistenceRemoteConfiguration struct {
 	Secret     string `mapstructure:"secret" json:"secret"`
 	Region     string `mapstructure:"region" json:"region"`
 	Token      string `mapstructure:"token" json:"token"`
+	// Endpoint, ForcePathStyle and CABundle are only needed for S3-compatible stores
+	Endpoint       string `mapstructure:"endpoint" json:"endpoint,omitempty"`
+	ForcePathStyle bool   `mapstructure:"force_path_style" json:"force_path_style,omitempty"`
+	CABundle       string `mapstructure:"ca_bundle" json:"ca_bundle,omitempty"`
+}
+type FilesystemWorkspacePersistenceRemoteConfiguration struct {
+	Path string `mapstructure:"path" json:"path"`
+}
+type GCSWorkspacePersistenceRemoteConfiguration struct {
+	BucketName string `mapstructure:"bucket_name" json:"bucket_name"`
+	// CredentialsFile is a service account key. Without one the application default credentials are used.
+	CredentialsFile string `mapstructure:"credentials_file" json:"credentials_file"`
+	// Endpoint is only needed for emulators such as fake-gcs-server
+	Endpoint string `mapstructure:"endpoint" json:"endpoint,omitempty"`
+}
+type AzureBlobWorkspacePersistenceRemoteConfiguration struct {
+	AccountName   string `mapstructure:"account_name" json:"account_name"`
+	ContainerName string `mapstructure:"container_name" json:"container_name"`
+	// One of ConnectionString, SASToken or AccountKey authenticates with the storage account
+	ConnectionString string `mapstructure:"connection_string" json:"connection_string,omitempty"`
+	SASToken         string `mapstructure:"sas_token" json:"sas_token,omitempty"`
+	AccountKey       string `mapstructure:"account_key" json:"account_key,omitempty"`
+	// Endpoint overrides https://<account>.blob.core.windows.net, e.g. for Azurite
+	Endpoint string `mapstructure:"endpoint" json:"endpoint,omitempty"`
+}
+
+// WorkspaceEncryptionConfiguration enables client-side encryption of the files of a workspace
+// remote, with either a key file or a passphrase
+type WorkspaceEncryptionConfiguration struct {
+	KeyFile    string `mapstructure:"key_file" json:"key_file,omitempty"`
+	Passphrase string `mapstructure:"passphrase" json:"passphrase,omitempty"`
 }
 type Configuration struct {
 	SchemaVersion               string                                             `mapstructure:"schema_version" json:"schema_version"`
 	ComputeRemotes              map[string]ComputeRemoteConfiguration              `mapstructure:"compute_remotes" json:"compute_remotes"`
 	WorkspacePersistenceRemotes map[string]WorkspacePersistenceRemoteConfiguration `mapstructure:"workspace_remotes" json:"workspace_remotes"`
+	Notifications               []NotificationSinkConfiguration                    `mapstructure:"notifications" json:"notifications,omitempty"`
 }
 type NamedProfileConfiguration struct {
 	AccessKey string
@@ -66,3 +111,6 @@ type NamedProfileConfiguration struct {
 func (s S3WorkspacePersistenceRemoteConfiguration) IsValid() bool {
 	return s.BucketName != "" && s.AccessKey != "" && s.Secret != "" && s.Region != ""
 }
+func (e WorkspaceEncryptionConfiguration) IsEnabled() bool {
+	return e.KeyFile != "" || e.Passphrase != ""
+}
@@ -4,3 +4,11 @@ type DockerOptions struct {
 	HostPort  int
 	LocalOnly bool
 }
+
+// ContainerHealth is the state of a container. Health is the status of its health check, i.e.
+// starting, healthy or unhealthy, and empty if it has none.
+type ContainerHealth struct {
+	Name    string
+	Running bool
+	Health  string
+}
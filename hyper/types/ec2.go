@@ -2,6 +2,8 @@ package types
 
 import (
 	"context"
+	"time"
+
 	"github.com/aws/aws-sdk-go-v2/service/ec2"
 )
 
@@ -20,6 +22,16 @@ type TerminateInstancesAPI interface {
 		params *ec2.TerminateInstancesInput,
 		optFns ...func(*ec2.Options)) (*ec2.TerminateInstancesOutput, error)
 }
+type StopInstancesAPI interface {
+	StopInstances(ctx context.Context,
+		params *ec2.StopInstancesInput,
+		optFns ...func(*ec2.Options)) (*ec2.StopInstancesOutput, error)
+}
+type StartInstancesAPI interface {
+	StartInstances(ctx context.Context,
+		params *ec2.StartInstancesInput,
+		optFns ...func(*ec2.Options)) (*ec2.StartInstancesOutput, error)
+}
 type DescribeVpcsAPI interface {
 	DescribeVpcs(ctx context.Context,
 		params *ec2.DescribeVpcsInput,
@@ -150,7 +162,28 @@ type DeleteKeyPairAPI interface {
 		params *ec2.DeleteKeyPairInput,
 		optFns ...func(*ec2.Options)) (*ec2.DeleteKeyPairOutput, error)
 }
+
+// IdleAction is what an instance does once its notebook has been idle for its idle timeout
+type IdleAction string
+
+const (
+	IdleStop      IdleAction = "stop"
+	IdleTerminate IdleAction = "terminate"
+)
+
+var ValidIdleActions = []IdleAction{IdleStop, IdleTerminate}
+
+// EC2StartOptions configure the instance a remote notebook is started on. With Wait, the start
+// waits for the instance to report that the notebook is ready, for up to WaitTimeout. Spot
+// overrides the spot default of the remote unless it is nil, and MaxPrice its maximum price.
+// With an IdleTimeout, the instance takes the IdleAction once its notebook has been idle for it.
 type EC2StartOptions struct {
 	InstanceType string
 	AmiId        string
+	Wait         bool
+	WaitTimeout  time.Duration
+	Spot         *bool
+	MaxPrice     string
+	IdleTimeout  time.Duration
+	IdleAction   IdleAction
 }
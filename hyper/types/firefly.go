@@ -42,7 +42,10 @@ type UploadDataBody struct {
 	FileType UploadType   `json:"type"`
 }
 
-type TrainingStatus string
+// FileInfoResponse is what the contents API returns about a file, without its content
+type FileInfoResponse struct {
+	LastModified time.Time `json:"last_modified"`
+}
 
 type DownloadFileResponse struct {
 	Content string `json:"content"`
@@ -1,5 +1,7 @@
 package types
 
+import "time"
+
 type JupyterLaunchOptions struct {
 	Flavor        string
 	APIKey        string
@@ -9,14 +11,17 @@ type JupyterLaunchOptions struct {
 	Requirements  bool
 	RestartAlways bool
 	S3AwsProfile  string
+	CPUs          float64
+	Memory        int64
+	StatusToken   string
 }
 type INotebookService interface {
 	Start(jupyterOptions JupyterLaunchOptions, ec2Options EC2StartOptions, syncOptions WorkspaceSyncOptions)
 	List()
 	Stop(mountPointOrIdentifier string)
-	UploadTrainingJobData()
-	WaitForTrainingToComplete(timeout int)
+	UploadTrainingJobData(options TrainingJobOptions) TrainingJob
 	DownloadHyperpack()
+	GetHyperpackSavePath() string
 }
 type S3Credentials struct {
 	AccessKey    string
@@ -29,3 +34,33 @@ type ImageOptions struct {
 	RepoTag string
 	Profile string
 }
+
+// JupyterKernel is what the kernels API of a notebook server returns about a kernel
+type JupyterKernel struct {
+	Id             string    `json:"id"`
+	ExecutionState string    `json:"execution_state"`
+	LastActivity   time.Time `json:"last_activity"`
+	Connections    int       `json:"connections"`
+}
+
+// JupyterStatus is what the status API of a notebook server returns. Its last activity is that of
+// any kernel, terminal or API request of the server.
+type JupyterStatus struct {
+	Started      time.Time `json:"started"`
+	LastActivity time.Time `json:"last_activity"`
+	Connections  int       `json:"connections"`
+	Kernels      int       `json:"kernels"`
+}
+
+// IdleShutdownOptions configure the idle shutdown of an instance. Once the notebook server at
+// JupyterUrl has had no activity for Timeout, the instance runs SyncScript, reports its final
+// status and shuts down, to be stopped or terminated as Action says.
+type IdleShutdownOptions struct {
+	Timeout           time.Duration
+	Action            IdleAction
+	JupyterUrl        string
+	JupyterToken      string
+	SyncScript        string
+	StatusFilePath    string
+	NotificationsFile string
+}
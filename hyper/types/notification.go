@@ -0,0 +1,48 @@
+package types
+
+import "time"
+
+type NotificationSinkType string
+
+const (
+	WebhookSink NotificationSinkType = "webhook"
+	SlackSink   NotificationSinkType = "slack"
+)
+
+var ValidNotificationSinkTypes = []NotificationSinkType{WebhookSink, SlackSink}
+
+// NotificationEvent is what a notification is sent for: a remote instance entering a phase, or
+// a training run completing or failing
+type NotificationEvent string
+
+const (
+	NotifyTrainingCompleted NotificationEvent = NotificationEvent(PhaseTrainingCompleted)
+	NotifyTrainingFailed    NotificationEvent = NotificationEvent(PhaseTrainingFailed)
+	NotifyTest              NotificationEvent = "test"
+)
+
+// DefaultNotificationEvents are sent to the sinks that don't list their Events
+var DefaultNotificationEvents = []NotificationEvent{NotificationEvent(PhaseReady), NotificationEvent(PhaseFailed), NotificationEvent(PhaseInterrupted), NotifyTrainingCompleted, NotifyTrainingFailed}
+
+// NotificationSinkConfiguration is where notifications are sent. Webhooks receive a
+// Notification as JSON, Slack sinks a message for a Slack incoming webhook.
+type NotificationSinkConfiguration struct {
+	Type   NotificationSinkType `mapstructure:"type" json:"type"`
+	Url    string               `mapstructure:"url" json:"url"`
+	Events []NotificationEvent  `mapstructure:"events" json:"events,omitempty"`
+}
+
+// NotificationsConfiguration holds the sinks an instance notifies, and the name of the study it
+// notifies about
+type NotificationsConfiguration struct {
+	Source string                          `json:"source"`
+	Sinks  []NotificationSinkConfiguration `json:"sinks"`
+}
+
+// Notification is the payload of webhooks. Source is the study or host it is about.
+type Notification struct {
+	Event   NotificationEvent `json:"event"`
+	Source  string            `json:"source"`
+	Message string            `json:"message"`
+	Time    time.Time         `json:"time"`
+}
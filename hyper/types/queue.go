@@ -0,0 +1,47 @@
+package types
+
+import "time"
+
+type QueuedJobStatus string
+
+const (
+	QueuedJobQueued    QueuedJobStatus = "queued"
+	QueuedJobRunning   QueuedJobStatus = "running"
+	QueuedJobCompleted QueuedJobStatus = "completed"
+	QueuedJobFailed    QueuedJobStatus = "failed"
+	QueuedJobCancelled QueuedJobStatus = "cancelled"
+)
+
+// QueuedTrainingJob is a training job submitted to the local training queue. StudyPath is the
+// absolute path of the study directory the job is run from.
+type QueuedTrainingJob struct {
+	Id              string          `json:"id"`
+	StudyName       string          `json:"study_name"`
+	StudyPath       string          `json:"study_path"`
+	ManifestPath    string          `json:"manifest_path"`
+	Overrides       []string        `json:"overrides"`
+	Flavor          string          `json:"flavor"`
+	StageRemoteData bool            `json:"stage_remote_data"`
+	WorkspaceRemote string          `json:"workspace_remote"`
+	CPUs            float64         `json:"cpus"`
+	Memory          int64           `json:"memory"`
+	Status          QueuedJobStatus `json:"status"`
+	SubmittedAt     time.Time       `json:"submitted_at"`
+	StartedAt       time.Time       `json:"started_at"`
+	FinishedAt      time.Time       `json:"finished_at"`
+	LogPath         string          `json:"log_path"`
+	Error           string          `json:"error"`
+}
+
+// TrainingQueue is the on-disk state of the local training queue
+type TrainingQueue struct {
+	WorkerPid int                 `json:"worker_pid"`
+	Jobs      []QueuedTrainingJob `json:"jobs"`
+}
+
+type TrainingWorkerOptions struct {
+	Concurrency int
+	CPUs        float64
+	Memory      int64
+	Follow      bool
+}
@@ -1,5 +1,79 @@
 package types
 
+import "time"
+
+// RemoteStatusPhase is the step a remote instance is at, from being provisioned to serving its
+// notebook or failing to, or the step a training is at
+type RemoteStatusPhase string
+
+const (
+	PhaseProvisioning      RemoteStatusPhase = "provisioning"
+	PhasePullingWorkspace  RemoteStatusPhase = "pulling-workspace"
+	PhaseLaunchingNotebook RemoteStatusPhase = "launching-notebook"
+	PhaseReady             RemoteStatusPhase = "ready"
+	PhaseFailed            RemoteStatusPhase = "failed"
+	PhaseInterrupted       RemoteStatusPhase = "interrupted"
+	PhasePaused            RemoteStatusPhase = "paused"
+	PhaseTerminated        RemoteStatusPhase = "terminated"
+
+	PhaseTrainingPending   RemoteStatusPhase = "training-pending"
+	PhaseTraining          RemoteStatusPhase = "training"
+	PhaseTrainingCompleted RemoteStatusPhase = "training-completed"
+	PhaseTrainingFailed    RemoteStatusPhase = "training-failed"
+)
+
+var ValidRemoteStatusPhases = []RemoteStatusPhase{PhaseProvisioning, PhasePullingWorkspace, PhaseLaunchingNotebook, PhaseReady, PhaseFailed, PhaseInterrupted, PhasePaused, PhaseTerminated, PhaseTrainingPending, PhaseTraining, PhaseTrainingCompleted, PhaseTrainingFailed}
+
+// RemoteStatus is the current state of a remote instance, and every update that led to it, oldest
+// first. Progress is a percentage of the current phase, 0 if it isn't known.
 type RemoteStatus struct {
-	Message string `json:"message"`
-}
\ No newline at end of file
+	Message   string              `json:"message"`
+	Phase     RemoteStatusPhase   `json:"phase,omitempty"`
+	Progress  int                 `json:"progress,omitempty"`
+	UpdatedAt time.Time           `json:"updated_at"`
+	Events    []RemoteStatusEvent `json:"events,omitempty"`
+}
+
+// RemoteStatusEvent is one update of the status of a remote instance
+type RemoteStatusEvent struct {
+	Time     time.Time         `json:"time"`
+	Phase    RemoteStatusPhase `json:"phase,omitempty"`
+	Message  string            `json:"message"`
+	Progress int               `json:"progress,omitempty"`
+}
+
+type IRemoteService interface {
+	Status(options RemoteStatusOptions)
+	Pause()
+	Resume(options RemoteResumeOptions)
+	Destroy()
+}
+
+// RemoteStatusOptions configure `remote status`. With Watch, the status is followed until the
+// instance is ready or has failed, for up to Timeout.
+type RemoteStatusOptions struct {
+	Watch   bool
+	History bool
+	Timeout time.Duration
+}
+
+// RemoteResumeOptions configure `remote resume`. With Wait, the resume waits for the instance to
+// report that it is ready again, for up to Timeout.
+type RemoteResumeOptions struct {
+	Wait    bool
+	Timeout time.Duration
+}
+
+// RemoteStatusEndpointOptions configure the status endpoint. Requests must carry the Token as a
+// bearer token unless it is empty. With TLS, the endpoint serves a self-signed certificate it
+// generates, and writes its fingerprint to FingerprintFile. The sync stats of the workspace at
+// WorkspacePath are reported with the metrics.
+type RemoteStatusEndpointOptions struct {
+	Port            string
+	StatusFilePath  string
+	WorkspacePath   string
+	BindAddress     string
+	Token           string
+	TLS             bool
+	FingerprintFile string
+}
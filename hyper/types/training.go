@@ -0,0 +1,86 @@
+package types
+
+import "time"
+
+type TrainingJobOptions struct {
+	StageRemoteData bool
+	Overrides       []string
+	SyncOptions     WorkspaceSyncOptions
+}
+
+// TrainingDataSources are the feature and target sources handed to the executor, either
+// relative to the job directory or as remote URIs the executor reads directly
+type TrainingDataSources struct {
+	Features string
+	Target   string
+}
+
+// TrainingJobMetadata is uploaded as _job.json next to the job's _study.yaml so a run can be reproduced
+type TrainingJobMetadata struct {
+	RunId          string            `json:"run_id"`
+	StudyName      string            `json:"study_name"`
+	ProjectName    string            `json:"project_name"`
+	SubmittedAt    time.Time         `json:"submitted_at"`
+	Overrides      []string          `json:"overrides"`
+	FeaturesSource string            `json:"features_source"`
+	TargetSource   string            `json:"target_source"`
+	DataChecksums  map[string]string `json:"data_checksums"`
+}
+
+// TrainingJob describes a job that has been uploaded to a notebook server
+type TrainingJob struct {
+	Metadata TrainingJobMetadata
+	Manifest []byte
+}
+
+// ITrainingStatusProvider reads the status of the training of a study from the backend it is
+// trained on. The status has the schema of the status endpoint, with the training phases. Close
+// releases the connection to the backend, if it keeps one.
+type ITrainingStatusProvider interface {
+	GetTrainingStatus() (RemoteStatus, error)
+	Close()
+}
+
+type TrainingRunStatus string
+
+const (
+	TrainingRunSubmitted TrainingRunStatus = "submitted"
+	TrainingRunCompleted TrainingRunStatus = "completed"
+)
+
+// TrainingRun is the archived record of a single `hyper train` run, stored as _run.json
+type TrainingRun struct {
+	TrainingJobMetadata
+	Remote      string            `json:"remote"`
+	Status      TrainingRunStatus `json:"status"`
+	CompletedAt time.Time         `json:"completed_at"`
+	BestTrial   string            `json:"best_trial"`
+	Trials      []TrainingTrial   `json:"trials"`
+}
+
+func (r TrainingRun) Duration() time.Duration {
+	if r.CompletedAt.IsZero() {
+		return 0
+	}
+	return r.CompletedAt.Sub(r.SubmittedAt)
+}
+
+// TrainingTrial holds the contents of a trial's _trial.json from the hyperpack
+type TrainingTrial struct {
+	Name            string                 `json:"name"`
+	Metrics         map[string]float64     `json:"metrics"`
+	Hyperparameters map[string]interface{} `json:"hyperparameters"`
+	Metadata        map[string]interface{} `json:"metadata"`
+}
+
+// TrainingContainerOptions configure the short-lived container a local training job is run in
+type TrainingContainerOptions struct {
+	Flavor    string
+	PullImage bool
+	CPUs      float64
+	Memory    int64
+	Env       []string
+	// CABundle is a PEM CA bundle on the host, mounted into the container for the executor to
+	// trust when it reads remote data sources
+	CABundle string
+}
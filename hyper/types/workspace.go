@@ -1,12 +1,174 @@
 package types
 
+import "time"
+
 type IWorkspaceService interface {
-	Sync(localPath string, watch bool, studyName string)
-	Pull(localPath string, studyName string)
+	Sync(localPath string, studyName string, settings WorkspaceSyncSettings)
+	Status(localPath string, studyName string)
+	Pull(localPath string, studyName string, dryRun bool)
 	Pack(studyName string, packPath string)
+	Snapshot(studyName string, message string)
+	Snapshots(studyName string)
+	Restore(localPath string, studyName string, snapshotId string, paths []string)
+	Fetch(studyName string, path string, filename string) error
+	Decrypt(src string, dst string)
+}
+
+// IWorkspaceBackend stores the files of workspaces for a type of workspace remote. Keys are
+// slash separated paths, starting with the study name for the files of a study's workspace.
+type IWorkspaceBackend interface {
+	GetUrl(key string) string
+	List(prefix string) ([]ObjectInfo, error)
+	Stat(key string) (ObjectInfo, error)
+	Upload(filename string, key string) (ObjectInfo, error)
+	Download(key string, filename string) error
+	Delete(key string) error
+	Copy(srcKey string, versionId string, dstKey string) (ObjectInfo, error)
+	ReadObject(key string) ([]byte, error)
+	WriteObject(key string, content []byte) error
+	IsVersioned() (bool, error)
+	ListCurrentVersions(prefix string) ([]ObjectInfo, error)
+	SameContent(filename string, object ObjectInfo) (bool, error)
+}
+
+// IWorkspaceMetadataBackend is implemented by the backends that can store metadata with the
+// objects they upload, which Stat returns
+type IWorkspaceMetadataBackend interface {
+	UploadWithMetadata(filename string, key string, metadata map[string]string) (ObjectInfo, error)
+}
+
+// IWorkspaceEventSource is implemented by the backends that can report remote changes as they
+// happen, from the event queue at queueUrl
+type IWorkspaceEventSource interface {
+	ReceiveObjectEvents(queueUrl string, waitSeconds int64) ([]ObjectEvent, error)
+}
+
+// IWorkspaceProvisioner is implemented by the backends that can create and configure the storage
+// of a workspace remote, reporting the state of each of its settings
+type IWorkspaceProvisioner interface {
+	Provision(studyName string, settings WorkspaceInitSettings) ([]WorkspaceInitStep, error)
 }
 
 type WorkspaceSyncOptions struct {
-	StudyName string
-	S3Config  S3WorkspacePersistenceRemoteConfiguration
+	StudyName        string
+	Type             WorkspacePersistenceRemoteType
+	S3Config         S3WorkspacePersistenceRemoteConfiguration
+	FilesystemConfig FilesystemWorkspacePersistenceRemoteConfiguration
+	GCSConfig        GCSWorkspacePersistenceRemoteConfiguration
+	AzureBlobConfig  AzureBlobWorkspacePersistenceRemoteConfiguration
+	Encryption       WorkspaceEncryptionConfiguration
+	Transfer         WorkspaceTransferSettings
+}
+
+// WorkspaceTransferSettings tune the transfers of workspace files. MaxBandwidth is in bytes per
+// second, shared by all transfers, and unlimited if zero. Up to Parallel files are transferred
+// at once, and a failed transfer is attempted again up to Retries times. Files of at least
+// MultipartThreshold bytes are transferred in parts of MultipartChunkSize bytes.
+type WorkspaceTransferSettings struct {
+	MaxBandwidth       int64
+	Parallel           int
+	Retries            int
+	MultipartThreshold int64
+	MultipartChunkSize int64
+}
+
+type ConflictPolicy string
+
+const (
+	ConflictKeepBoth     ConflictPolicy = "keep-both"
+	ConflictPreferLocal  ConflictPolicy = "prefer-local"
+	ConflictPreferRemote ConflictPolicy = "prefer-remote"
+	ConflictAbort        ConflictPolicy = "abort"
+)
+
+var ValidConflictPolicies = []ConflictPolicy{ConflictKeepBoth, ConflictPreferLocal, ConflictPreferRemote, ConflictAbort}
+
+// WorkspaceSyncSettings configure `workspace sync`. In watch mode local changes are pushed once a
+// file has been quiet for Debounce; remote changes are pulled every PullInterval, or as they are
+// reported by the S3 event notification queue at EventQueueUrl. ConflictPolicy decides what
+// happens to files modified on both sides since the last sync. A DryRun only lists the changes.
+type WorkspaceSyncSettings struct {
+	Watch          bool
+	Debounce       time.Duration
+	PullInterval   time.Duration
+	EventQueueUrl  string
+	ConflictPolicy ConflictPolicy
+	DryRun         bool
+}
+
+// SYNC_STATS_FILE_NAME is kept at the root of a workspace synced with `workspace sync --watch`,
+// for the status endpoint of the instance to report the syncs. It is never synced itself.
+const SYNC_STATS_FILE_NAME = ".hyperdrive-sync-stats.json"
+
+// WorkspaceSyncStats count what the syncs of a watched workspace did since the watch started. A
+// sync fails when any of its files could not be synced.
+type WorkspaceSyncStats struct {
+	Syncs            int64     `json:"syncs"`
+	FailedSyncs      int64     `json:"failed_syncs"`
+	FilesTransferred int64     `json:"files_transferred"`
+	FilesFailed      int64     `json:"files_failed"`
+	BytesTransferred int64     `json:"bytes_transferred"`
+	LastSyncAt       time.Time `json:"last_sync_at"`
+}
+
+// WorkspaceInitSettings configure the bucket `workspace init` provisions. Its lifecycle rules
+// expire the study's `_jobs` artifacts after ExpireJobsAfterDays, and abort multipart uploads
+// that were never completed after AbortIncompleteUploadsAfterDays. A rule is left as it is when
+// its days are zero.
+type WorkspaceInitSettings struct {
+	Versioning                      bool
+	ExpireJobsAfterDays             int64
+	AbortIncompleteUploadsAfterDays int64
+}
+
+// WorkspaceInitStep is the state of one setting of a provisioned workspace remote, and whether
+// `workspace init` changed it
+type WorkspaceInitStep struct {
+	Setting string
+	State   string
+	Changed bool
+}
+
+// BucketLifecycleRule is a lifecycle rule of a bucket for the objects under Prefix. Actions whose
+// days are zero are left out of the rule.
+type BucketLifecycleRule struct {
+	Id                              string
+	Prefix                          string
+	ExpirationDays                  int64
+	NoncurrentVersionExpirationDays int64
+	AbortIncompleteUploadDays       int64
+}
+
+type ObjectInfo struct {
+	Key          string
+	Exists       bool
+	Size         int64
+	LastModified time.Time
+	ETag         string
+	VersionId    string
+	// Metadata is only read by Stat, and only by the backends that store it
+	Metadata map[string]string
+}
+
+// ObjectEvent is a change to a single object reported by the remote
+type ObjectEvent struct {
+	Key     string
+	Removed bool
+}
+
+// WorkspaceSnapshot is the manifest of a workspace snapshot: every file of the remote workspace
+// at the time, with the object version or the copy it can be restored from
+type WorkspaceSnapshot struct {
+	Id        string                  `json:"id"`
+	CreatedAt time.Time               `json:"created_at"`
+	Message   string                  `json:"message,omitempty"`
+	Files     []WorkspaceSnapshotFile `json:"files"`
+}
+
+type WorkspaceSnapshotFile struct {
+	Path      string `json:"path"`
+	Size      int64  `json:"size"`
+	ETag      string `json:"etag"`
+	VersionId string `json:"version_id,omitempty"`
+	Blob      string `json:"blob,omitempty"`
 }